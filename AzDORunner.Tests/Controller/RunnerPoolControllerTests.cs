@@ -0,0 +1,79 @@
+using AzDORunner.Controller;
+using AzDORunner.Entities;
+using AzDORunner.Finalizer;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using KubeOps.Abstractions.Events;
+using KubeOps.Abstractions.Finalizer;
+
+namespace AzDORunner.Tests.Controller;
+
+public class RunnerPoolControllerTests
+{
+    private const string FinalizerName = "runnerpoolfinalizer.devops.opentools.mf";
+
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly RunnerPoolController _controller;
+    private int? _requestsBeforeFinalizer;
+
+    public RunnerPoolControllerTests()
+    {
+        EventPublisher eventPublisher = (_, _, _, _, _) => Task.CompletedTask;
+
+        var metrics = new OperatorMetrics();
+        var podService = new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, metrics);
+        var statusService = new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance);
+        var leaderElection = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client);
+
+        _pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, _azureDevOps, podService,
+            _kubernetes.Client, statusService, metrics, eventPublisher, leaderElection);
+        var errorPodCleanupService = new ErrorPodCleanupService(NullLogger<ErrorPodCleanupService>.Instance, podService, _azureDevOps,
+            _kubernetes.Client, leaderElection, _pollingService);
+
+        // Stands in for KubeOps, which adds the finalizer with a full object update
+        EntityFinalizerAttacher<RunnerPoolFinalizer, V1AzDORunnerEntity> finalizerAttacher = (entity, _) =>
+        {
+            _requestsBeforeFinalizer = _kubernetes.Requests.Count;
+            _kubernetes.Update<V1AzDORunnerEntity>(entity.Metadata.Name, entity.Metadata.NamespaceProperty,
+                pool => pool.Metadata.Finalizers = new List<string> { FinalizerName });
+            return Task.FromResult(_kubernetes.Get<V1AzDORunnerEntity>(entity.Metadata.Name, entity.Metadata.NamespaceProperty)!);
+        };
+
+        _controller = new RunnerPoolController(
+            NullLogger<RunnerPoolController>.Instance,
+            _azureDevOps,
+            _pollingService,
+            errorPodCleanupService,
+            finalizerAttacher,
+            new ReconcileDispatcher(NullLogger<ReconcileDispatcher>.Instance, new FakeHostApplicationLifetime()),
+            new RunnerPoolReconciler(NullLogger<RunnerPoolReconciler>.Instance, _azureDevOps, podService, _kubernetes.Client,
+                _pollingService, errorPodCleanupService, statusService, eventPublisher));
+    }
+
+    [Fact]
+    public async Task Reconcile_AttachesTheFinalizerBeforeTouchingTheCluster()
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret());
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+
+        await _controller.ReconcileAsync(pool, CancellationToken.None);
+
+        Assert.Equal(0, _requestsBeforeFinalizer);
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.Conditions.Any(c => c.Type == "Ready"));
+        Assert.Equal(new[] { FinalizerName }, updated.Metadata.Finalizers);
+    }
+
+    [Fact]
+    public async Task Reconcile_RegistersThePoolWithTheFinalizerAttached()
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret());
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+
+        await _controller.ReconcileAsync(pool, CancellationToken.None);
+
+        var registered = Assert.Single(_pollingService.GetPoolsUsingSecret("default", "azdo-pat"));
+        Assert.Equal(new[] { FinalizerName }, registered.Entity.Metadata.Finalizers);
+    }
+}
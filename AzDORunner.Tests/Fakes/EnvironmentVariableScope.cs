@@ -0,0 +1,30 @@
+namespace AzDORunner.Tests.Fakes;
+
+// Services read their settings from the environment, tests that change it run one at a time
+[CollectionDefinition(Name, DisableParallelization = true)]
+public class EnvironmentCollection
+{
+    public const string Name = "Environment";
+}
+
+public sealed class EnvironmentVariableScope : IDisposable
+{
+    private readonly Dictionary<string, string?> _previous = new();
+
+    public EnvironmentVariableScope(params (string Name, string? Value)[] variables)
+    {
+        foreach (var (name, value) in variables)
+        {
+            _previous[name] = Environment.GetEnvironmentVariable(name);
+            Environment.SetEnvironmentVariable(name, value);
+        }
+    }
+
+    public void Dispose()
+    {
+        foreach (var (name, value) in _previous)
+        {
+            Environment.SetEnvironmentVariable(name, value);
+        }
+    }
+}
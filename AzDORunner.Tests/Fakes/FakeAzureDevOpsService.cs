@@ -0,0 +1,229 @@
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+
+namespace AzDORunner.Tests.Fakes;
+
+// An Azure DevOps organization with a single project's worth of pools, agents and job requests
+public class FakeAzureDevOpsService : IAzureDevOpsService
+{
+    #region Fields
+
+    private readonly object _lock = new();
+    private readonly List<string> _calls = new();
+
+    #endregion
+
+    #region Public Methods
+
+    public List<Pool> Pools { get; } = new() { new Pool { Id = 1, Name = "self-hosted", PoolType = "automation" } };
+
+    public List<Agent> Agents { get; } = new();
+
+    public List<JobRequest> JobRequests { get; } = new();
+
+    public ConnectionCheckResult Connection { get; set; } = ConnectionCheckResult.Connected;
+
+    public bool CancelSucceeds { get; set; } = true;
+
+    public bool SetAgentEnabledSucceeds { get; set; } = true;
+
+    // Thrown from GetPoolAsync, like an HTTP failure the service doesn't translate into null
+    public Exception? GetPoolFailure { get; set; }
+
+    // Thrown from the job request and agent lists, like a list call Azure DevOps failed or rejected
+    public Exception? ListFailure { get; set; }
+
+    public List<int> CanceledRequests { get; } = new();
+
+    public List<string> UnregisteredAgents { get; } = new();
+
+    public List<string> DisabledAgents { get; } = new();
+
+    public List<string> EnabledAgents { get; } = new();
+
+    // Azure DevOps pool names in the order their job requests were read, once per poll and cleanup pass
+    public List<string> JobRequestReads { get; } = new();
+
+    public IReadOnlyList<string> Calls
+    {
+        get
+        {
+            lock (_lock)
+            {
+                return _calls.ToList();
+            }
+        }
+    }
+
+    public Task<List<JobRequest>> GetJobRequestsAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetJobRequestsAsync));
+        lock (_lock)
+        {
+            JobRequestReads.Add(poolName);
+        }
+
+        if (ListFailure != null)
+        {
+            return Task.FromException<List<JobRequest>>(ListFailure);
+        }
+
+        return Task.FromResult(Connection == ConnectionCheckResult.Connected ? JobRequests.ToList() : new List<JobRequest>());
+    }
+
+    public Task<List<JobRequest>> GetQueuedJobsWithCapabilitiesAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetQueuedJobsWithCapabilitiesAsync));
+        return Task.FromResult(JobRequests.Where(j => j.IsQueued).ToList());
+    }
+
+    public async Task<bool> TestConnectionAsync(string azDoUrl, string pat)
+    {
+        return await CheckConnectionAsync(azDoUrl, pat) == ConnectionCheckResult.Connected;
+    }
+
+    public Task<ConnectionCheckResult> CheckConnectionAsync(string azDoUrl, string pat)
+    {
+        Record(nameof(CheckConnectionAsync));
+        return Task.FromResult(Connection);
+    }
+
+    public Task<int> GetQueuedJobsCountAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetQueuedJobsCountAsync));
+        return Task.FromResult(JobRequests.Count(j => j.IsQueued));
+    }
+
+    public Task<int> GetRunningJobsCountAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetRunningJobsCountAsync));
+        return Task.FromResult(JobRequests.Count(j => j.IsRunning));
+    }
+
+    public Task<List<Pool>> ListPoolsAsync(string azDoUrl, string pat)
+    {
+        Record(nameof(ListPoolsAsync));
+        return Task.FromResult(Pools.ToList());
+    }
+
+    public Task<List<string>> GetAvailablePoolNamesAsync(string azDoUrl, string pat)
+    {
+        return Task.FromResult(Pools.Select(p => p.Name).ToList());
+    }
+
+    public Task<Pool?> GetPoolAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetPoolAsync));
+        if (GetPoolFailure != null)
+        {
+            return Task.FromException<Pool?>(GetPoolFailure);
+        }
+
+        if (Connection != ConnectionCheckResult.Connected)
+        {
+            return Task.FromResult<Pool?>(null);
+        }
+
+        var pool = Pools.FirstOrDefault(p => string.Equals(p.Name, poolName, StringComparison.OrdinalIgnoreCase));
+        if (pool != null)
+        {
+            // Azure DevOps reports how many agents are registered in the pool
+            pool.Size = Agents.Count;
+        }
+
+        return Task.FromResult(pool);
+    }
+
+    public Task<PoolLookup> LookupPoolAsync(string azDoUrl, string poolName, string pat, TimeSpan timeout, CancellationToken cancellationToken)
+    {
+        Record(nameof(LookupPoolAsync));
+        if (Connection != ConnectionCheckResult.Connected)
+        {
+            return Task.FromResult(new PoolLookup { Status = PoolLookupStatus.Unavailable, Error = Connection.ToString() });
+        }
+
+        var pool = Pools.FirstOrDefault(p => string.Equals(p.Name, poolName, StringComparison.OrdinalIgnoreCase));
+        return Task.FromResult(pool != null
+            ? new PoolLookup { Status = PoolLookupStatus.Found, Pool = pool }
+            : new PoolLookup { Status = PoolLookupStatus.NotFound });
+    }
+
+    public void EvictCachedPool(string azDoUrl, string poolName)
+    {
+        Record(nameof(EvictCachedPool));
+    }
+
+    public Task<List<Agent>> GetPoolAgentsAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetPoolAgentsAsync));
+        if (ListFailure != null)
+        {
+            return Task.FromException<List<Agent>>(ListFailure);
+        }
+
+        return Task.FromResult(Agents.ToList());
+    }
+
+    public Task<int?> GetPoolAgentCountAsync(string azDoUrl, string poolName, string pat)
+    {
+        Record(nameof(GetPoolAgentCountAsync));
+        return Task.FromResult<int?>(Agents.Count);
+    }
+
+    public Task<List<Agent>> GetOfflineAgentsOlderThanAsync(string azDoUrl, string poolName, TimeSpan age, string pat)
+    {
+        Record(nameof(GetOfflineAgentsOlderThanAsync));
+        return Task.FromResult(Agents.Where(a => a.IsOfflineLongerThan(age)).ToList());
+    }
+
+    public Task<Agent?> GetAgentByNameAsync(string azDoUrl, string poolName, string agentName, string pat)
+    {
+        Record(nameof(GetAgentByNameAsync));
+        return Task.FromResult(Agents.FirstOrDefault(a => a.Name == agentName));
+    }
+
+    public Task<bool> UnregisterAgentAsync(string azDoUrl, string poolName, string agentName, string pat)
+    {
+        Record(nameof(UnregisterAgentAsync));
+        UnregisteredAgents.Add(agentName);
+        return Task.FromResult(Agents.RemoveAll(a => a.Name == agentName) > 0);
+    }
+
+    public Task<bool> CancelJobRequestAsync(string azDoUrl, string poolName, int requestId, string pat)
+    {
+        Record(nameof(CancelJobRequestAsync));
+        CanceledRequests.Add(requestId);
+        return Task.FromResult(CancelSucceeds);
+    }
+
+    public Task<bool> DisableAgentAsync(string azDoUrl, string poolName, string agentName, string pat)
+    {
+        return SetAgentEnabledAsync(azDoUrl, poolName, agentName, false, pat);
+    }
+
+    public Task<bool> SetAgentEnabledAsync(string azDoUrl, string poolName, string agentName, bool enabled, string pat)
+    {
+        Record(nameof(SetAgentEnabledAsync));
+        (enabled ? EnabledAgents : DisabledAgents).Add(agentName);
+        return Task.FromResult(SetAgentEnabledSucceeds && Agents.Any(a => a.Name == agentName));
+    }
+
+    public string ExtractOrganizationName(string azDoUrl)
+    {
+        return AzureDevOpsUrl.TryParse(azDoUrl, out var parsed) ? parsed.Organization : "Invalid";
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private void Record(string call)
+    {
+        lock (_lock)
+        {
+            _calls.Add(call);
+        }
+    }
+
+    #endregion
+}
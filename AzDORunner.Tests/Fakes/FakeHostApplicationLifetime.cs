@@ -0,0 +1,19 @@
+using Microsoft.Extensions.Hosting;
+
+namespace AzDORunner.Tests.Fakes;
+
+public sealed class FakeHostApplicationLifetime : IHostApplicationLifetime
+{
+    private readonly CancellationTokenSource _stopping = new();
+
+    public CancellationToken ApplicationStarted => CancellationToken.None;
+
+    public CancellationToken ApplicationStopping => _stopping.Token;
+
+    public CancellationToken ApplicationStopped => CancellationToken.None;
+
+    public void StopApplication()
+    {
+        _stopping.Cancel();
+    }
+}
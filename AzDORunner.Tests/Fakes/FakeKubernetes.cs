@@ -0,0 +1,362 @@
+using System.Net;
+using System.Text;
+using System.Text.Json.Nodes;
+using System.Web;
+using AzDORunner.Entities;
+using k8s;
+using k8s.Models;
+
+namespace AzDORunner.Tests.Fakes;
+
+// Serves the parts of the Kubernetes API the operator uses from memory. Objects are kept as JSON,
+// so whatever the services send goes through the same serialization as against a real apiserver.
+public sealed class FakeKubernetes : DelegatingHandler
+{
+    #region Fields
+
+    private readonly object _lock = new();
+    private readonly Dictionary<(string Api, string Plural, string Namespace, string Name), JsonObject> _objects = new();
+    private readonly List<FakeRequest> _requests = new();
+    private int _resourceVersion;
+
+    #endregion
+
+    #region Constructor
+
+    public FakeKubernetes()
+    {
+        Client = new Kubernetes(new KubernetesClientConfiguration { Host = "http://localhost" }, this);
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    public IKubernetes Client { get; }
+
+    // Lets a test fail or delay specific calls, returning null serves the request normally
+    public Func<FakeRequest, HttpResponseMessage?>? Intercept { get; set; }
+
+    public IReadOnlyList<FakeRequest> Requests
+    {
+        get
+        {
+            lock (_lock)
+            {
+                return _requests.ToList();
+            }
+        }
+    }
+
+    public T Add<T>(T obj) where T : IKubernetesObject<V1ObjectMeta>
+    {
+        var (api, plural) = GetResource(typeof(T));
+        var node = JsonNode.Parse(KubernetesJson.Serialize(obj))!.AsObject();
+        lock (_lock)
+        {
+            var stored = Store(api, plural, obj.Metadata.NamespaceProperty ?? "default", node);
+            return KubernetesJson.Deserialize<T>(stored.ToJsonString());
+        }
+    }
+
+    public T? Get<T>(string name, string namespaceName = "default") where T : IKubernetesObject<V1ObjectMeta>
+    {
+        var (api, plural) = GetResource(typeof(T));
+        lock (_lock)
+        {
+            return _objects.TryGetValue((api, plural, namespaceName, name), out var node)
+                ? KubernetesJson.Deserialize<T>(node.ToJsonString())
+                : default;
+        }
+    }
+
+    public List<T> List<T>(string namespaceName = "default") where T : IKubernetesObject<V1ObjectMeta>
+    {
+        var (api, plural) = GetResource(typeof(T));
+        lock (_lock)
+        {
+            return _objects
+                .Where(o => o.Key.Api == api && o.Key.Plural == plural && o.Key.Namespace == namespaceName)
+                .Select(o => KubernetesJson.Deserialize<T>(o.Value.ToJsonString()))
+                .ToList();
+        }
+    }
+
+    public void Update<T>(string name, string namespaceName, Action<T> update) where T : IKubernetesObject<V1ObjectMeta>
+    {
+        var (api, plural) = GetResource(typeof(T));
+        lock (_lock)
+        {
+            var key = (api, plural, namespaceName, name);
+            var obj = KubernetesJson.Deserialize<T>(_objects[key].ToJsonString());
+            update(obj);
+            var node = JsonNode.Parse(KubernetesJson.Serialize(obj))!.AsObject();
+            node["metadata"]!["resourceVersion"] = NextResourceVersion();
+            _objects[key] = node;
+        }
+    }
+
+    public void SetPodPhase(string name, string phase, string namespaceName = "default")
+    {
+        Update<V1Pod>(name, namespaceName, pod =>
+        {
+            pod.Status ??= new V1PodStatus();
+            pod.Status.Phase = phase;
+        });
+    }
+
+    public int CountRequests(string method, string pathFragment)
+    {
+        return Requests.Count(r => r.Method == method && r.Path.Contains(pathFragment));
+    }
+
+    // Status updates are fire and forget in the services, so tests wait for them to land
+    public async Task<T> WaitForAsync<T>(string name, Func<T, bool> condition, string namespaceName = "default")
+        where T : IKubernetesObject<V1ObjectMeta>
+    {
+        var deadline = DateTime.UtcNow.AddSeconds(5);
+        while (true)
+        {
+            var obj = Get<T>(name, namespaceName);
+            if (obj != null && condition(obj))
+            {
+                return obj;
+            }
+
+            if (DateTime.UtcNow > deadline)
+            {
+                throw new TimeoutException($"{typeof(T).Name} {namespaceName}/{name} did not reach the expected state");
+            }
+
+            await Task.Delay(10);
+        }
+    }
+
+    #endregion
+
+    #region Http Handler
+
+    protected override async Task<HttpResponseMessage> SendAsync(HttpRequestMessage request, CancellationToken cancellationToken)
+    {
+        var body = request.Content != null ? await request.Content.ReadAsStringAsync(cancellationToken) : null;
+        var fakeRequest = new FakeRequest(request.Method.Method, request.RequestUri!.AbsolutePath,
+            HttpUtility.ParseQueryString(request.RequestUri.Query), body);
+
+        lock (_lock)
+        {
+            _requests.Add(fakeRequest);
+        }
+
+        var intercepted = Intercept?.Invoke(fakeRequest);
+        if (intercepted != null)
+        {
+            return intercepted;
+        }
+
+        lock (_lock)
+        {
+            return Handle(fakeRequest);
+        }
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private HttpResponseMessage Handle(FakeRequest request)
+    {
+        var segments = request.Path.Trim('/').Split('/');
+        var namespaceIndex = Array.IndexOf(segments, "namespaces");
+        if (namespaceIndex < 0 || segments.Length < namespaceIndex + 3)
+        {
+            // Cluster wide lists such as /api/v1/secrets
+            if (request.Method == "GET")
+            {
+                var api = "/" + string.Join('/', segments[..^1]);
+                return ListResponse(_objects.Where(o => o.Key.Api == api && o.Key.Plural == segments[^1]).Select(o => o.Value), request);
+            }
+
+            return Status(HttpStatusCode.NotFound, "NotFound", $"{request.Method} {request.Path} is not served by the fake");
+        }
+
+        var apiPath = "/" + string.Join('/', segments[..namespaceIndex]);
+        var namespaceName = segments[namespaceIndex + 1];
+        var plural = segments[namespaceIndex + 2];
+        var name = segments.Length > namespaceIndex + 3 ? segments[namespaceIndex + 3] : null;
+        var subresource = segments.Length > namespaceIndex + 4 ? segments[namespaceIndex + 4] : null;
+
+        var inCollection = _objects.Where(o => o.Key.Api == apiPath && o.Key.Plural == plural && o.Key.Namespace == namespaceName)
+            .Select(o => o.Value);
+
+        if (name == null)
+        {
+            switch (request.Method)
+            {
+                case "GET":
+                    return ListResponse(inCollection, request);
+                case "POST":
+                    var created = JsonNode.Parse(request.Body!)!.AsObject();
+                    var createdName = created["metadata"]?["name"]?.GetValue<string>();
+                    if (createdName != null && _objects.ContainsKey((apiPath, plural, namespaceName, createdName)))
+                    {
+                        return Status(HttpStatusCode.Conflict, "AlreadyExists", $"{plural} \"{createdName}\" already exists");
+                    }
+
+                    return Json(HttpStatusCode.Created, Store(apiPath, plural, namespaceName, created));
+                case "DELETE":
+                    var deleted = Filter(inCollection, request).ToList();
+                    foreach (var obj in deleted)
+                    {
+                        _objects.Remove((apiPath, plural, namespaceName, obj["metadata"]!["name"]!.GetValue<string>()));
+                    }
+
+                    return ListResponse(deleted, request);
+            }
+        }
+        else
+        {
+            var key = (apiPath, plural, namespaceName, name);
+            if (!_objects.TryGetValue(key, out var existing))
+            {
+                return Status(HttpStatusCode.NotFound, "NotFound", $"{plural} \"{name}\" not found");
+            }
+
+            switch (request.Method)
+            {
+                case "GET":
+                    return Json(HttpStatusCode.OK, existing);
+                case "PUT":
+                    var replacement = JsonNode.Parse(request.Body!)!.AsObject();
+                    var sentVersion = replacement["metadata"]?["resourceVersion"]?.GetValue<string>();
+                    if (!string.IsNullOrEmpty(sentVersion) && sentVersion != existing["metadata"]?["resourceVersion"]?.GetValue<string>())
+                    {
+                        return Status(HttpStatusCode.Conflict, "Conflict", $"the object {plural} \"{name}\" has been modified");
+                    }
+
+                    if (subresource == "status")
+                    {
+                        existing["status"] = replacement["status"]?.DeepClone();
+                        existing["metadata"]!["resourceVersion"] = NextResourceVersion();
+                        return Json(HttpStatusCode.OK, existing);
+                    }
+
+                    // Status only changes through the subresource, like on a real apiserver
+                    replacement["status"] = existing["status"]?.DeepClone();
+                    replacement["metadata"]!["uid"] = existing["metadata"]!["uid"]!.DeepClone();
+                    replacement["metadata"]!["creationTimestamp"] = existing["metadata"]!["creationTimestamp"]?.DeepClone();
+                    replacement["metadata"]!["resourceVersion"] = NextResourceVersion();
+                    _objects[key] = replacement;
+                    return Json(HttpStatusCode.OK, replacement);
+                case "DELETE":
+                    _objects.Remove(key);
+                    return Json(HttpStatusCode.OK, existing);
+            }
+        }
+
+        return Status(HttpStatusCode.MethodNotAllowed, "MethodNotAllowed", $"{request.Method} {request.Path} is not served by the fake");
+    }
+
+    private JsonObject Store(string api, string plural, string namespaceName, JsonObject obj)
+    {
+        var metadata = obj["metadata"] as JsonObject ?? new JsonObject();
+        obj["metadata"] = metadata;
+
+        var name = metadata["name"]?.GetValue<string>();
+        if (string.IsNullOrEmpty(name))
+        {
+            name = (metadata["generateName"]?.GetValue<string>() ?? string.Empty) + Guid.NewGuid().ToString("N")[..5];
+            metadata["name"] = name;
+        }
+
+        metadata["namespace"] = namespaceName;
+        metadata["uid"] ??= Guid.NewGuid().ToString();
+        metadata["creationTimestamp"] ??= DateTime.UtcNow.ToString("yyyy-MM-ddTHH:mm:ssZ");
+        metadata["resourceVersion"] = NextResourceVersion();
+
+        _objects[(api, plural, namespaceName, name)] = obj;
+        return obj;
+    }
+
+    private string NextResourceVersion()
+    {
+        return (++_resourceVersion).ToString();
+    }
+
+    private static IEnumerable<JsonObject> Filter(IEnumerable<JsonObject> objects, FakeRequest request)
+    {
+        var selector = request.Query["labelSelector"];
+        if (string.IsNullOrEmpty(selector))
+        {
+            return objects;
+        }
+
+        var requirements = selector.Split(',', StringSplitOptions.RemoveEmptyEntries | StringSplitOptions.TrimEntries);
+        return objects.Where(obj =>
+        {
+            var labels = obj["metadata"]?["labels"] as JsonObject;
+            return requirements.All(requirement =>
+            {
+                if (requirement.Contains("!="))
+                {
+                    var parts = requirement.Split("!=");
+                    return labels?[parts[0]]?.GetValue<string>() != parts[1];
+                }
+
+                if (requirement.Contains('='))
+                {
+                    var parts = requirement.Split('=', StringSplitOptions.RemoveEmptyEntries);
+                    return labels?[parts[0]]?.GetValue<string>() == parts[1];
+                }
+
+                return labels?.ContainsKey(requirement) == true;
+            });
+        });
+    }
+
+    private static HttpResponseMessage ListResponse(IEnumerable<JsonObject> objects, FakeRequest request)
+    {
+        var items = new JsonArray(Filter(objects, request).Select(o => (JsonNode)o.DeepClone()).ToArray());
+        return Json(HttpStatusCode.OK, new JsonObject
+        {
+            ["apiVersion"] = "v1",
+            ["kind"] = "List",
+            ["metadata"] = new JsonObject(),
+            ["items"] = items
+        });
+    }
+
+    private static HttpResponseMessage Json(HttpStatusCode statusCode, JsonNode body)
+    {
+        return new HttpResponseMessage(statusCode)
+        {
+            Content = new StringContent(body.ToJsonString(), Encoding.UTF8, "application/json")
+        };
+    }
+
+    private static HttpResponseMessage Status(HttpStatusCode statusCode, string reason, string message)
+    {
+        return Json(statusCode, new JsonObject
+        {
+            ["apiVersion"] = "v1",
+            ["kind"] = "Status",
+            ["status"] = "Failure",
+            ["reason"] = reason,
+            ["message"] = message,
+            ["code"] = (int)statusCode
+        });
+    }
+
+    private static (string Api, string Plural) GetResource(Type type)
+    {
+        return type == typeof(V1Pod) ? ("/api/v1", "pods")
+            : type == typeof(V1PersistentVolumeClaim) ? ("/api/v1", "persistentvolumeclaims")
+            : type == typeof(V1Secret) ? ("/api/v1", "secrets")
+            : type == typeof(Corev1Event) ? ("/api/v1", "events")
+            : type == typeof(V1AzDORunnerEntity) ? ("/apis/devops.opentools.mf/v1", "runnerpools")
+            : throw new NotSupportedException($"{type.Name} is not served by the fake");
+    }
+
+    #endregion
+}
+
+public record FakeRequest(string Method, string Path, System.Collections.Specialized.NameValueCollection Query, string? Body);
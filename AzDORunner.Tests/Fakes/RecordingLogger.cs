@@ -0,0 +1,87 @@
+namespace AzDORunner.Tests.Fakes;
+
+// Keeps every log entry together with the scope values that were active when it was written
+public sealed class RecordingLogger<T> : ILogger<T>
+{
+    #region Fields
+
+    private readonly AsyncLocal<Scope?> _currentScope = new();
+    private readonly List<LogEntry> _entries = new();
+
+    #endregion
+
+    #region Public Methods
+
+    public IReadOnlyList<LogEntry> Entries
+    {
+        get
+        {
+            lock (_entries)
+            {
+                return _entries.ToList();
+            }
+        }
+    }
+
+    public IDisposable? BeginScope<TState>(TState state) where TState : notnull
+    {
+        var scope = new Scope(this, state, _currentScope.Value);
+        _currentScope.Value = scope;
+        return scope;
+    }
+
+    public bool IsEnabled(LogLevel logLevel)
+    {
+        return true;
+    }
+
+    public void Log<TState>(LogLevel logLevel, EventId eventId, TState state, Exception? exception, Func<TState, Exception?, string> formatter)
+    {
+        // Inner scopes win when the same key is set twice, like in the JSON console formatter
+        var scopeValues = new Dictionary<string, object?>();
+        for (var scope = _currentScope.Value; scope != null; scope = scope.Parent)
+        {
+            if (scope.State is IEnumerable<KeyValuePair<string, object>> values)
+            {
+                foreach (var (key, value) in values)
+                {
+                    scopeValues.TryAdd(key, value);
+                }
+            }
+        }
+
+        lock (_entries)
+        {
+            _entries.Add(new LogEntry(logLevel, formatter(state, exception), scopeValues));
+        }
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private sealed class Scope : IDisposable
+    {
+        private readonly RecordingLogger<T> _logger;
+
+        public Scope(RecordingLogger<T> logger, object state, Scope? parent)
+        {
+            _logger = logger;
+            State = state;
+            Parent = parent;
+        }
+
+        public object State { get; }
+
+        public Scope? Parent { get; }
+
+        public void Dispose()
+        {
+            _logger._currentScope.Value = Parent;
+        }
+    }
+
+    #endregion
+}
+
+public record LogEntry(LogLevel Level, string Message, IReadOnlyDictionary<string, object?> Scope);
@@ -0,0 +1,87 @@
+using System.Net;
+using System.Text;
+using System.Text.Json;
+
+namespace AzDORunner.Tests.Fakes;
+
+// Answers HttpClient requests from a test callback and records what was sent
+public sealed class StubHttpHandler : HttpMessageHandler
+{
+    #region Fields
+
+    private readonly Func<HttpRequestMessage, CancellationToken, Task<HttpResponseMessage>> _respond;
+    private readonly object _lock = new();
+    private readonly List<StubRequest> _requests = new();
+
+    #endregion
+
+    #region Constructor
+
+    public StubHttpHandler(Func<HttpRequestMessage, HttpResponseMessage> respond)
+        : this((request, _) => Task.FromResult(respond(request)))
+    {
+    }
+
+    public StubHttpHandler(Func<HttpRequestMessage, CancellationToken, Task<HttpResponseMessage>> respond)
+    {
+        _respond = respond;
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    public IReadOnlyList<StubRequest> Requests
+    {
+        get
+        {
+            lock (_lock)
+            {
+                return _requests.ToList();
+            }
+        }
+    }
+
+    public static HttpResponseMessage Json(object value, HttpStatusCode statusCode = HttpStatusCode.OK)
+    {
+        return new HttpResponseMessage(statusCode)
+        {
+            Content = new StringContent(JsonSerializer.Serialize(value, new JsonSerializerOptions(JsonSerializerDefaults.Web)),
+                Encoding.UTF8, "application/json")
+        };
+    }
+
+    // The envelope Azure DevOps wraps every list response in
+    public static HttpResponseMessage List(IEnumerable<object> values, string? continuationToken = null)
+    {
+        var items = values.ToList();
+        var response = Json(new { count = items.Count, value = items });
+        if (continuationToken != null)
+        {
+            response.Headers.Add("x-ms-continuationtoken", continuationToken);
+        }
+
+        return response;
+    }
+
+    #endregion
+
+    #region Http Handler
+
+    protected override async Task<HttpResponseMessage> SendAsync(HttpRequestMessage request, CancellationToken cancellationToken)
+    {
+        var body = request.Content != null ? await request.Content.ReadAsStringAsync(cancellationToken) : null;
+        lock (_lock)
+        {
+            _requests.Add(new StubRequest(request.Method.Method, request.RequestUri!, body));
+        }
+
+        var response = await _respond(request, cancellationToken);
+        response.RequestMessage ??= request;
+        return response;
+    }
+
+    #endregion
+}
+
+public record StubRequest(string Method, Uri Uri, string? Body);
@@ -0,0 +1,164 @@
+using AzDORunner.Entities;
+using AzDORunner.Finalizer;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using k8s.Models;
+using KubeOps.Abstractions.Events;
+
+namespace AzDORunner.Tests.Finalizer;
+
+public class RunnerPoolFinalizerTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly RunnerPoolFinalizer _finalizer;
+
+    public RunnerPoolFinalizerTests()
+    {
+        EventPublisher eventPublisher = (_, _, _, _, _) => Task.CompletedTask;
+
+        var metrics = new OperatorMetrics();
+        var podService = new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, metrics);
+        var leaderElection = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client);
+
+        _pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, _azureDevOps, podService,
+            _kubernetes.Client, new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance),
+            metrics, eventPublisher, leaderElection);
+
+        _finalizer = new RunnerPoolFinalizer(
+            NullLogger<RunnerPoolFinalizer>.Instance,
+            podService,
+            _azureDevOps,
+            _kubernetes.Client,
+            _pollingService,
+            new ErrorPodCleanupService(NullLogger<ErrorPodCleanupService>.Instance, podService, _azureDevOps, _kubernetes.Client,
+                leaderElection, _pollingService),
+            new ReconcileDispatcher(NullLogger<ReconcileDispatcher>.Instance, new FakeHostApplicationLifetime()));
+
+        _kubernetes.Add(TestEntities.CreatePatSecret());
+    }
+
+    [Fact]
+    public async Task Finalize_DeletesThePodsAndUnregistersOnlyTheOperatorsAgents()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, isMinAgent: true));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 1, phase: "Succeeded"));
+        _azureDevOps.Agents.AddRange(new[]
+        {
+            new Agent { Id = 1, Name = "pool-agent-0", Status = "online" },
+            new Agent { Id = 2, Name = "pool-agent-1", Status = "offline" },
+            new Agent { Id = 3, Name = "build-vm-01", Status = "online" }
+        });
+        _pollingService.RegisterPool(pool, "pat");
+
+        await _finalizer.FinalizeAsync(pool, CancellationToken.None);
+
+        Assert.Empty(_kubernetes.List<V1Pod>());
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-1" }, _azureDevOps.UnregisteredAgents.OrderBy(n => n));
+        Assert.Equal(new[] { "build-vm-01" }, _azureDevOps.Agents.Select(a => a.Name));
+        Assert.False(_pollingService.IsRegistered(pool));
+    }
+
+    [Fact]
+    public async Task Finalize_StopsPollingSoDeletedPodsAreNotRecreated()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 1));
+        _pollingService.RegisterPool(pool, "pat");
+        await _pollingService.PollAllRegisteredPools();
+        Assert.Single(_kubernetes.List<V1Pod>());
+
+        await _finalizer.FinalizeAsync(pool, CancellationToken.None);
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.Empty(_kubernetes.List<V1Pod>());
+        Assert.Equal(1, _kubernetes.CountRequests("POST", "/pods"));
+    }
+
+    [Fact]
+    public async Task Finalize_SkipsUnregisteringWhenThePoolIsGoneFromAzureDevOps()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.Pool = "deleted-pool"));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+
+        await _finalizer.FinalizeAsync(pool, CancellationToken.None);
+
+        Assert.Empty(_kubernetes.List<V1Pod>());
+        Assert.Empty(_azureDevOps.UnregisteredAgents);
+        Assert.DoesNotContain(nameof(IAzureDevOpsService.GetPoolAgentsAsync), _azureDevOps.Calls);
+    }
+
+    [Fact]
+    public async Task Finalize_CompletesWhenThePoolLookupFails()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.GetPoolFailure = new HttpRequestException("Service Unavailable");
+
+        await _finalizer.FinalizeAsync(pool, CancellationToken.None);
+
+        Assert.Empty(_kubernetes.List<V1Pod>());
+        Assert.Empty(_azureDevOps.UnregisteredAgents);
+    }
+
+    [Fact]
+    public async Task Finalize_UnregistersAgentsEvenWhenPvcCleanupFails()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+        _kubernetes.Intercept = request => request.Path.Contains("/persistentvolumeclaims")
+            ? new HttpResponseMessage(System.Net.HttpStatusCode.InternalServerError)
+            : null;
+
+        await _finalizer.FinalizeAsync(pool, CancellationToken.None);
+
+        Assert.Empty(_kubernetes.List<V1Pod>());
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.UnregisteredAgents);
+    }
+
+    [Fact]
+    public async Task Finalize_DeletesThePvcsMarkedDeleteWithAgentAndReleasesTheRest()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.Pvcs = new()
+        {
+            new() { Name = "cache", MountPath = "/cache", Storage = "1Gi", DeleteWithAgent = true },
+            new() { Name = "workspace", MountPath = "/workspace", Storage = "10Gi" }
+        }));
+        _kubernetes.Add(CreatePoolPvc(pool, "pool-agent-0-cache", "cache"));
+        _kubernetes.Add(CreatePoolPvc(pool, "pool-agent-0-workspace", "workspace"));
+
+        await _finalizer.FinalizeAsync(pool, CancellationToken.None);
+
+        Assert.Null(_kubernetes.Get<V1PersistentVolumeClaim>("pool-agent-0-cache"));
+        var retained = _kubernetes.Get<V1PersistentVolumeClaim>("pool-agent-0-workspace");
+        Assert.NotNull(retained);
+        Assert.DoesNotContain(retained.Metadata.OwnerReferences ?? new List<V1OwnerReference>(), o => o.Uid == pool.Metadata.Uid);
+    }
+
+    private static V1PersistentVolumeClaim CreatePoolPvc(V1AzDORunnerEntity pool, string name, string pvcName)
+    {
+        return new V1PersistentVolumeClaim
+        {
+            ApiVersion = "v1",
+            Kind = "PersistentVolumeClaim",
+            Metadata = new V1ObjectMeta
+            {
+                Name = name,
+                NamespaceProperty = pool.Metadata.NamespaceProperty,
+                Labels = new Dictionary<string, string>
+                {
+                    ["runner-pool"] = pool.Metadata.Name,
+                    ["pvc-name"] = pvcName
+                },
+                OwnerReferences = new List<V1OwnerReference>
+                {
+                    new() { ApiVersion = pool.ApiVersion, Kind = pool.Kind, Name = pool.Metadata.Name, Uid = pool.Metadata.Uid }
+                }
+            }
+        };
+    }
+}
@@ -0,0 +1,37 @@
+using AzDORunner.Model.Domain;
+
+namespace AzDORunner.Tests.Model.Domain;
+
+public class AzureDevOpsUrlTests
+{
+    [Theory]
+    [InlineData("https://dev.azure.com/myorg", "myorg", true)]
+    [InlineData("https://dev.azure.com/myorg/", "myorg", true)]
+    [InlineData("https://dev.azure.com/myorg/myproject", "myorg", true)]
+    [InlineData("https://myorg.visualstudio.com", "myorg", true)]
+    [InlineData("https://myorg.visualstudio.com/DefaultCollection", "myorg", true)]
+    [InlineData("https://tfs.corp.local/tfs/DefaultCollection", "DefaultCollection", false)]
+    [InlineData("https://azdo.corp.local/ProjectCollection", "ProjectCollection", false)]
+    [InlineData("http://azdo.corp.local:8080/tfs/My%20Collection", "My Collection", false)]
+    public void TryParse_ReadsTheOrganizationOrCollection(string url, string organization, bool isCloud)
+    {
+        Assert.True(AzureDevOpsUrl.TryParse(url, out var parsed));
+        Assert.Equal(organization, parsed.Organization);
+        Assert.Equal(isCloud, parsed.IsCloud);
+    }
+
+    [Theory]
+    [InlineData(null)]
+    [InlineData("")]
+    [InlineData("dev.azure.com/myorg")]
+    [InlineData("ftp://dev.azure.com/myorg")]
+    [InlineData("https://dev.azure.com")]
+    [InlineData("https://dev.azure.com/_apis")]
+    [InlineData("https://dev.azure.com/myorg?api-version=7.0")]
+    [InlineData("https://tfs.corp.local/tfs")]
+    [InlineData("https://tfs.corp.local/")]
+    public void TryParse_RejectsUrlsWithoutAnOrganizationOrCollection(string? url)
+    {
+        Assert.False(AzureDevOpsUrl.TryParse(url, out _));
+    }
+}
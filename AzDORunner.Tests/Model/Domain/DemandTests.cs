@@ -0,0 +1,23 @@
+using AzDORunner.Model.Domain;
+
+namespace AzDORunner.Tests.Model.Domain;
+
+public class DemandTests
+{
+    [Theory]
+    [InlineData("java", "java", null, null)]
+    [InlineData("  docker  ", "docker", null, null)]
+    [InlineData("docker -equals true", "docker", "equals", "true")]
+    [InlineData("Agent.Version -gtVersion 2.0", "Agent.Version", "gtVersion", "2.0")]
+    [InlineData("Agent.OS -equals Windows NT", "Agent.OS", "equals", "Windows NT")]
+    [InlineData("maven", "maven", null, null)]
+    [InlineData("", "", null, null)]
+    public void Parse_SplitsNameOperatorAndValue(string demand, string name, string? op, string? value)
+    {
+        var parsed = Demand.Parse(demand);
+
+        Assert.Equal(name, parsed.Name);
+        Assert.Equal(op, parsed.Operator);
+        Assert.Equal(value, parsed.Value);
+    }
+}
@@ -0,0 +1,75 @@
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using Microsoft.Extensions.Diagnostics.HealthChecks;
+
+namespace AzDORunner.Tests.Services;
+
+[Collection(EnvironmentCollection.Name)]
+public class AzureDevOpsHealthCheckTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+
+    [Fact]
+    public async Task CheckHealth_FailsOnceEveryPoolHasBeenFailingForTooLongAndRecovers()
+    {
+        using var _ = new EnvironmentVariableScope(("AZDO_UNHEALTHY_AFTER_SECONDS", "1"), ("LEADER_ELECTION", null));
+        var (pollingService, healthCheck) = CreateHealthCheck();
+        pollingService.RegisterPool(_kubernetes.Add(TestEntities.CreatePool()), "pat");
+        _azureDevOps.GetPoolFailure = new HttpRequestException("Service Unavailable");
+
+        await pollingService.PollAllRegisteredPools();
+        Assert.Equal(HealthStatus.Healthy, (await healthCheck.CheckHealthAsync(new HealthCheckContext())).Status);
+
+        await Task.Delay(TimeSpan.FromSeconds(1.2));
+        var failing = await healthCheck.CheckHealthAsync(new HealthCheckContext());
+        Assert.Equal(HealthStatus.Unhealthy, failing.Status);
+        Assert.Contains("All 1 pools have failed to reach Azure DevOps", failing.Description);
+
+        _azureDevOps.GetPoolFailure = null;
+        pollingService.RequestPoll("default", "pool");
+        await pollingService.PollAllRegisteredPools();
+        var recovered = await healthCheck.CheckHealthAsync(new HealthCheckContext());
+        Assert.Equal(HealthStatus.Healthy, recovered.Status);
+        Assert.Equal("1/1 pools connected", recovered.Description);
+    }
+
+    [Fact]
+    public async Task CheckHealth_IsHealthyWithoutRegisteredPools()
+    {
+        using var _ = new EnvironmentVariableScope(("LEADER_ELECTION", null));
+        var (_, healthCheck) = CreateHealthCheck();
+
+        var result = await healthCheck.CheckHealthAsync(new HealthCheckContext());
+
+        Assert.Equal(HealthStatus.Healthy, result.Status);
+        Assert.Equal("No RunnerPools registered", result.Description);
+    }
+
+    [Fact]
+    public async Task CheckHealth_IsHealthyOnAStandbyReplica()
+    {
+        using var _ = new EnvironmentVariableScope(("AZDO_UNHEALTHY_AFTER_SECONDS", "1"), ("LEADER_ELECTION", "true"));
+        var (pollingService, healthCheck) = CreateHealthCheck();
+        pollingService.RegisterPool(_kubernetes.Add(TestEntities.CreatePool()), "pat");
+        _azureDevOps.GetPoolFailure = new HttpRequestException("Service Unavailable");
+
+        await pollingService.PollAllRegisteredPools();
+        await Task.Delay(TimeSpan.FromSeconds(1.2));
+
+        var result = await healthCheck.CheckHealthAsync(new HealthCheckContext());
+        Assert.Equal(HealthStatus.Healthy, result.Status);
+        Assert.Equal("Not the leader", result.Description);
+    }
+
+    private (AzureDevOpsPollingService PollingService, AzureDevOpsHealthCheck HealthCheck) CreateHealthCheck()
+    {
+        var metrics = new OperatorMetrics();
+        var leader = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client);
+        var pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, _azureDevOps,
+            new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, metrics), _kubernetes.Client,
+            new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance), metrics,
+            (_, _, _, _, _) => Task.CompletedTask, leader);
+        return (pollingService, new AzureDevOpsHealthCheck(pollingService, leader));
+    }
+}
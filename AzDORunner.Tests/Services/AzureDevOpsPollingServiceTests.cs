@@ -0,0 +1,1146 @@
+using System.Net;
+using AzDORunner.Entities;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using k8s.Models;
+using KubeOps.Abstractions.Events;
+
+namespace AzDORunner.Tests.Services;
+
+public class AzureDevOpsPollingServiceTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly List<(string Reason, string Message, EventType Type)> _events = new();
+    private readonly OperatorMetrics _metrics = new();
+    private readonly AzureDevOpsPollingService _pollingService;
+
+    public AzureDevOpsPollingServiceTests()
+    {
+        _pollingService = CreatePollingService(_azureDevOps);
+    }
+
+    [Fact]
+    public async Task Poll_ReadsThePoolSizeInsteadOfListingAgentsForAnEmptyPool()
+    {
+        await PollAsync(_kubernetes.Add(TestEntities.CreatePool()));
+
+        Assert.Single(_azureDevOps.Calls, call => call == nameof(IAzureDevOpsService.GetPoolAsync));
+        Assert.DoesNotContain(nameof(IAzureDevOpsService.GetPoolAgentCountAsync), _azureDevOps.Calls);
+        Assert.DoesNotContain(nameof(IAzureDevOpsService.GetPoolAgentsAsync), _azureDevOps.Calls);
+    }
+
+    [Fact]
+    public async Task Poll_ListsAgentsWhilePodsExistEvenIfThePoolLooksEmpty()
+    {
+        // The agent inside hasn't registered yet, or the pool size was read before it did
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, createdAt: DateTime.UtcNow));
+
+        await PollAsync(pool);
+
+        Assert.Contains(nameof(IAzureDevOpsService.GetPoolAgentsAsync), _azureDevOps.Calls);
+    }
+
+    [Fact]
+    public async Task Poll_ListsAgentsWhenThePoolHasAny()
+    {
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "someone-elses-agent", Status = "online" });
+
+        await PollAsync(_kubernetes.Add(TestEntities.CreatePool()));
+
+        Assert.Contains(nameof(IAzureDevOpsService.GetPoolAgentsAsync), _azureDevOps.Calls);
+    }
+
+    [Fact]
+    public async Task Poll_ReapsOnlyAgentsOfflineLongerThanAMinuteWithoutAPod()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 3, phase: "Pending"));
+        _azureDevOps.Agents.AddRange(new[]
+        {
+            new Agent { Id = 1, Name = "pool-agent-0", Status = "offline", StatusChangedOn = DateTime.UtcNow.AddMinutes(-10) },
+            new Agent { Id = 2, Name = "pool-agent-1", Status = "offline", StatusChangedOn = DateTime.UtcNow.AddSeconds(-10) },
+            new Agent { Id = 3, Name = "pool-agent-2", Status = "online", StatusChangedOn = DateTime.UtcNow.AddMinutes(-10) },
+            new Agent { Id = 4, Name = "pool-agent-3", Status = "offline", StatusChangedOn = DateTime.UtcNow.AddMinutes(-10) },
+            new Agent { Id = 5, Name = "build-vm-01", Status = "offline", StatusChangedOn = DateTime.UtcNow.AddDays(-1) },
+            new Agent { Id = 6, Name = "pool-agent-5", Status = "offline", LastActive = DateTime.UtcNow.AddHours(-2) }
+        });
+
+        await PollAsync(pool);
+
+        Assert.Contains(nameof(IAzureDevOpsService.GetOfflineAgentsOlderThanAsync), _azureDevOps.Calls);
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-5" }, _azureDevOps.UnregisteredAgents.OrderBy(n => n));
+    }
+
+    [Fact]
+    public async Task Poll_UnregistersAnOrphanedAgentAndKeepsTheHealthyOne()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 1));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, isMinAgent: true));
+        _azureDevOps.Agents.AddRange(new[]
+        {
+            new Agent { Id = 1, Name = "pool-agent-0", Status = "online" },
+            new Agent { Id = 2, Name = "pool-agent-1", Status = "offline", StatusChangedOn = DateTime.UtcNow.AddMinutes(-10) }
+        });
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-1" }, _azureDevOps.UnregisteredAgents);
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.Agents.Select(a => a.Name));
+        Assert.Contains(_events, e => e.Reason == "AgentDeleted" && e.Message.Contains("orphaned agent pool-agent-1"));
+    }
+
+    [Fact]
+    public async Task Poll_SurfacesAStuckJobRequestOnceWhenCancelingFails()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.StuckJobTimeoutSeconds = 60));
+        _azureDevOps.CancelSucceeds = false;
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            QueueTime = DateTime.UtcNow.AddMinutes(-10),
+            AssignTime = DateTime.UtcNow.AddMinutes(-10),
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+        });
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+
+        await _pollingService.PollSinglePool(pollInfo);
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(new[] { 42 }, _azureDevOps.CanceledRequests);
+        Assert.Single(_events, e => e.Reason == "StuckJobDetected" && e.Type == EventType.Warning);
+        Assert.DoesNotContain(_events, e => e.Reason == "StuckJobCanceled");
+    }
+
+    [Fact]
+    public async Task Poll_CancelsAStuckJobRequest()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.StuckJobTimeoutSeconds = 60));
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            QueueTime = DateTime.UtcNow.AddMinutes(-10),
+            AssignTime = DateTime.UtcNow.AddMinutes(-10),
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+        });
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { 42 }, _azureDevOps.CanceledRequests);
+        Assert.Contains(_events, e => e.Reason == "StuckJobCanceled");
+    }
+
+    [Fact]
+    public async Task Poll_CountsPodsFromBeforeARestartInsteadOfCreatingMore()
+    {
+        // A fresh polling service is what the operator starts with after a restart
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 2));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, isMinAgent: true));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 1, isMinAgent: true));
+
+        await PollAsync(pool);
+
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-1" }, _kubernetes.List<V1Pod>().Select(p => p.Metadata.Name).OrderBy(n => n));
+    }
+
+    [Theory]
+    [InlineData(15, false, 15)]
+    [InlineData(30, false, 30)]
+    [InlineData(30, true, 5)]
+    public void EffectivePollSeconds_FollowsThePollIntervalUnlessScaleUpIsPending(int pollIntervalSeconds, bool scaleUpPending, int expected)
+    {
+        var pollInfo = new PoolPollInfo { PollIntervalSeconds = pollIntervalSeconds, ScaleUpPending = scaleUpPending };
+
+        Assert.Equal(expected, AzureDevOpsPollingService.GetEffectivePollSeconds(pollInfo));
+    }
+
+    [Theory]
+    [InlineData(30, 1, false, 30)]
+    [InlineData(30, 2, false, 60)]
+    [InlineData(30, 3, true, 120)]
+    [InlineData(30, 10, false, 600)]
+    [InlineData(900, 3, false, 900)]
+    public void EffectivePollSeconds_BacksOffExponentiallyWhilePollsFail(int pollIntervalSeconds, int consecutiveFailures, bool scaleUpPending, int expected)
+    {
+        var pollInfo = new PoolPollInfo
+        {
+            PollIntervalSeconds = pollIntervalSeconds,
+            ConsecutiveFailures = consecutiveFailures,
+            ScaleUpPending = scaleUpPending
+        };
+
+        Assert.Equal(expected, AzureDevOpsPollingService.GetEffectivePollSeconds(pollInfo));
+    }
+
+    [Fact]
+    public async Task Poll_CountsConsecutiveFailuresAndResetsThemOnSuccess()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _azureDevOps.GetPoolFailure = new HttpRequestException("Service Unavailable");
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+
+        await _pollingService.PollSinglePool(pollInfo);
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(2, pollInfo.ConsecutiveFailures);
+        await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.ConsecutiveFailures == 2);
+
+        _azureDevOps.GetPoolFailure = null;
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(0, pollInfo.ConsecutiveFailures);
+    }
+
+    [Fact]
+    public async Task Poll_CountsARejectedJobListAsAFailureEvenWithThePoolCached()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        var patRevoked = false;
+        var handler = new StubHttpHandler(request =>
+        {
+            var path = request.RequestUri!.AbsolutePath;
+            if (path.EndsWith("/jobrequests"))
+            {
+                // The sign-in page Azure DevOps answers a revoked PAT with
+                return patRevoked
+                    ? new HttpResponseMessage(HttpStatusCode.NonAuthoritativeInformation)
+                    : StubHttpHandler.List(new object[]
+                    {
+                        new { requestId = 42, queueTime = DateTime.UtcNow, assignTime = DateTime.UtcNow, reservedAgent = new { id = 1, name = "pool-agent-0" } }
+                    });
+            }
+
+            if (path.EndsWith("/agents"))
+            {
+                return StubHttpHandler.List(new object[] { new { id = 1, name = "pool-agent-0", status = "online" } });
+            }
+
+            var selfHosted = new { id = 1, name = "self-hosted", poolType = "automation", size = 1 };
+            return path.EndsWith("/pools") ? StubHttpHandler.List(new object[] { selfHosted }) : StubHttpHandler.Json(selfHosted);
+        });
+        var pollingService = CreatePollingService(new AzureDevOpsService(new HttpClient(handler), NullLogger<AzureDevOpsService>.Instance,
+            new AzureDevOpsPoolCache(), new FakeHostApplicationLifetime()));
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+        await pollingService.PollSinglePool(pollInfo);
+
+        patRevoked = true;
+        await pollingService.PollSinglePool(pollInfo);
+        await pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(2, pollInfo.ConsecutiveFailures);
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0"));
+        Assert.Equal(0, _kubernetes.CountRequests("DELETE", "/pods"));
+        // The failure dropped the cached pool, so the third poll looked it up again
+        Assert.Equal(2, handler.Requests.Count(r => r.Uri.AbsolutePath.EndsWith("/pools")));
+    }
+
+    [Fact]
+    public async Task Poll_LeavesIdleAgentsAloneWhenListingFails()
+    {
+        var pool = AddIdleAgent();
+        _azureDevOps.ListFailure = new AzureDevOpsRequestException("Failed to get agents for pool 'self-hosted' from Azure DevOps");
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(1, pollInfo.ConsecutiveFailures);
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0"));
+        Assert.Empty(_azureDevOps.DisabledAgents);
+        Assert.Contains(_events, e => e.Reason == "PollFailed");
+    }
+
+    [Fact]
+    public async Task PollAll_WaitsForThePollIntervalBeforePollingAgain()
+    {
+        _pollingService.RegisterPool(_kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.PollIntervalSeconds = 15)), "pat");
+
+        await _pollingService.PollAllRegisteredPools();
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.Single(_azureDevOps.Calls, call => call == nameof(IAzureDevOpsService.GetPoolAsync));
+    }
+
+    [Theory]
+    [InlineData(null, "pool-agent-0", true)]
+    [InlineData(null, "pool-agent-warm", false)]
+    [InlineData("team-a-ci", "team-a-ci-agent-3", true)]
+    [InlineData("team-a-ci", "pool-agent-0", false)]
+    [InlineData("team-a-ci", "team-b-ci-agent-0", false)]
+    public void IsOperatorManagedAgent_MatchesTheAgentNamePrefix(string? agentNamePrefix, string agentName, bool expected)
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.AgentNamePrefix = agentNamePrefix);
+
+        Assert.Equal(expected, AzureDevOpsPollingService.IsOperatorManagedAgent(agentName, pool));
+    }
+
+    [Fact]
+    public async Task PollAll_StopsPollingAnUnregisteredPool()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _pollingService.RegisterPool(pool, "pat");
+        await _pollingService.PollAllRegisteredPools();
+        await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        var callsWhileRegistered = _azureDevOps.Calls.Count;
+
+        _pollingService.UnregisterPool(pool);
+        _pollingService.RequestPoll("default", "pool");
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.True(callsWhileRegistered > 0);
+        Assert.False(_pollingService.IsRegistered(pool));
+        Assert.Equal(callsWhileRegistered, _azureDevOps.Calls.Count);
+        Assert.DoesNotContain("azdo_runner_online_agents{namespace=\"default\",pool=\"pool\"}", _metrics.Render());
+    }
+
+    [Fact]
+    public async Task Poll_RecordsTheCanonicalPoolNameAndOrganizationInStatus()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.Pool = "Self-Hosted"));
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.PoolName != string.Empty);
+        Assert.Equal("self-hosted", updated.Status.PoolName);
+        Assert.Equal("myorg", updated.Status.OrganizationName);
+    }
+
+    [Fact]
+    public async Task Poll_WritesOnlineAgentsAndQueuedJobsToTheStatusSubresource()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 1));
+        _azureDevOps.Agents.AddRange(new[]
+        {
+            new Agent { Id = 1, Name = "pool-agent-0", Status = "online" },
+            new Agent { Id = 2, Name = "pool-agent-1", Status = "online" },
+            new Agent { Id = 3, Name = "build-vm-01", Status = "online" }
+        });
+        _azureDevOps.JobRequests.AddRange(new[]
+        {
+            new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow },
+            new JobRequest { RequestId = 2, QueueTime = DateTime.UtcNow }
+        });
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(2, updated.Status.OnlineAgents);
+        Assert.Equal(2, updated.Status.QueuedJobs);
+        Assert.True(_kubernetes.CountRequests("PUT", "/runnerpools/pool/status") > 0);
+    }
+
+    [Fact]
+    public async Task Poll_FlagsAgentsBehindTheNewestVersionOrWithAPendingUpdate()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        for (var i = 0; i < 3; i++)
+        {
+            _kubernetes.Add(TestEntities.CreateAgentPod(pool, i, createdAt: DateTime.UtcNow));
+        }
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online", Version = "4.255.0", LastActive = DateTime.UtcNow });
+        _azureDevOps.Agents.Add(new Agent { Id = 2, Name = "pool-agent-1", Status = "online", Version = "4.248.0", LastActive = DateTime.UtcNow });
+        _azureDevOps.Agents.Add(new Agent
+        {
+            Id = 3,
+            Name = "pool-agent-2",
+            Status = "online",
+            Version = "4.255.0",
+            LastActive = DateTime.UtcNow,
+            PendingUpdate = new AgentPendingUpdate { RequestTime = DateTime.UtcNow }
+        });
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(2, updated.Status.OutdatedAgents);
+        var condition = updated.Status.Conditions.Single(c => c.Type == "AgentUpdateRequired");
+        Assert.Equal("True", condition.Status);
+        Assert.Contains("2 agents are older than 4.255.0 or have an update pending", condition.Message);
+        Assert.Contains("pool-agent-1 (4.248.0)", condition.Message);
+        Assert.Contains("pool-agent-2 (4.255.0)", condition.Message);
+    }
+
+    [Fact]
+    public async Task Poll_ReportsAgentsOnTheSameVersionAsUpToDate()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, createdAt: DateTime.UtcNow));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 1, createdAt: DateTime.UtcNow));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online", Version = "4.255.0", LastActive = DateTime.UtcNow });
+        _azureDevOps.Agents.Add(new Agent { Id = 2, Name = "pool-agent-1", Status = "online", Version = "4.255.0", LastActive = DateTime.UtcNow });
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(0, updated.Status.OutdatedAgents);
+        Assert.Equal("UpToDate", updated.Status.Conditions.Single(c => c.Type == "AgentUpdateRequired").Reason);
+    }
+
+    [Fact]
+    public async Task Poll_RecreatesMinimumAgentsAndRemovesIdleOnesOnAnOldImageAtMostMaxSurgeAtATime()
+    {
+        var pool = AddAgentsOnAnOldImage("RollingRecreate");
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-1" }, _azureDevOps.DisabledAgents);
+        var pods = _kubernetes.List<V1Pod>();
+        Assert.Equal(2, pods.Count);
+        var replacement = Assert.Single(pods, p => p.Spec.Containers.Single().Image == "registry.example.com/agent:2");
+        Assert.Equal("true", replacement.Metadata.Labels["min-agent"]);
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-2"));
+        Assert.Contains(_events, e => e.Reason == "AgentsRecreated" &&
+                                      e.Message.Contains("Recreated 1 minimum agents") && e.Message.Contains("removed 1 idle agents"));
+    }
+
+    [Fact]
+    public async Task Poll_LeavesAnAgentRunningAJobOnTheOldImage()
+    {
+        var pool = AddAgentsOnAnOldImage("RollingRecreate");
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            AgentId = 1,
+            QueueTime = DateTime.UtcNow,
+            AssignTime = DateTime.UtcNow,
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+        });
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-1", "pool-agent-2" }, _azureDevOps.DisabledAgents);
+        Assert.Equal("registry.example.com/agent:1", _kubernetes.Get<V1Pod>("pool-agent-0")!.Spec.Containers.Single().Image);
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+    }
+
+    [Fact]
+    public async Task Poll_NeverForceDeletesAnAgentThatPickedUpAJobDuringAnImageUpdate()
+    {
+        var pool = AddAgentsOnAnOldImage("RollingRecreate");
+        pool.Spec.DrainTimeoutSeconds = 0;
+        AssignJobWhenDrainStarts();
+
+        await PollAsync(pool);
+
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0"));
+        Assert.Equal(new[] { "pool-agent-1" }, _azureDevOps.UnregisteredAgents);
+        Assert.DoesNotContain(_events, e => e.Reason == "DrainTimeout");
+    }
+
+    [Fact]
+    public async Task Poll_LeavesAgentsOnTheOldImageWithOnDelete()
+    {
+        var pool = AddAgentsOnAnOldImage("OnDelete");
+
+        await PollAsync(pool);
+
+        Assert.All(_kubernetes.List<V1Pod>(), p => Assert.Equal("registry.example.com/agent:1", p.Spec.Containers.Single().Image));
+        Assert.Empty(_azureDevOps.DisabledAgents);
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(3, updated.Status.OutdatedPods);
+        Assert.NotEqual("Updating", updated.Status.Conditions.Single(c => c.Type == "Progressing").Reason);
+    }
+
+    [Fact]
+    public async Task Poll_NeitherCreatesNorDeletesPodsWhilePaused()
+    {
+        var pool = AddIdleAgent();
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default",
+            p => p.Metadata.Annotations = new Dictionary<string, string> { [AzureDevOpsPollingService.PausedAnnotation] = "true" });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.True(pollInfo.Paused);
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+        Assert.Equal(0, _kubernetes.CountRequests("DELETE", "/pods"));
+        Assert.Empty(_azureDevOps.Calls);
+        var updated = _kubernetes.Get<V1AzDORunnerEntity>("pool")!;
+        Assert.Equal("True", updated.Status.Conditions.Single(c => c.Type == "Paused").Status);
+        Assert.Equal("Paused", updated.Status.Conditions.Single(c => c.Type == "Progressing").Reason);
+    }
+
+    [Fact]
+    public async Task Poll_ScalesAgainOnceThePausedAnnotationIsRemoved()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default",
+            p => p.Metadata.Annotations = new Dictionary<string, string> { [AzureDevOpsPollingService.PausedAnnotation] = "true" });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+        await _pollingService.PollSinglePool(pollInfo);
+
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default", p => p.Metadata.Annotations.Remove(AzureDevOpsPollingService.PausedAnnotation));
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.False(pollInfo.Paused);
+        Assert.Equal(1, _kubernetes.CountRequests("POST", "/pods"));
+        await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool",
+            p => p.Status.Conditions.Any(c => c.Type == "Paused" && c.Status == "False" && c.Reason == "Resumed"));
+    }
+
+    [Fact]
+    public async Task Poll_ColdStartsFromZeroAgentsAndPollsAgainSoon()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 2, QueueTime = DateTime.UtcNow });
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat", PollIntervalSeconds = 30 };
+
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(2, _kubernetes.CountRequests("POST", "/pods"));
+        Assert.True(pollInfo.ScaleUpPending);
+        Assert.Equal(5, AzureDevOpsPollingService.GetEffectivePollSeconds(pollInfo));
+    }
+
+    [Fact]
+    public async Task Poll_DrainsAnIdlePoolToZeroAndReportsIt()
+    {
+        var pool = AddIdleAgent();
+
+        await PollAsync(pool);
+        Assert.Null(_kubernetes.Get<V1Pod>("pool-agent-0"));
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool",
+            p => p.Status.Conditions.Any(c => c.Type == "Progressing" && c.Reason == "ScaledToZero"));
+        Assert.Equal(0, updated.Status.RunningAgents);
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+    }
+
+    [Fact]
+    public async Task Poll_ReportsARunningPodWhoseAgentIsStillOfflineAsWarming()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        // Still in its registration grace period, the agent inside hasn't come online yet
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, createdAt: DateTime.UtcNow));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "offline", StatusChangedOn = DateTime.UtcNow });
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(1, updated.Status.WarmingAgents);
+        var progressing = updated.Status.Conditions.Single(c => c.Type == "Progressing");
+        Assert.Equal("True", progressing.Status);
+        Assert.Contains("1 agents not online yet", progressing.Message);
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0"));
+    }
+
+    [Fact]
+    public async Task Poll_CountsAnAgentStillComingOnlineTowardsTheQueuedJobs()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, createdAt: DateTime.UtcNow));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "offline", StatusChangedOn = DateTime.UtcNow });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 2, QueueTime = DateTime.UtcNow });
+
+        await PollAsync(pool);
+
+        // The warming agent takes one of the jobs once it registers, only the other one needs a new pod
+        Assert.Equal(1, _kubernetes.CountRequests("POST", "/pods"));
+
+        await PollAsync(pool);
+
+        Assert.Equal(1, _kubernetes.CountRequests("POST", "/pods"));
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0"));
+    }
+
+    [Fact]
+    public async Task Poll_RecordsDesiredAgentsAndTheScaleTimeWhenCreatingPods()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 2, QueueTime = DateTime.UtcNow });
+        var before = DateTime.UtcNow.AddSeconds(-1);
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(2, updated.Status.DesiredAgents);
+        Assert.True(updated.Status.LastScaleTime >= before);
+    }
+
+    [Fact]
+    public async Task Poll_LeavesTheScaleTimeAloneWhenNothingChanges()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 1));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0, isMinAgent: true));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(1, updated.Status.DesiredAgents);
+        Assert.Equal(1, updated.Status.CurrentAgents);
+        Assert.Null(updated.Status.LastScaleTime);
+    }
+
+    [Fact]
+    public async Task Poll_CountsQueuedAndRunningJobsSeparately()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MaxAgents = 1));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+        _azureDevOps.JobRequests.AddRange(new[]
+        {
+            new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow },
+            new JobRequest { RequestId = 2, QueueTime = DateTime.UtcNow },
+            new JobRequest
+            {
+                RequestId = 3,
+                QueueTime = DateTime.UtcNow.AddMinutes(-5),
+                AssignTime = DateTime.UtcNow.AddMinutes(-5),
+                ReceiveTime = DateTime.UtcNow.AddMinutes(-5),
+                ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+            },
+            new JobRequest
+            {
+                RequestId = 4,
+                QueueTime = DateTime.UtcNow.AddMinutes(-10),
+                AssignTime = DateTime.UtcNow.AddMinutes(-10),
+                FinishTime = DateTime.UtcNow.AddMinutes(-6),
+                Result = "succeeded",
+                ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+            }
+        });
+
+        await PollAsync(pool);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(2, updated.Status.QueuedJobs);
+        Assert.Equal(1, updated.Status.RunningJobs);
+    }
+
+    [Fact]
+    public async Task Poll_CountsCreatedPodsInTheMetrics()
+    {
+        await PollAsync(_kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 2)));
+
+        Assert.Contains("azdo_runner_pods_created_total{namespace=\"default\",pool=\"pool\"} 2\n", _metrics.Render());
+    }
+
+    [Fact]
+    public async Task Poll_PublishesThePoolGauges()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+
+        await PollAsync(pool);
+        await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+
+        var metrics = _metrics.Render();
+        Assert.Contains("azdo_runner_online_agents{namespace=\"default\",pool=\"pool\"} 1\n", metrics);
+        Assert.Contains("azdo_runner_queued_jobs{namespace=\"default\",pool=\"pool\"} 1\n", metrics);
+        Assert.Contains("azdo_runner_active_pods{namespace=\"default\",pool=\"pool\"} 1\n", metrics);
+    }
+
+    [Fact]
+    public async Task Poll_PublishesPollFailedWhenThePoolIsMissing()
+    {
+        await PollAsync(_kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.Pool = "missing")));
+
+        var pollFailed = Assert.Single(_events, e => e.Reason == "PollFailed");
+        Assert.Equal(EventType.Warning, pollFailed.Type);
+        Assert.Contains("'missing' not found", pollFailed.Message);
+    }
+
+    [Fact]
+    public async Task Poll_RefusesToScaleADeploymentPool()
+    {
+        _azureDevOps.Pools[0].PoolType = "deployment";
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 1));
+
+        await PollAsync(pool);
+
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+        var pollFailed = Assert.Single(_events, e => e.Reason == "PollFailed");
+        Assert.Contains("is a deployment pool, but the RunnerPool expects PoolType 'automation'", pollFailed.Message);
+    }
+
+    [Fact]
+    public async Task Poll_PublishesScaledUpWhenCreatingAgentsForQueuedJobs()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+
+        await PollAsync(pool);
+
+        Assert.Contains(_events, e => e.Reason == "ScaledUp" && e.Type == EventType.Normal);
+        Assert.Equal(1, _kubernetes.CountRequests("POST", "/pods"));
+    }
+
+    [Fact]
+    public async Task Poll_CreatesTheMinimumAgentsForAFreshPool()
+    {
+        await PollAsync(_kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 2)));
+
+        var pods = _kubernetes.List<V1Pod>();
+        Assert.Equal(2, pods.Count);
+        Assert.All(pods, pod => Assert.Equal("true", pod.Metadata.Labels["min-agent"]));
+    }
+
+    [Fact]
+    public async Task Poll_KeepsMinimumAgentsUnderMaxAgentsWhileRegularAgentsAreBusy()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.MinAgents = 2;
+            spec.MaxAgents = 2;
+        }));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            AgentId = 1,
+            QueueTime = DateTime.UtcNow.AddMinutes(-1),
+            AssignTime = DateTime.UtcNow.AddMinutes(-1),
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+        });
+
+        await PollAsync(pool);
+
+        Assert.Equal(2, _kubernetes.List<V1Pod>().Count);
+        Assert.Single(_kubernetes.List<V1Pod>(), pod => pod.Metadata.Labels["min-agent"] == "true");
+        Assert.Contains(_events, e => e.Reason == "ScaledUp" && e.Message.Contains("(0 -> 1 of 2)"));
+    }
+
+    [Theory]
+    [InlineData(10, 3, 3, true)]
+    [InlineData(2, 3, 2, false)]
+    public async Task Poll_CreatesAtMostMaxSurgePodsAndRequeuesForTheRest(int queuedJobs, int maxSurge, int expectedPods, bool expectedPending)
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.MaxAgents = 20;
+            spec.MaxSurge = maxSurge;
+        }));
+        _azureDevOps.JobRequests.AddRange(Enumerable.Range(1, queuedJobs)
+            .Select(i => new JobRequest { RequestId = i, QueueTime = DateTime.UtcNow }));
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat", PollIntervalSeconds = 30 };
+
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(expectedPods, _kubernetes.CountRequests("POST", "/pods"));
+        Assert.Equal(expectedPending, pollInfo.ScaleUpPending);
+    }
+
+    [Theory]
+    [InlineData(20, 3)]
+    [InlineData(2, 2)]
+    public async Task Poll_StartsOneAgentPerBatchOfJobsPerAgentQueuedJobs(int maxAgents, int expectedAgents)
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.MaxAgents = maxAgents;
+            spec.MaxSurge = 10;
+            spec.JobsPerAgent = 4;
+        }));
+        _azureDevOps.JobRequests.AddRange(Enumerable.Range(1, 10)
+            .Select(i => new JobRequest { RequestId = i, QueueTime = DateTime.UtcNow }));
+
+        await PollAsync(pool);
+
+        Assert.Equal(expectedAgents, _kubernetes.CountRequests("POST", "/pods"));
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastPolled != null);
+        Assert.Equal(expectedAgents, updated.Status.DesiredAgents);
+    }
+
+    [Theory]
+    [InlineData("java")]
+    [InlineData("java -equals true")]
+    [InlineData("java -gtVersion 17")]
+    public async Task Poll_PicksTheCapabilityImageByDemandName(string demand)
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.CapabilityAware = true;
+            spec.CapabilityImages = new Dictionary<string, string> { ["java"] = "registry.example.com/agent-java:1.0" };
+        }));
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow, Demands = new List<string> { demand } });
+
+        await PollAsync(pool);
+
+        var pod = Assert.Single(_kubernetes.List<V1Pod>());
+        Assert.Equal("java", pod.Metadata.Labels["capability"]);
+        Assert.Equal("registry.example.com/agent-java:1.0", pod.Spec.Containers.Single().Image);
+    }
+
+    [Fact]
+    public async Task Poll_KeepsTheCapabilityMinimumWarmWithoutQueuedJobs()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.CapabilityAware = true;
+            spec.CapabilityImages = new Dictionary<string, string> { ["java"] = "registry.example.com/agent-java:1.0" };
+            spec.CapabilityScaling = new Dictionary<string, V1AzDORunnerEntity.CapabilityScalingSpec>
+            {
+                ["java"] = new() { MinAgents = 1 }
+            };
+        }));
+
+        await PollAsync(pool);
+
+        var pod = Assert.Single(_kubernetes.List<V1Pod>());
+        Assert.Equal("java", pod.Metadata.Labels["capability"]);
+        Assert.Equal("registry.example.com/agent-java:1.0", pod.Spec.Containers.Single().Image);
+    }
+
+    [Fact]
+    public async Task Poll_StopsSpawningACapabilityAtItsMaximum()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.MaxAgents = 10;
+            spec.MaxSurge = 10;
+            spec.CapabilityAware = true;
+            spec.CapabilityImages = new Dictionary<string, string> { ["java"] = "registry.example.com/agent-java:1.0" };
+            spec.CapabilityScaling = new Dictionary<string, V1AzDORunnerEntity.CapabilityScalingSpec>
+            {
+                ["java"] = new() { MaxAgents = 2 }
+            };
+        }));
+        _azureDevOps.JobRequests.AddRange(Enumerable.Range(1, 4)
+            .Select(i => new JobRequest { RequestId = i, QueueTime = DateTime.UtcNow, Demands = new List<string> { "java" } }));
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 5, QueueTime = DateTime.UtcNow });
+
+        await PollAsync(pool);
+
+        var capabilities = _kubernetes.List<V1Pod>().Select(p => p.Metadata.Labels["capability"]).ToList();
+        Assert.Equal(2, capabilities.Count(c => c == "java"));
+        Assert.Equal(1, capabilities.Count(c => c == "base"));
+    }
+
+    [Fact]
+    public async Task Poll_RecreatesADeletedMinimumAgentPod()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 1));
+        await PollAsync(pool);
+        var minAgentPod = Assert.Single(_kubernetes.List<V1Pod>());
+
+        await _kubernetes.Client.CoreV1.DeleteNamespacedPodAsync(minAgentPod.Metadata.Name, "default");
+        await PollAsync(pool);
+
+        var recreated = Assert.Single(_kubernetes.List<V1Pod>());
+        Assert.Equal("true", recreated.Metadata.Labels["min-agent"]);
+        Assert.Equal(2, _kubernetes.CountRequests("POST", "/pods"));
+    }
+
+    [Fact]
+    public async Task Poll_LabelsThePodRunningAJobWithTheJobRequest()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online" });
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            QueueTime = DateTime.UtcNow.AddMinutes(-1),
+            AssignTime = DateTime.UtcNow.AddMinutes(-1),
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" },
+            Definition = new JobDefinition { Id = 5, Name = "Build & Test" }
+        });
+
+        await PollAsync(pool);
+
+        var labels = _kubernetes.Get<V1Pod>("pool-agent-0")!.Metadata.Labels;
+        Assert.Equal("42", labels["job-request-id"]);
+        Assert.Equal("Build---Test", labels["job-definition"]);
+        Assert.Equal("pool", labels["runner-pool"]);
+    }
+
+    [Fact]
+    public async Task Poll_DrainsAnIdleAgentBeforeDeletingItsPod()
+    {
+        var pool = AddIdleAgent();
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.DisabledAgents);
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.UnregisteredAgents);
+        Assert.Null(_kubernetes.Get<V1Pod>("pool-agent-0"));
+        Assert.Contains(_events, e => e.Reason == "AgentDeleted");
+    }
+
+    [Fact]
+    public async Task Poll_WaitsForAJobAssignedWhileDraining()
+    {
+        var pool = AddIdleAgent(drainTimeoutSeconds: 600);
+        AssignJobWhenDrainStarts();
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.DisabledAgents);
+        Assert.Empty(_azureDevOps.UnregisteredAgents);
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0")!.Metadata.Annotations["azdo.opentools.mf/drain-started"]);
+    }
+
+    [Fact]
+    public async Task Poll_ForceDeletesAnAgentStillBusyAfterTheDrainTimeout()
+    {
+        var pool = AddIdleAgent(drainTimeoutSeconds: 0);
+        AssignJobWhenDrainStarts();
+
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.UnregisteredAgents);
+        Assert.Null(_kubernetes.Get<V1Pod>("pool-agent-0"));
+        Assert.Contains(_events, e => e.Reason == "DrainTimeout" && e.Type == EventType.Warning);
+    }
+
+    [Fact]
+    public async Task Poll_RetriesTheDrainWhenDisablingTheAgentFails()
+    {
+        var pool = AddIdleAgent();
+        _azureDevOps.SetAgentEnabledSucceeds = false;
+
+        await PollAsync(pool);
+
+        var pod = _kubernetes.Get<V1Pod>("pool-agent-0");
+        Assert.NotNull(pod);
+        Assert.False(pod.Metadata.Annotations?.ContainsKey("azdo.opentools.mf/drain-started") ?? false);
+        Assert.Empty(_azureDevOps.UnregisteredAgents);
+
+        _azureDevOps.SetAgentEnabledSucceeds = true;
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-0" }, _azureDevOps.DisabledAgents);
+        Assert.Null(_kubernetes.Get<V1Pod>("pool-agent-0"));
+    }
+
+    [Fact]
+    public async Task Poll_ReenablesAnAgentWhoseDrainWasCalledOff()
+    {
+        var pool = AddIdleAgent(scaleDownStabilizationSeconds: 300);
+        AssignJobWhenDrainStarts();
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+        await _pollingService.PollSinglePool(pollInfo);
+
+        // The job finished and new work showed up, so the idle agent is wanted again
+        _kubernetes.Intercept = null;
+        _azureDevOps.JobRequests.Clear();
+        pollInfo.LastDemandTime = DateTime.UtcNow;
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(new[] { "pool-agent-0" }, _azureDevOps.EnabledAgents);
+        Assert.Empty(_azureDevOps.UnregisteredAgents);
+        var pod = _kubernetes.Get<V1Pod>("pool-agent-0")!;
+        Assert.False(pod.Metadata.Annotations.ContainsKey("azdo.opentools.mf/drain-started"));
+    }
+
+    [Fact]
+    public async Task Poll_KeepsADrainWaitingOnItsLastJob()
+    {
+        var pool = AddIdleAgent();
+        AssignJobWhenDrainStarts();
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+
+        await _pollingService.PollSinglePool(pollInfo);
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Empty(_azureDevOps.EnabledAgents);
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0")!.Metadata.Annotations["azdo.opentools.mf/drain-started"]);
+    }
+
+    [Fact]
+    public async Task UnregisterPool_ForgetsItsDrainsSoAPoolCreatedAgainDisablesItsAgents()
+    {
+        var pool = AddIdleAgent();
+        AssignJobWhenDrainStarts();
+        await PollAsync(pool);
+
+        // The RunnerPool is deleted and created again, its new pod reuses the old name
+        _pollingService.UnregisterPool(pool);
+        _kubernetes.Intercept = null;
+        _azureDevOps.JobRequests.Clear();
+        await _kubernetes.Client.CoreV1.DeleteNamespacedPodAsync("pool-agent-0", "default");
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        await PollAsync(pool);
+
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-0" }, _azureDevOps.DisabledAgents);
+        Assert.Null(_kubernetes.Get<V1Pod>("pool-agent-0"));
+    }
+
+    [Theory]
+    [InlineData(60, false)]
+    [InlineData(600, true)]
+    public async Task Poll_KeepsIdleAgentsUntilTheStabilizationWindowHasPassed(int secondsSinceDemand, bool expectRemoved)
+    {
+        var pool = AddIdleAgent(scaleDownStabilizationSeconds: 300);
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat", LastDemandTime = DateTime.UtcNow.AddSeconds(-secondsSinceDemand) };
+
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.Equal(expectRemoved, _kubernetes.Get<V1Pod>("pool-agent-0") == null);
+        Assert.Equal(expectRemoved, _azureDevOps.UnregisteredAgents.Contains("pool-agent-0"));
+    }
+
+    [Fact]
+    public async Task Poll_RecordsTheLastDemandTimeWhenJobsAreQueued()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        var pollInfo = new PoolPollInfo { Entity = pool, Pat = "pat" };
+        var before = DateTime.UtcNow;
+
+        await _pollingService.PollSinglePool(pollInfo);
+
+        Assert.True(pollInfo.LastDemandTime >= before);
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.LastDemandTime != null);
+        Assert.True(updated.Status.LastDemandTime >= before.AddSeconds(-1));
+    }
+
+    [Fact]
+    public async Task Poll_InDryRunReportsTheIntendedScaleUpWithoutCreatingPods()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.Mode = "DryRun";
+            spec.MinAgents = 1;
+        }));
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 2, QueueTime = DateTime.UtcNow });
+
+        await PollAsync(pool);
+
+        Assert.Equal(0, _kubernetes.CountRequests("POST", "/pods"));
+        var dryRun = Assert.Single(_events, e => e.Reason == "DryRun");
+        Assert.Contains("would create 2 agent pods (0 -> 2) for 2 queued and 0 running jobs", dryRun.Message);
+    }
+
+    [Fact]
+    public async Task Poll_InDryRunLeavesIdleAgentsAlone()
+    {
+        AddIdleAgent();
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default", p => p.Spec.Mode = "DryRun");
+
+        await PollAsync(_kubernetes.Get<V1AzDORunnerEntity>("pool")!);
+
+        Assert.NotNull(_kubernetes.Get<V1Pod>("pool-agent-0"));
+        Assert.Empty(_azureDevOps.DisabledAgents);
+        Assert.Empty(_azureDevOps.UnregisteredAgents);
+        Assert.Contains(_events, e => e.Reason == "DryRun" && e.Message.Contains("would remove 1 agent pods (1 -> 0)"));
+    }
+
+    private V1AzDORunnerEntity AddIdleAgent(int drainTimeoutSeconds = 600, int scaleDownStabilizationSeconds = 0)
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.DrainTimeoutSeconds = drainTimeoutSeconds;
+            spec.ScaleDownStabilizationSeconds = scaleDownStabilizationSeconds;
+        }));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _azureDevOps.Agents.Add(new Agent { Id = 1, Name = "pool-agent-0", Status = "online", LastActive = DateTime.UtcNow.AddHours(-1) });
+        return pool;
+    }
+
+    private V1AzDORunnerEntity AddAgentsOnAnOldImage(string updateStrategy)
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.Image = "registry.example.com/agent:2";
+            spec.UpdateStrategy = updateStrategy;
+            spec.MaxSurge = 2;
+            spec.MinAgents = 1;
+        }));
+        for (var i = 0; i < 3; i++)
+        {
+            // Started before the image was bumped, and still within their registration grace period.
+            // The oldest one is the pool's minimum agent
+            var pod = TestEntities.CreateAgentPod(pool, i, isMinAgent: i == 0, createdAt: DateTime.UtcNow.AddSeconds(i - 3));
+            pod.Spec.Containers.Single().Image = "registry.example.com/agent:1";
+            _kubernetes.Add(pod);
+            _azureDevOps.Agents.Add(new Agent { Id = i + 1, Name = pod.Metadata.Name, Status = "online", LastActive = DateTime.UtcNow });
+        }
+
+        return pool;
+    }
+
+    private void AssignJobWhenDrainStarts()
+    {
+        // Azure DevOps hands the agent a job right before it is disabled
+        _kubernetes.Intercept = request =>
+        {
+            if (request.Method == "PUT" && request.Body?.Contains("drain-started") == true && _azureDevOps.JobRequests.Count == 0)
+            {
+                _azureDevOps.JobRequests.Add(new JobRequest
+                {
+                    RequestId = 42,
+                    AgentId = 1,
+                    QueueTime = DateTime.UtcNow,
+                    AssignTime = DateTime.UtcNow,
+                    ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+                });
+            }
+
+            return null;
+        };
+    }
+
+    private AzureDevOpsPollingService CreatePollingService(IAzureDevOpsService azureDevOps)
+    {
+        EventPublisher eventPublisher = (_, reason, message, type, _) =>
+        {
+            lock (_events)
+            {
+                _events.Add((reason, message, type));
+            }
+
+            return Task.CompletedTask;
+        };
+
+        return new AzureDevOpsPollingService(
+            NullLogger<AzureDevOpsPollingService>.Instance,
+            azureDevOps,
+            new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, _metrics),
+            _kubernetes.Client,
+            new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance),
+            _metrics,
+            eventPublisher,
+            new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client));
+    }
+
+    private Task PollAsync(V1AzDORunnerEntity entity)
+    {
+        return _pollingService.PollSinglePool(new PoolPollInfo { Entity = entity, Pat = "pat" });
+    }
+}
+
+[Collection(EnvironmentCollection.Name)]
+public class AzureDevOpsPollingServiceLeaderElectionTests
+{
+    [Theory]
+    [InlineData("true", 0)]
+    [InlineData(null, 2)]
+    public async Task PollAll_CreatesPodsOnlyOnTheLeader(string? leaderElection, int expectedPods)
+    {
+        using var _ = new EnvironmentVariableScope(("LEADER_ELECTION", leaderElection));
+        var kubernetes = new FakeKubernetes();
+        var azureDevOps = new FakeAzureDevOpsService();
+        var metrics = new OperatorMetrics();
+        var leader = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, kubernetes.Client);
+        var pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, azureDevOps,
+            new KubernetesPodService(kubernetes.Client, NullLogger<KubernetesPodService>.Instance, metrics), kubernetes.Client,
+            new RunnerPoolStatusService(kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance), metrics,
+            (_, _, _, _, _) => Task.CompletedTask, leader);
+        pollingService.RegisterPool(kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.MinAgents = 2)), "pat");
+
+        await pollingService.PollAllRegisteredPools();
+
+        Assert.Equal(expectedPods, kubernetes.List<V1Pod>().Count);
+        Assert.Equal(expectedPods > 0, leader.IsLeader);
+        Assert.Equal(leader.IsLeader, azureDevOps.Calls.Count > 0);
+    }
+}
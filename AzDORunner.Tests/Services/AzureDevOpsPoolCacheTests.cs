@@ -0,0 +1,83 @@
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+
+namespace AzDORunner.Tests.Services;
+
+public class AzureDevOpsPoolCacheTests
+{
+    private const string AzDoUrl = "https://dev.azure.com/myorg";
+
+    private readonly AzureDevOpsPoolCache _cache = new();
+
+    [Fact]
+    public void TryGet_HitsForTheSameOrganizationPoolAndPat()
+    {
+        _cache.Set(AzDoUrl, "self-hosted", "pat", new Pool { Id = 7, Name = "self-hosted" });
+
+        Assert.True(_cache.TryGet("https://dev.azure.com/MyOrg/", "Self-Hosted", "pat", out var pool));
+        Assert.Equal(7, pool.Id);
+    }
+
+    [Fact]
+    public void TryGet_MissesAfterThePatIsRotated()
+    {
+        _cache.Set(AzDoUrl, "self-hosted", "old-pat", new Pool { Id = 7, Name = "self-hosted" });
+
+        Assert.False(_cache.TryGet(AzDoUrl, "self-hosted", "new-pat", out _));
+    }
+
+    [Fact]
+    public void Evict_DropsThePoolForEveryPat()
+    {
+        _cache.Set(AzDoUrl, "self-hosted", "pat-a", new Pool { Id = 7, Name = "self-hosted" });
+        _cache.Set(AzDoUrl, "self-hosted", "pat-b", new Pool { Id = 7, Name = "self-hosted" });
+        _cache.Set(AzDoUrl, "other", "pat-a", new Pool { Id = 8, Name = "other" });
+
+        _cache.Evict(AzDoUrl, "self-hosted");
+
+        Assert.False(_cache.TryGet(AzDoUrl, "self-hosted", "pat-a", out _));
+        Assert.False(_cache.TryGet(AzDoUrl, "self-hosted", "pat-b", out _));
+        Assert.True(_cache.TryGet(AzDoUrl, "other", "pat-a", out _));
+    }
+
+    [Fact]
+    public async Task SetAndTryGet_AreSafeToCallConcurrently()
+    {
+        await Task.WhenAll(Enumerable.Range(0, 16).Select(worker => Task.Run(() =>
+        {
+            for (var i = 0; i < 500; i++)
+            {
+                var poolName = $"pool-{i % 10}";
+                _cache.Set(AzDoUrl, poolName, $"pat-{worker % 4}", new Pool { Id = i % 10, Name = poolName });
+                if (_cache.TryGet(AzDoUrl, poolName, $"pat-{worker % 4}", out var pool))
+                {
+                    Assert.Equal(poolName, pool.Name);
+                }
+
+                if (i % 50 == 0)
+                {
+                    _cache.Evict(AzDoUrl, poolName);
+                }
+            }
+        })));
+
+        _cache.Set(AzDoUrl, "pool-0", "pat-0", new Pool { Id = 0, Name = "pool-0" });
+        Assert.True(_cache.TryGet(AzDoUrl, "pool-0", "pat-0", out _));
+    }
+
+    [Fact]
+    public async Task GetPool_ReusesTheCachedLookup()
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } }));
+        var service = new AzureDevOpsService(new HttpClient(handler), NullLogger<AzureDevOpsService>.Instance, _cache,
+            new FakeHostApplicationLifetime());
+
+        await service.GetPoolAsync(AzDoUrl, "self-hosted", "pat");
+        var pool = await service.GetPoolAsync(AzDoUrl, "self-hosted", "pat");
+        await service.GetPoolAsync(AzDoUrl, "self-hosted", "rotated-pat");
+
+        Assert.Equal(7, pool!.Id);
+        Assert.Equal(2, handler.Requests.Count);
+    }
+}
@@ -0,0 +1,647 @@
+using System.Diagnostics;
+using System.Net;
+using System.Net.Http.Headers;
+using System.Net.Security;
+using System.Net.Sockets;
+using System.Security.Cryptography;
+using System.Security.Cryptography.X509Certificates;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+
+namespace AzDORunner.Tests.Services;
+
+public class AzureDevOpsServiceTests
+{
+    private const string AzDoUrl = "https://dev.azure.com/myorg";
+
+    [Fact]
+    public async Task LookupPool_FindsSelfHostedPool()
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(new object[]
+        {
+            new { id = 1, name = "Azure Pipelines", isHosted = true },
+            new { id = 7, name = "self-hosted", isHosted = false }
+        }));
+
+        var lookup = await CreateService(handler).LookupPoolAsync(AzDoUrl, "self-hosted", "pat", TimeSpan.FromSeconds(5), CancellationToken.None);
+
+        Assert.Equal(PoolLookupStatus.Found, lookup.Status);
+        Assert.Equal(7, lookup.Pool!.Id);
+    }
+
+    [Fact]
+    public async Task LookupPool_ReportsNotFoundOnlyWhenThePoolListHasNoMatch()
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(new object[] { new { id = 1, name = "other" } }));
+
+        var lookup = await CreateService(handler).LookupPoolAsync(AzDoUrl, "self-hosted", "pat", TimeSpan.FromSeconds(5), CancellationToken.None);
+
+        Assert.Equal(PoolLookupStatus.NotFound, lookup.Status);
+    }
+
+    [Fact]
+    public async Task ListPools_MapsIdNameHostingAndSize()
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(new object[]
+        {
+            new { id = 1, name = "Azure Pipelines", isHosted = true, size = 0, poolType = "automation" },
+            new { id = 7, name = "self-hosted", isHosted = false, size = 3, poolType = "automation" }
+        }));
+
+        var pools = await CreateService(handler).ListPoolsAsync(AzDoUrl, "pat");
+
+        Assert.Collection(pools,
+            hosted =>
+            {
+                Assert.Equal((1, "Azure Pipelines", true, 0), (hosted.Id, hosted.Name, hosted.IsHosted, hosted.Size));
+            },
+            selfHosted =>
+            {
+                Assert.Equal((7, "self-hosted", false, 3), (selfHosted.Id, selfHosted.Name, selfHosted.IsHosted, selfHosted.Size));
+            });
+    }
+
+    [Fact]
+    public async Task ListPools_ReturnsAnEmptyListWhenAzureDevOpsFails()
+    {
+        var handler = new StubHttpHandler(_ => new HttpResponseMessage(HttpStatusCode.Unauthorized));
+
+        var pools = await CreateService(handler).ListPoolsAsync(AzDoUrl, "pat");
+
+        Assert.Empty(pools);
+    }
+
+    [Theory]
+    [InlineData(HttpStatusCode.ServiceUnavailable)]
+    [InlineData(HttpStatusCode.TooManyRequests)]
+    [InlineData(HttpStatusCode.Unauthorized)]
+    [InlineData(HttpStatusCode.NonAuthoritativeInformation)]
+    public async Task LookupPool_MakesASingleAttemptAndReportsUnavailableOnFailure(HttpStatusCode statusCode)
+    {
+        var handler = new StubHttpHandler(_ => new HttpResponseMessage(statusCode) { Content = new StringContent("<html></html>") });
+
+        var lookup = await CreateService(handler).LookupPoolAsync(AzDoUrl, "self-hosted", "pat", TimeSpan.FromSeconds(5), CancellationToken.None);
+
+        Assert.Equal(PoolLookupStatus.Unavailable, lookup.Status);
+        Assert.Single(handler.Requests);
+    }
+
+    [Fact]
+    public async Task LookupPool_GivesUpAfterTheTimeout()
+    {
+        var handler = new StubHttpHandler(async (_, cancellationToken) =>
+        {
+            await Task.Delay(Timeout.Infinite, cancellationToken);
+            return new HttpResponseMessage(HttpStatusCode.OK);
+        });
+
+        var stopwatch = Stopwatch.StartNew();
+        var lookup = await CreateService(handler).LookupPoolAsync(AzDoUrl, "self-hosted", "pat", TimeSpan.FromMilliseconds(200), CancellationToken.None);
+
+        Assert.Equal(PoolLookupStatus.Unavailable, lookup.Status);
+        Assert.True(stopwatch.Elapsed < TimeSpan.FromSeconds(5), $"lookup took {stopwatch.Elapsed}");
+        Assert.Single(handler.Requests);
+    }
+
+    [Fact]
+    public async Task LookupPool_StopsWhenTheCallerCancels()
+    {
+        var handler = new StubHttpHandler(async (_, cancellationToken) =>
+        {
+            await Task.Delay(Timeout.Infinite, cancellationToken);
+            return new HttpResponseMessage(HttpStatusCode.OK);
+        });
+        using var caller = new CancellationTokenSource(TimeSpan.FromMilliseconds(200));
+
+        var lookup = await CreateService(handler).LookupPoolAsync(AzDoUrl, "self-hosted", "pat", TimeSpan.FromMinutes(1), caller.Token);
+
+        Assert.Equal(PoolLookupStatus.Unavailable, lookup.Status);
+    }
+
+    [Fact]
+    public async Task CheckConnection_AbortsAnInFlightRequestOnShutdown()
+    {
+        var lifetime = new FakeHostApplicationLifetime();
+        var handler = new StubHttpHandler(async (_, cancellationToken) =>
+        {
+            lifetime.StopApplication();
+            await Task.Delay(Timeout.Infinite, cancellationToken);
+            return new HttpResponseMessage(HttpStatusCode.OK);
+        });
+
+        var stopwatch = Stopwatch.StartNew();
+        var result = await CreateService(handler, lifetime).CheckConnectionAsync(AzDoUrl, "pat");
+
+        Assert.Equal(ConnectionCheckResult.Unreachable, result);
+        Assert.True(stopwatch.Elapsed < TimeSpan.FromSeconds(5), $"check took {stopwatch.Elapsed}");
+    }
+
+    [Fact]
+    public async Task CheckConnection_StopsRetryingOnShutdown()
+    {
+        var lifetime = new FakeHostApplicationLifetime();
+        var handler = new StubHttpHandler(_ =>
+        {
+            lifetime.StopApplication();
+            return new HttpResponseMessage(HttpStatusCode.ServiceUnavailable);
+        });
+
+        var result = await CreateService(handler, lifetime).CheckConnectionAsync(AzDoUrl, "pat");
+
+        Assert.Equal(ConnectionCheckResult.Unreachable, result);
+        Assert.Single(handler.Requests);
+    }
+
+    [Theory]
+    [InlineData(HttpStatusCode.OK, ConnectionCheckResult.Connected)]
+    [InlineData(HttpStatusCode.Unauthorized, ConnectionCheckResult.Unauthorized)]
+    [InlineData(HttpStatusCode.Forbidden, ConnectionCheckResult.Unauthorized)]
+    [InlineData(HttpStatusCode.NonAuthoritativeInformation, ConnectionCheckResult.Unauthorized)]
+    [InlineData(HttpStatusCode.NotFound, ConnectionCheckResult.NotFound)]
+    public async Task CheckConnection_TellsFailuresApart(HttpStatusCode statusCode, ConnectionCheckResult expected)
+    {
+        var handler = new StubHttpHandler(_ => statusCode == HttpStatusCode.OK
+            ? StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } })
+            : new HttpResponseMessage(statusCode) { Content = new StringContent("<html></html>") });
+
+        var connection = await CreateService(handler).CheckConnectionAsync(AzDoUrl, "pat");
+
+        Assert.Equal(expected, connection);
+    }
+
+    [Fact]
+    public async Task CheckConnection_ReportsNetworkErrorsAsUnreachable()
+    {
+        var handler = new StubHttpHandler(_ => throw new HttpRequestException("No such host is known (dev.azure.com:443)"));
+
+        var connection = await CreateService(handler).CheckConnectionAsync(AzDoUrl, "pat");
+
+        Assert.Equal(ConnectionCheckResult.Unreachable, connection);
+    }
+
+    [Fact]
+    public async Task GetPool_ReturnsNullWhenNoPoolHasTheName()
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(Array.Empty<object>()));
+
+        var pool = await CreateService(handler).GetPoolAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Null(pool);
+    }
+
+    [Theory]
+    [InlineData("self-hosted", 7)]
+    [InlineData("Self-Hosted", 8)]
+    [InlineData("SELF-HOSTED", null)]
+    [InlineData("build", 9)]
+    public async Task GetPool_PrefersAnExactMatchAndRefusesAnAmbiguousName(string poolName, int? expectedId)
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(new object[]
+        {
+            new { id = 7, name = "self-hosted" },
+            new { id = 8, name = "Self-Hosted" },
+            new { id = 9, name = "Build" }
+        }));
+
+        var pool = await CreateService(handler).GetPoolAsync(AzDoUrl, poolName, "pat");
+
+        Assert.Equal(expectedId, pool?.Id);
+    }
+
+    [Fact]
+    public async Task LookupPool_ReportsAnAmbiguousName()
+    {
+        var handler = new StubHttpHandler(_ => StubHttpHandler.List(new object[]
+        {
+            new { id = 7, name = "self-hosted" },
+            new { id = 8, name = "Self-Hosted" }
+        }));
+
+        var lookup = await CreateService(handler).LookupPoolAsync(AzDoUrl, "SELF-HOSTED", "pat", TimeSpan.FromSeconds(5), CancellationToken.None);
+
+        Assert.Equal(PoolLookupStatus.Ambiguous, lookup.Status);
+        Assert.Null(lookup.Pool);
+    }
+
+    [Fact]
+    public async Task GetPoolAgents_FollowsContinuationTokensAcrossPages()
+    {
+        var handler = new StubHttpHandler(request =>
+        {
+            if (!request.RequestUri!.AbsolutePath.EndsWith("/agents"))
+            {
+                return StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } });
+            }
+
+            return request.RequestUri.Query.Contains("continuationToken=page-2")
+                ? StubHttpHandler.List(new object[] { new { id = 3, name = "pool-agent-2", status = "online" } })
+                : StubHttpHandler.List(new object[]
+                {
+                    new { id = 1, name = "pool-agent-0", status = "online" },
+                    new { id = 2, name = "pool-agent-1", status = "offline" }
+                }, continuationToken: "page-2");
+        });
+
+        var agents = await CreateService(handler).GetPoolAgentsAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(new[] { "pool-agent-0", "pool-agent-1", "pool-agent-2" }, agents.Select(a => a.Name));
+        Assert.Equal(2, handler.Requests.Count(r => r.Uri.AbsolutePath.EndsWith("/agents")));
+    }
+
+    [Fact]
+    public async Task GetQueuedJobsCount_LeavesOutAssignedAndFinishedJobs()
+    {
+        var count = await CreateService(CreateJobRequestsHandler(MixedJobRequests)).GetQueuedJobsCountAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(2, count);
+    }
+
+    [Fact]
+    public async Task GetRunningJobsCount_CountsOnlyAssignedUnfinishedJobs()
+    {
+        var count = await CreateService(CreateJobRequestsHandler(MixedJobRequests)).GetRunningJobsCountAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(1, count);
+    }
+
+    [Fact]
+    public async Task GetJobRequests_ReturnsAJobSeenOnTwoPagesOnce()
+    {
+        var handler = CreateJobRequestsHandler(
+            new object[] { new { requestId = 1, queueTime = "2026-01-01T10:00:00Z" }, new { requestId = 2, queueTime = "2026-01-01T10:01:00Z" } },
+            new object[] { new { requestId = 2, queueTime = "2026-01-01T10:01:00Z" }, new { requestId = 3, queueTime = "2026-01-01T10:02:00Z" } });
+
+        var jobs = await CreateService(handler).GetJobRequestsAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(new[] { 1, 2, 3 }, jobs.Select(j => j.RequestId));
+        Assert.Equal(3, jobs.Distinct().Count());
+    }
+
+    [Fact]
+    public async Task GetQueuedJobsWithCapabilities_ReturnsEachQueuedJobOnce()
+    {
+        var handler = CreateJobRequestsHandler(
+            new object[] { new { requestId = 1, queueTime = "2026-01-01T10:00:00Z" }, new { requestId = 2, queueTime = "2026-01-01T10:01:00Z" } },
+            new object[] { new { requestId = 2, queueTime = "2026-01-01T10:01:00Z" } });
+
+        var jobs = await CreateService(handler).GetQueuedJobsWithCapabilitiesAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(new[] { 1, 2 }, jobs.Select(j => j.RequestId).OrderBy(id => id));
+    }
+
+    [Theory]
+    [InlineData(HttpStatusCode.Unauthorized)]
+    [InlineData(HttpStatusCode.NonAuthoritativeInformation)]
+    public async Task GetJobRequests_ThrowsAndForgetsTheCachedPoolWhenTheListFails(HttpStatusCode statusCode)
+    {
+        var handler = new StubHttpHandler(request => request.RequestUri!.AbsolutePath.EndsWith("/jobrequests")
+            ? new HttpResponseMessage(statusCode)
+            : StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } }));
+        var service = CreateService(handler);
+        await service.GetPoolAsync(AzDoUrl, "self-hosted", "pat");
+
+        await Assert.ThrowsAsync<AzureDevOpsRequestException>(() => service.GetJobRequestsAsync(AzDoUrl, "self-hosted", "pat"));
+        await service.GetPoolAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(2, handler.Requests.Count(r => r.Uri.AbsolutePath.EndsWith("/pools")));
+    }
+
+    [Fact]
+    public async Task GetPoolAgentCount_ReadsThePoolSizeWithoutListingAgents()
+    {
+        var handler = new StubHttpHandler(request => request.RequestUri!.AbsolutePath.EndsWith("/pools/7")
+            ? StubHttpHandler.Json(new { id = 7, name = "self-hosted", size = 3 })
+            : StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } }));
+
+        var count = await CreateService(handler).GetPoolAgentCountAsync(AzDoUrl, "self-hosted", "pat");
+
+        Assert.Equal(3, count);
+        Assert.DoesNotContain(handler.Requests, r => r.Uri.AbsolutePath.Contains("/agents"));
+    }
+
+    [Fact]
+    public async Task CancelJobRequest_PatchesTheRequestAsCanceled()
+    {
+        var handler = new StubHttpHandler(request => request.Method == HttpMethod.Patch
+            ? StubHttpHandler.Json(new { requestId = 42, result = "canceled" })
+            : StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } }));
+
+        var canceled = await CreateService(handler).CancelJobRequestAsync(AzDoUrl, "self-hosted", 42, "pat");
+
+        Assert.True(canceled);
+        var patch = Assert.Single(handler.Requests, r => r.Method == "PATCH");
+        Assert.Equal("/myorg/_apis/distributedtask/pools/7/jobrequests/42", patch.Uri.AbsolutePath);
+        Assert.Contains($"lockToken={Guid.Empty}", patch.Uri.Query);
+        Assert.Contains("\"result\":\"canceled\"", patch.Body);
+    }
+
+    [Fact]
+    public async Task CancelJobRequest_ReportsARejectedPatch()
+    {
+        var handler = new StubHttpHandler(request => request.Method == HttpMethod.Patch
+            ? new HttpResponseMessage(HttpStatusCode.BadRequest)
+            : StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } }));
+
+        var canceled = await CreateService(handler).CancelJobRequestAsync(AzDoUrl, "self-hosted", 42, "pat");
+
+        Assert.False(canceled);
+        Assert.Single(handler.Requests, r => r.Method == "PATCH");
+    }
+
+    [Theory]
+    [InlineData(false)]
+    [InlineData(true)]
+    public async Task SetAgentEnabled_PatchesEnabledAndKeepsTheRestOfTheAgent(bool enabled)
+    {
+        var handler = CreateAgentsHandler();
+
+        var updated = await CreateService(handler).SetAgentEnabledAsync(AzDoUrl, "self-hosted", "pool-agent-0", enabled, "pat");
+
+        Assert.True(updated);
+        var patch = Assert.Single(handler.Requests, r => r.Method == "PATCH");
+        Assert.Equal("/myorg/_apis/distributedtask/pools/7/agents/3", patch.Uri.AbsolutePath);
+        var body = System.Text.Json.Nodes.JsonNode.Parse(patch.Body!)!;
+        Assert.Equal(enabled, body["enabled"]!.GetValue<bool>());
+        Assert.Equal("pool-agent-0", body["name"]!.GetValue<string>());
+        Assert.Equal("4.255.0", body["version"]!.GetValue<string>());
+        Assert.Equal("yes", body["userCapabilities"]!["docker"]!.GetValue<string>());
+    }
+
+    [Fact]
+    public async Task SetAgentEnabled_ReportsAnUnknownAgent()
+    {
+        var handler = CreateAgentsHandler();
+
+        var updated = await CreateService(handler).SetAgentEnabledAsync(AzDoUrl, "self-hosted", "pool-agent-9", false, "pat");
+
+        Assert.False(updated);
+        Assert.DoesNotContain(handler.Requests, r => r.Method == "PATCH");
+    }
+
+    [Fact]
+    public async Task GetAgentByName_FindsTheAgentOfAPod()
+    {
+        var agent = await CreateService(CreateAgentsHandler()).GetAgentByNameAsync(AzDoUrl, "self-hosted", "pool-agent-0", "pat");
+
+        Assert.NotNull(agent);
+        Assert.Equal(3, agent.Id);
+        Assert.Equal("online", agent.Status);
+    }
+
+    [Fact]
+    public async Task GetAgentByName_ReturnsNullForAnUnknownAgent()
+    {
+        var agent = await CreateService(CreateAgentsHandler()).GetAgentByNameAsync(AzDoUrl, "self-hosted", "pool-agent-9", "pat");
+
+        Assert.Null(agent);
+    }
+
+    [Theory]
+    [InlineData(5, 5)]
+    [InlineData(60, 60)]
+    [InlineData(3600, 60)]
+    public void GetRetryDelay_HonoursRetryAfterUpToAMinute(int retryAfterSeconds, int expectedSeconds)
+    {
+        var response = new HttpResponseMessage(HttpStatusCode.TooManyRequests);
+        response.Headers.RetryAfter = new RetryConditionHeaderValue(TimeSpan.FromSeconds(retryAfterSeconds));
+
+        var delay = CreateService(new StubHttpHandler(_ => new HttpResponseMessage())).GetRetryDelay(response, 1);
+
+        Assert.Equal(TimeSpan.FromSeconds(expectedSeconds), delay);
+    }
+
+    [Fact]
+    public void GetRetryDelay_CapsARetryAfterDate()
+    {
+        var response = new HttpResponseMessage(HttpStatusCode.ServiceUnavailable);
+        response.Headers.RetryAfter = new RetryConditionHeaderValue(DateTimeOffset.UtcNow.AddHours(2));
+
+        var delay = CreateService(new StubHttpHandler(_ => new HttpResponseMessage())).GetRetryDelay(response, 1);
+
+        Assert.Equal(TimeSpan.FromSeconds(60), delay);
+    }
+
+    [Fact]
+    public async Task Throttled_RetriesAfterRetryAfterAndSucceeds()
+    {
+        var attempts = 0;
+        var handler = new StubHttpHandler(_ =>
+        {
+            if (++attempts > 2)
+            {
+                return StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } });
+            }
+
+            var throttled = new HttpResponseMessage(HttpStatusCode.TooManyRequests);
+            throttled.Headers.RetryAfter = new RetryConditionHeaderValue(TimeSpan.Zero);
+            return throttled;
+        });
+
+        var pools = await CreateService(handler).ListPoolsAsync(AzDoUrl, "pat");
+
+        Assert.Single(pools);
+        Assert.Equal(3, handler.Requests.Count);
+    }
+
+    [Theory]
+    [InlineData("https://dev.azure.com/myorg", "myorg")]
+    [InlineData("https://dev.azure.com/myorg/", "myorg")]
+    [InlineData("https://myorg.visualstudio.com", "myorg")]
+    [InlineData("https://tfs.corp.local/tfs/DefaultCollection", "DefaultCollection")]
+    [InlineData("https://dev.azure.com", "Invalid")]
+    public void ExtractOrganizationName_ReadsTheOrganizationFromTheUrl(string url, string expected)
+    {
+        var organization = CreateService(new StubHttpHandler(_ => new HttpResponseMessage())).ExtractOrganizationName(url);
+
+        Assert.Equal(expected, organization);
+    }
+
+    private static readonly object[] MixedJobRequests =
+    {
+        new { requestId = 1, queueTime = "2026-01-01T10:00:00Z" },
+        new { requestId = 2, queueTime = "2026-01-01T10:01:00Z" },
+        new
+        {
+            requestId = 3,
+            queueTime = "2026-01-01T09:50:00Z",
+            assignTime = "2026-01-01T09:50:05Z",
+            receiveTime = "2026-01-01T09:50:06Z",
+            reservedAgent = new { id = 1, name = "pool-agent-0" }
+        },
+        new
+        {
+            requestId = 4,
+            queueTime = "2026-01-01T09:00:00Z",
+            assignTime = "2026-01-01T09:00:05Z",
+            finishTime = "2026-01-01T09:30:00Z",
+            result = "succeeded",
+            reservedAgent = new { id = 1, name = "pool-agent-0" }
+        }
+    };
+
+    // Pool 7 with agents pool-agent-0 (id 3) and build-vm-01 (id 4)
+    private static StubHttpHandler CreateAgentsHandler()
+    {
+        var agent = new
+        {
+            id = 3,
+            name = "pool-agent-0",
+            status = "online",
+            enabled = true,
+            version = "4.255.0",
+            userCapabilities = new Dictionary<string, string> { ["docker"] = "yes" }
+        };
+
+        return new StubHttpHandler(request =>
+        {
+            var path = request.RequestUri!.AbsolutePath;
+            if (path.EndsWith("/agents/3"))
+            {
+                return StubHttpHandler.Json(agent);
+            }
+
+            return path.EndsWith("/agents")
+                ? StubHttpHandler.List(new object[] { agent, new { id = 4, name = "build-vm-01", status = "offline" } })
+                : StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } });
+        });
+    }
+
+    private static StubHttpHandler CreateJobRequestsHandler(params object[][] pages)
+    {
+        return new StubHttpHandler(request =>
+        {
+            if (!request.RequestUri!.AbsolutePath.EndsWith("/jobrequests"))
+            {
+                return StubHttpHandler.List(new object[] { new { id = 7, name = "self-hosted" } });
+            }
+
+            // Each page hands out the token of the next one, the last page has none
+            var query = System.Web.HttpUtility.ParseQueryString(request.RequestUri.Query);
+            var page = int.TryParse(query["continuationToken"], out var index) ? index : 0;
+            return StubHttpHandler.List(pages[page], page + 1 < pages.Length ? (page + 1).ToString() : null);
+        });
+    }
+
+    private static AzureDevOpsService CreateService(StubHttpHandler handler, FakeHostApplicationLifetime? lifetime = null)
+    {
+        return new AzureDevOpsService(new HttpClient(handler), NullLogger<AzureDevOpsService>.Instance,
+            new AzureDevOpsPoolCache(), lifetime ?? new FakeHostApplicationLifetime());
+    }
+}
+
+[Collection(EnvironmentCollection.Name)]
+public class AzureDevOpsServiceEnvironmentTests
+{
+    [Fact]
+    public void CreateHttpHandler_UsesTheProxyFromTheEnvironment()
+    {
+        using var _ = new EnvironmentVariableScope(("AZDO_CA_BUNDLE", null));
+
+        using var handler = Assert.IsType<SocketsHttpHandler>(AzureDevOpsService.CreateHttpHandler());
+
+        // A null Proxy means HttpClient.DefaultProxy, which reads HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+        Assert.True(handler.UseProxy);
+        Assert.Null(handler.Proxy);
+    }
+
+    [Theory]
+    [InlineData(true)]
+    [InlineData(false)]
+    public async Task CreateHttpHandler_ConnectsOnlyWhenTheCaBundleTrustsTheServer(bool trustCa)
+    {
+        var (ca, serverCertificate) = CreateCertificates();
+        var caBundlePath = Path.GetTempFileName();
+        await File.WriteAllTextAsync(caBundlePath, ca.ExportCertificatePem());
+        var listener = new TcpListener(IPAddress.Loopback, 0);
+        listener.Start();
+        try
+        {
+            using var _ = new EnvironmentVariableScope(("AZDO_CA_BUNDLE", trustCa ? caBundlePath : null));
+            var serving = ServeOnceAsync(listener, serverCertificate);
+            using var client = new HttpClient(AzureDevOpsService.CreateHttpHandler());
+            var url = $"https://localhost:{((IPEndPoint)listener.LocalEndpoint).Port}/_apis/connectionData";
+
+            if (trustCa)
+            {
+                var response = await client.GetAsync(url);
+                Assert.Equal(HttpStatusCode.OK, response.StatusCode);
+            }
+            else
+            {
+                await Assert.ThrowsAsync<HttpRequestException>(() => client.GetAsync(url));
+            }
+
+            await serving;
+        }
+        finally
+        {
+            listener.Stop();
+            File.Delete(caBundlePath);
+        }
+    }
+
+    [Fact]
+    public async Task CheckConnection_TimesOutAHungRequestAfterTheRequestTimeout()
+    {
+        using var _ = new EnvironmentVariableScope(("AZDO_REQUEST_TIMEOUT_SECONDS", "1"));
+        var handler = new StubHttpHandler(async (_, cancellationToken) =>
+        {
+            await Task.Delay(Timeout.Infinite, cancellationToken);
+            return new HttpResponseMessage(HttpStatusCode.OK);
+        });
+        var service = new AzureDevOpsService(new HttpClient(handler), NullLogger<AzureDevOpsService>.Instance,
+            new AzureDevOpsPoolCache(), new FakeHostApplicationLifetime());
+
+        var stopwatch = Stopwatch.StartNew();
+        var result = await service.CheckConnectionAsync("https://dev.azure.com/myorg", "pat");
+
+        Assert.Equal(ConnectionCheckResult.Unreachable, result);
+        Assert.True(stopwatch.Elapsed < TimeSpan.FromSeconds(5), $"check took {stopwatch.Elapsed}");
+        Assert.Single(handler.Requests);
+    }
+
+    // A private root CA and a localhost certificate it signed, like an on-prem Azure DevOps Server
+    private static (X509Certificate2 Ca, X509Certificate2 Server) CreateCertificates()
+    {
+        using var caKey = RSA.Create(2048);
+        var caRequest = new CertificateRequest("CN=Test Root CA", caKey, HashAlgorithmName.SHA256, RSASignaturePadding.Pkcs1);
+        caRequest.CertificateExtensions.Add(new X509BasicConstraintsExtension(true, false, 0, true));
+        caRequest.CertificateExtensions.Add(new X509KeyUsageExtension(X509KeyUsageFlags.KeyCertSign | X509KeyUsageFlags.CrlSign, true));
+        var ca = caRequest.CreateSelfSigned(DateTimeOffset.UtcNow.AddDays(-1), DateTimeOffset.UtcNow.AddDays(1));
+
+        using var serverKey = RSA.Create(2048);
+        var serverRequest = new CertificateRequest("CN=localhost", serverKey, HashAlgorithmName.SHA256, RSASignaturePadding.Pkcs1);
+        var subjectAlternativeNames = new SubjectAlternativeNameBuilder();
+        subjectAlternativeNames.AddDnsName("localhost");
+        serverRequest.CertificateExtensions.Add(subjectAlternativeNames.Build());
+        serverRequest.CertificateExtensions.Add(new X509EnhancedKeyUsageExtension(new OidCollection { new Oid("1.3.6.1.5.5.7.3.1") }, false));
+        using var signed = serverRequest.Create(ca, DateTimeOffset.UtcNow.AddHours(-1), DateTimeOffset.UtcNow.AddHours(1), RandomNumberGenerator.GetBytes(8));
+        using var withKey = signed.CopyWithPrivateKey(serverKey);
+
+        // SslStream needs the key in a persisted form, not the ephemeral one CopyWithPrivateKey returns
+        return (ca, X509CertificateLoader.LoadPkcs12(withKey.Export(X509ContentType.Pfx), null));
+    }
+
+    private static async Task ServeOnceAsync(TcpListener listener, X509Certificate2 certificate)
+    {
+        using var connection = await listener.AcceptTcpClientAsync();
+        await using var ssl = new SslStream(connection.GetStream());
+        try
+        {
+            await ssl.AuthenticateAsServerAsync(certificate);
+
+            // Skip the request headers, every request gets the same empty answer
+            using var reader = new StreamReader(ssl, leaveOpen: true);
+            while (!string.IsNullOrEmpty(await reader.ReadLineAsync()))
+            {
+            }
+
+            await ssl.WriteAsync("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"u8.ToArray());
+        }
+        catch (Exception ex) when (ex is IOException or System.Security.Authentication.AuthenticationException)
+        {
+            // The client rejected the certificate and dropped the connection
+        }
+    }
+}
@@ -0,0 +1,420 @@
+using AzDORunner.Entities;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using k8s.Models;
+
+namespace AzDORunner.Tests.Services;
+
+public class KubernetesPodServiceTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly KubernetesPodService _podService;
+
+    public KubernetesPodServiceTests()
+    {
+        _podService = new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, new OperatorMetrics());
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_MountsEveryCertTrustStoreSecretUnderItsOwnVolume()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.CertTrustStore = new List<V1AzDORunnerEntity.CertTrustStore>
+        {
+            new() { SecretName = "corp-root-ca" },
+            new() { SecretName = "corp-issuing-ca" }
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var certVolumes = pod.Spec.Volumes.Where(v => v.Secret != null).ToList();
+        Assert.Equal(new[] { "corp-root-ca", "corp-issuing-ca" }, certVolumes.Select(v => v.Secret.SecretName));
+        Assert.Equal(2, certVolumes.Select(v => v.Name).Distinct().Count());
+
+        var certMounts = pod.Spec.Containers.Single().VolumeMounts
+            .Where(m => certVolumes.Any(v => v.Name == m.Name))
+            .ToList();
+        Assert.Equal(2, certMounts.Count);
+        Assert.Equal(2, certMounts.Select(m => m.MountPath).Distinct().Count());
+        Assert.All(certMounts, mount => Assert.True(mount.ReadOnlyProperty));
+    }
+
+    [Fact]
+    public async Task CountOwnedPods_CountsOnlyPodsControlledByThePoolAndLeavesOthersAlone()
+    {
+        var pool = TestEntities.CreatePool();
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 1));
+
+        var stalePod = TestEntities.CreateAgentPod(pool, 2);
+        stalePod.Metadata.OwnerReferences[0].Uid = Guid.NewGuid().ToString();
+        _kubernetes.Add(stalePod);
+
+        var unownedPod = TestEntities.CreateAgentPod(pool, 3);
+        unownedPod.Metadata.OwnerReferences = null;
+        _kubernetes.Add(unownedPod);
+
+        var owned = await _podService.CountOwnedPodsAsync(pool);
+
+        Assert.Equal(2, owned);
+        Assert.Equal(0, _kubernetes.CountRequests("PUT", "/pods/"));
+        Assert.Null(_kubernetes.Get<V1Pod>("pool-agent-3")!.Metadata.OwnerReferences);
+        Assert.NotEqual(pool.Metadata.Uid, _kubernetes.Get<V1Pod>("pool-agent-2")!.Metadata.OwnerReferences.Single().Uid);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_PrivilegedSpecProducesPrivilegedContainer()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.SecurityContext = new V1AzDORunnerEntity.SecurityContextSpec
+        {
+            RunAsUser = 2000,
+            RunAsGroup = 3000,
+            FsGroup = 4000,
+            Privileged = true
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var securityContext = pod.Spec.Containers.Single().SecurityContext;
+        Assert.True(securityContext.Privileged);
+        Assert.True(securityContext.AllowPrivilegeEscalation);
+        Assert.Equal(2000, securityContext.RunAsUser);
+        Assert.Equal(3000, securityContext.RunAsGroup);
+        Assert.True(securityContext.RunAsNonRoot);
+        Assert.Equal(4000, pod.Spec.SecurityContext.FsGroup);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_DefaultSecurityContextRunsAsNonRootUser()
+    {
+        var pool = TestEntities.CreatePool();
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var securityContext = pod.Spec.Containers.Single().SecurityContext;
+        Assert.False(securityContext.Privileged);
+        Assert.False(securityContext.AllowPrivilegeEscalation);
+        Assert.Equal(1001, securityContext.RunAsUser);
+        Assert.Equal(1001, securityContext.RunAsGroup);
+        Assert.True(securityContext.RunAsNonRoot);
+        Assert.Equal(1001, pod.Spec.SecurityContext.FsGroup);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_AddsExtraEnvFromLiteralSecretAndConfigMapSources()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.ExtraEnv = new List<V1AzDORunnerEntity.ExtraEnvVar>
+        {
+            new() { Name = "LITERAL", Value = "value" },
+            new()
+            {
+                Name = "FROM_SECRET",
+                ValueFrom = new V1EnvVarSource { SecretKeyRef = new V1SecretKeySelector { Name = "creds", Key = "password" } }
+            },
+            new()
+            {
+                Name = "FROM_CONFIGMAP",
+                ValueFrom = new V1EnvVarSource { ConfigMapKeyRef = new V1ConfigMapKeySelector { Name = "settings", Key = "region" } }
+            }
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var env = pod.Spec.Containers.Single().Env.ToDictionary(e => e.Name);
+        Assert.Equal("value", env["LITERAL"].Value);
+        Assert.Null(env["LITERAL"].ValueFrom);
+        Assert.Equal("creds", env["FROM_SECRET"].ValueFrom.SecretKeyRef.Name);
+        Assert.Equal("password", env["FROM_SECRET"].ValueFrom.SecretKeyRef.Key);
+        Assert.Equal("settings", env["FROM_CONFIGMAP"].ValueFrom.ConfigMapKeyRef.Name);
+        Assert.Equal("region", env["FROM_CONFIGMAP"].ValueFrom.ConfigMapKeyRef.Key);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_AppliesTheConfiguredRequestsAndLimits()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Resources = new V1AzDORunnerEntity.ResourcesSpec
+        {
+            Requests = new Dictionary<string, string> { ["cpu"] = "500m", ["memory"] = "1Gi" },
+            Limits = new Dictionary<string, string> { ["cpu"] = "4", ["memory"] = "8Gi" }
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var resources = pod.Spec.Containers.Single().Resources;
+        Assert.Equal("500m", resources.Requests["cpu"].ToString());
+        Assert.Equal("1Gi", resources.Requests["memory"].ToString());
+        Assert.Equal("4", resources.Limits["cpu"].ToString());
+        Assert.Equal("8Gi", resources.Limits["memory"].ToString());
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_LeavesLimitsOffWhenTheyAreEmpty()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Resources.Limits = new Dictionary<string, string>());
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var resources = pod.Spec.Containers.Single().Resources;
+        Assert.Equal("100m", resources.Requests["cpu"].ToString());
+        Assert.Null(resources.Limits);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_PlacesThePodWithTheConfiguredNodeSelectorTolerationsAndAffinity()
+    {
+        var pool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.NodeSelector = new Dictionary<string, string> { ["agentpool"] = "ci-spot" };
+            spec.Tolerations = new List<V1Toleration>
+            {
+                new() { Key = "kubernetes.azure.com/scalesetpriority", OperatorProperty = "Equal", Value = "spot", Effect = "NoSchedule" }
+            };
+            spec.Affinity = new V1Affinity
+            {
+                NodeAffinity = new V1NodeAffinity
+                {
+                    RequiredDuringSchedulingIgnoredDuringExecution = new V1NodeSelector
+                    {
+                        NodeSelectorTerms = new List<V1NodeSelectorTerm>
+                        {
+                            new()
+                            {
+                                MatchExpressions = new List<V1NodeSelectorRequirement>
+                                {
+                                    new() { Key = "kubernetes.io/arch", OperatorProperty = "In", Values = new List<string> { "amd64" } }
+                                }
+                            }
+                        }
+                    }
+                }
+            };
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        Assert.Equal("ci-spot", pod.Spec.NodeSelector["agentpool"]);
+        var toleration = Assert.Single(pod.Spec.Tolerations);
+        Assert.Equal("kubernetes.azure.com/scalesetpriority", toleration.Key);
+        Assert.Equal("spot", toleration.Value);
+        Assert.Equal("NoSchedule", toleration.Effect);
+        var requirement = pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms.Single().MatchExpressions.Single();
+        Assert.Equal("kubernetes.io/arch", requirement.Key);
+        Assert.Equal(new[] { "amd64" }, requirement.Values);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_SchedulesAnywhereWithoutPlacementSettings()
+    {
+        var pod = await _podService.CreateAgentPodAsync(TestEntities.CreatePool(), "pat", 0);
+
+        Assert.Null(pod.Spec.NodeSelector);
+        Assert.Null(pod.Spec.Tolerations);
+        Assert.Null(pod.Spec.Affinity);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_LogsWithThePoolAgentAndCapabilityScope()
+    {
+        var logger = new RecordingLogger<KubernetesPodService>();
+        var podService = new KubernetesPodService(_kubernetes.Client, logger, new OperatorMetrics());
+
+        await podService.CreateAgentPodAsync(TestEntities.CreatePool(), "pat", 2);
+
+        var created = Assert.Single(logger.Entries, e => e.Message.Contains("agent pod pool-agent-2"));
+        Assert.Equal(LogLevel.Information, created.Level);
+        Assert.Equal("pool", created.Scope["runner-pool"]);
+        Assert.Equal("default", created.Scope["namespace"]);
+        Assert.Equal(2, created.Scope["agent-index"]);
+        Assert.Equal("base", created.Scope["capability"]);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_LogsFailuresWithThePoolAndAgentScope()
+    {
+        var logger = new RecordingLogger<KubernetesPodService>();
+        var podService = new KubernetesPodService(_kubernetes.Client, logger, new OperatorMetrics());
+        _kubernetes.Intercept = request => request.Method == "POST" && request.Path.EndsWith("/pods")
+            ? new HttpResponseMessage(System.Net.HttpStatusCode.InternalServerError)
+            : null;
+
+        await Assert.ThrowsAnyAsync<Exception>(() => podService.CreateAgentPodAsync(TestEntities.CreatePool(), "pat", 0));
+
+        var failed = Assert.Single(logger.Entries, e => e.Level == LogLevel.Error);
+        Assert.Contains("pool-agent-0", failed.Message);
+        Assert.Equal("pool", failed.Scope["runner-pool"]);
+        Assert.Equal(0, failed.Scope["agent-index"]);
+    }
+
+    [Fact]
+    public async Task DeletePod_LogsWithThePodScope()
+    {
+        var logger = new RecordingLogger<KubernetesPodService>();
+        var podService = new KubernetesPodService(_kubernetes.Client, logger, new OperatorMetrics());
+        _kubernetes.Add(TestEntities.CreateAgentPod(TestEntities.CreatePool(), 0));
+
+        await podService.DeletePodAsync("pool-agent-0", "default");
+
+        var deleted = Assert.Single(logger.Entries, e => e.Message.Contains("Deleted pod pool-agent-0"));
+        Assert.Equal("pool-agent-0", deleted.Scope["pod"]);
+        Assert.Equal("default", deleted.Scope["namespace"]);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_KeepsAgentNamesOfSameNamedPoolsApartWithAgentNamePrefix()
+    {
+        var poolA = TestEntities.CreatePool(namespaceName: "team-a", configure: spec => spec.AgentNamePrefix = "team-a-ci");
+        var poolB = TestEntities.CreatePool(namespaceName: "team-b", configure: spec => spec.AgentNamePrefix = "team-b-ci");
+
+        var podA = await _podService.CreateAgentPodAsync(poolA, "pat", 0);
+        var podB = await _podService.CreateAgentPodAsync(poolB, "pat", 0);
+
+        Assert.Equal("team-a-ci-agent-0", podA.Metadata.Name);
+        Assert.Equal("team-b-ci-agent-0", podB.Metadata.Name);
+        Assert.Equal("team-a-ci-agent-0", podA.Spec.Containers.Single().Env.Single(e => e.Name == "AZP_AGENT_NAME").Value);
+        Assert.Equal("team-b-ci-agent-0", podB.Spec.Containers.Single().Env.Single(e => e.Name == "AZP_AGENT_NAME").Value);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_AttachesTheImagePullSecrets()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.ImagePullSecrets = new List<string> { "acr-pull", "ghcr-pull" });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        Assert.Equal(new[] { "acr-pull", "ghcr-pull" }, pod.Spec.ImagePullSecrets.Select(s => s.Name));
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_AddsPodTemplateLabelsAndAnnotationsButKeepsReservedLabels()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.PodTemplate = new V1AzDORunnerEntity.PodTemplateSpec
+        {
+            Labels = new Dictionary<string, string>
+            {
+                ["cost-center"] = "ci",
+                ["runner-pool"] = "someone-else",
+                ["min-agent"] = "true",
+                ["capability"] = "gpu"
+            },
+            Annotations = new Dictionary<string, string> { ["sidecar.istio.io/inject"] = "false" }
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        Assert.Equal("ci", pod.Metadata.Labels["cost-center"]);
+        Assert.Equal("pool", pod.Metadata.Labels["runner-pool"]);
+        Assert.Equal("false", pod.Metadata.Labels["min-agent"]);
+        Assert.Equal("base", pod.Metadata.Labels["capability"]);
+        Assert.Equal("false", pod.Metadata.Annotations["sidecar.istio.io/inject"]);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_RegistersTheAgentUnderThePodNameInTheWorkDir()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.WorkDir = "/azp/_work");
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 3);
+
+        var env = pod.Spec.Containers.Single().Env;
+        Assert.Equal(pod.Metadata.Name, env.Single(e => e.Name == "AZP_AGENT_NAME").Value);
+        Assert.Equal("pool-agent-3", pod.Metadata.Name);
+        Assert.Equal("/azp/_work", env.Single(e => e.Name == "AZP_WORK").Value);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_LeavesTheWorkDirToTheImageByDefault()
+    {
+        var pod = await _podService.CreateAgentPodAsync(TestEntities.CreatePool(), "pat", 0);
+
+        Assert.DoesNotContain(pod.Spec.Containers.Single().Env, e => e.Name == "AZP_WORK");
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_SetsProxyEnvInBothCasingsAndForTheAgent()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Proxy = new V1AzDORunnerEntity.ProxySpec
+        {
+            HttpProxy = "http://proxy.corp:3128",
+            HttpsProxy = "http://secure-proxy.corp:3128",
+            NoProxy = "localhost,.svc"
+        });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var env = pod.Spec.Containers.Single().Env.ToDictionary(e => e.Name, e => e.Value);
+        Assert.Equal("http://proxy.corp:3128", env["HTTP_PROXY"]);
+        Assert.Equal("http://proxy.corp:3128", env["http_proxy"]);
+        Assert.Equal("http://secure-proxy.corp:3128", env["HTTPS_PROXY"]);
+        Assert.Equal("http://secure-proxy.corp:3128", env["https_proxy"]);
+        Assert.Equal("http://secure-proxy.corp:3128", env["VSTS_HTTP_PROXY"]);
+        Assert.Equal("localhost,.svc", env["NO_PROXY"]);
+        Assert.Equal("localhost,.svc", env["no_proxy"]);
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_FallsBackToTheHttpProxyForTheAgent()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Proxy = new V1AzDORunnerEntity.ProxySpec { HttpProxy = "http://proxy.corp:3128" });
+
+        var pod = await _podService.CreateAgentPodAsync(pool, "pat", 0);
+
+        var env = pod.Spec.Containers.Single().Env;
+        Assert.Equal("http://proxy.corp:3128", env.Single(e => e.Name == "VSTS_HTTP_PROXY").Value);
+        Assert.DoesNotContain(env, e => e.Name == "HTTPS_PROXY" || e.Name == "NO_PROXY");
+    }
+
+    [Fact]
+    public async Task CreateAgentPod_SetsNoProxyEnvByDefault()
+    {
+        var pod = await _podService.CreateAgentPodAsync(TestEntities.CreatePool(), "pat", 0);
+
+        Assert.DoesNotContain(pod.Spec.Containers.Single().Env, e => e.Name.EndsWith("_PROXY", StringComparison.OrdinalIgnoreCase));
+    }
+
+    [Fact]
+    public async Task UpdatePodLabels_MergesOntoTheExistingLabels()
+    {
+        var pool = TestEntities.CreatePool();
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+
+        await _podService.UpdatePodLabelsAsync("pool-agent-0", "default",
+            new Dictionary<string, string> { ["job-request-id"] = "42", ["job-definition"] = "build" });
+        await _podService.UpdatePodLabelsAsync("pool-agent-0", "default",
+            new Dictionary<string, string> { ["job-definition"] = "" });
+
+        var labels = _kubernetes.Get<V1Pod>("pool-agent-0")!.Metadata.Labels;
+        Assert.Equal("42", labels["job-request-id"]);
+        Assert.False(labels.ContainsKey("job-definition"));
+        Assert.Equal("pool", labels["runner-pool"]);
+        Assert.Equal("azdo-runner-operator", labels["managed-by"]);
+    }
+
+    [Fact]
+    public async Task UpdatePodLabels_RetriesWhenThePodChangedInBetween()
+    {
+        var pool = TestEntities.CreatePool();
+        _kubernetes.Add(TestEntities.CreateAgentPod(pool, 0));
+        var conflicts = 0;
+        _kubernetes.Intercept = request =>
+        {
+            if (request.Method != "PUT" || conflicts >= 2)
+            {
+                return null;
+            }
+
+            // Someone else updated the pod between our read and write
+            conflicts++;
+            _kubernetes.Update<V1Pod>("pool-agent-0", "default", pod => pod.Metadata.Annotations = new Dictionary<string, string> { ["touched"] = conflicts.ToString() });
+            return new HttpResponseMessage(System.Net.HttpStatusCode.Conflict)
+            {
+                Content = new StringContent("{\"kind\":\"Status\",\"apiVersion\":\"v1\",\"status\":\"Failure\",\"reason\":\"Conflict\",\"code\":409}")
+            };
+        };
+
+        await _podService.UpdatePodLabelsAsync("pool-agent-0", "default", new Dictionary<string, string> { ["job-request-id"] = "42" });
+
+        var pod = _kubernetes.Get<V1Pod>("pool-agent-0")!;
+        Assert.Equal("42", pod.Metadata.Labels["job-request-id"]);
+        Assert.Equal("2", pod.Metadata.Annotations["touched"]);
+        Assert.Equal(3, _kubernetes.CountRequests("PUT", "/pods/pool-agent-0"));
+    }
+}
@@ -0,0 +1,69 @@
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using KubeOps.Abstractions.Events;
+
+namespace AzDORunner.Tests.Services;
+
+public class PatSecretWatcherServiceTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly PatSecretWatcherService _watcher;
+
+    public PatSecretWatcherServiceTests()
+    {
+        var podService = new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, new OperatorMetrics());
+        var leaderElection = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client);
+        EventPublisher eventPublisher = (_, _, _, _, _) => Task.CompletedTask;
+
+        _pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, _azureDevOps, podService,
+            _kubernetes.Client, new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance),
+            new OperatorMetrics(), eventPublisher, leaderElection);
+        var errorPodCleanup = new ErrorPodCleanupService(NullLogger<ErrorPodCleanupService>.Instance, podService, _azureDevOps,
+            _kubernetes.Client, leaderElection, _pollingService);
+        _watcher = new PatSecretWatcherService(NullLogger<PatSecretWatcherService>.Instance, _kubernetes.Client, _pollingService, errorPodCleanup);
+    }
+
+    [Fact]
+    public async Task RotatingAReferencedSecret_PollsOnlyThePoolUsingIt()
+    {
+        var poolA = _kubernetes.Add(TestEntities.CreatePool("pool-a", configure: spec => spec.PatSecretName = "pat-a"));
+        var poolB = _kubernetes.Add(TestEntities.CreatePool("pool-b", configure: spec =>
+        {
+            spec.PatSecretName = "pat-b";
+            spec.Pool = "other-pool";
+        }));
+        _azureDevOps.Pools.Add(new Pool { Id = 2, Name = "other-pool" });
+        _pollingService.RegisterPool(poolA, "old");
+        _pollingService.RegisterPool(poolB, "old");
+
+        // Both pools are due right after registering, poll them once so neither is due anymore
+        await _pollingService.PollAllRegisteredPools();
+        _azureDevOps.JobRequestReads.Clear();
+
+        _watcher.ApplySecret(TestEntities.CreatePatSecret("pat-a", value: "rotated"));
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.Equal("rotated", _pollingService.GetPoolsUsingSecret("default", "pat-a").Single().Pat);
+        Assert.Equal("old", _pollingService.GetPoolsUsingSecret("default", "pat-b").Single().Pat);
+        Assert.Contains("self-hosted", _azureDevOps.JobRequestReads);
+        Assert.DoesNotContain("other-pool", _azureDevOps.JobRequestReads);
+    }
+
+    [Fact]
+    public async Task UnreferencedOrUnchangedSecrets_DoNotTriggerAPoll()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.PatSecretName = "pat-a"));
+        _pollingService.RegisterPool(pool, "pat");
+        await _pollingService.PollAllRegisteredPools();
+        _azureDevOps.JobRequestReads.Clear();
+
+        _watcher.ApplySecret(TestEntities.CreatePatSecret("unrelated", value: "rotated"));
+        _watcher.ApplySecret(TestEntities.CreatePatSecret("pat-a", value: "pat"));
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.Empty(_azureDevOps.JobRequestReads);
+    }
+}
@@ -0,0 +1,185 @@
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+
+namespace AzDORunner.Tests.Services;
+
+public class ReconcileDispatcherTests
+{
+    private static readonly TimeSpan Timeout = TimeSpan.FromSeconds(10);
+
+    private static ReconcileDispatcher CreateDispatcher(int maxConcurrentReconciles)
+    {
+        return new ReconcileDispatcher(NullLogger<ReconcileDispatcher>.Instance, new FakeHostApplicationLifetime(), maxConcurrentReconciles);
+    }
+
+    [Fact]
+    public async Task DistinctPools_ReconcileConcurrentlyWithoutSeeingEachOther()
+    {
+        var dispatcher = CreateDispatcher(2);
+        var poolA = TestEntities.CreatePool("pool-a");
+        var poolB = TestEntities.CreatePool("pool-b");
+        var releaseA = new TaskCompletionSource(TaskCreationOptions.RunContinuationsAsynchronously);
+        var seen = new List<string>();
+
+        var reconcileA = dispatcher.DispatchAsync(poolA, async _ =>
+        {
+            await releaseA.Task;
+            lock (seen) seen.Add(poolA.Metadata.Name);
+        }, CancellationToken.None);
+
+        // B finishes while A is still stuck on its "Azure DevOps call"
+        await dispatcher.DispatchAsync(poolB, _ =>
+        {
+            lock (seen) seen.Add(poolB.Metadata.Name);
+            return Task.CompletedTask;
+        }, CancellationToken.None).WaitAsync(Timeout);
+
+        Assert.False(reconcileA.IsCompleted);
+        releaseA.SetResult();
+        await reconcileA.WaitAsync(Timeout);
+
+        Assert.Equal(new[] { "pool-b", "pool-a" }, seen);
+    }
+
+    [Fact]
+    public async Task SamePool_IsNeverReconciledTwiceAtOnce()
+    {
+        var dispatcher = CreateDispatcher(4);
+        var pool = TestEntities.CreatePool();
+        var running = 0;
+        var maxRunning = 0;
+
+        var reconciles = Enumerable.Range(0, 5).Select(i => dispatcher.DispatchAsync(pool, async _ =>
+        {
+            var now = Interlocked.Increment(ref running);
+            InterlockedMax(ref maxRunning, now);
+            await Task.Delay(20);
+            Interlocked.Decrement(ref running);
+        }, CancellationToken.None)).ToList();
+
+        await Task.WhenAll(reconciles).WaitAsync(Timeout);
+
+        Assert.Equal(1, maxRunning);
+    }
+
+    [Fact]
+    public async Task MaxConcurrentReconciles_BoundsDistinctPools()
+    {
+        var dispatcher = CreateDispatcher(2);
+        var running = 0;
+        var maxRunning = 0;
+
+        var reconciles = Enumerable.Range(0, 6).Select(i => dispatcher.DispatchAsync(TestEntities.CreatePool($"pool-{i}"), async _ =>
+        {
+            var now = Interlocked.Increment(ref running);
+            InterlockedMax(ref maxRunning, now);
+            await Task.Delay(20);
+            Interlocked.Decrement(ref running);
+        }, CancellationToken.None)).ToList();
+
+        await Task.WhenAll(reconciles).WaitAsync(Timeout);
+
+        Assert.Equal(2, maxRunning);
+    }
+
+    [Fact]
+    public async Task FailedReconcile_PropagatesToTheController()
+    {
+        var dispatcher = CreateDispatcher(2);
+
+        await Assert.ThrowsAsync<InvalidOperationException>(() => dispatcher.DispatchAsync(TestEntities.CreatePool(),
+            _ => throw new InvalidOperationException("Azure DevOps is down"), CancellationToken.None));
+    }
+
+    [Fact]
+    public async Task ForgetAsync_CancelsTheRunningReconcileAndWaitsForIt()
+    {
+        var dispatcher = CreateDispatcher(2);
+        var pool = TestEntities.CreatePool();
+        var started = new TaskCompletionSource(TaskCreationOptions.RunContinuationsAsynchronously);
+        var registered = false;
+        var finished = false;
+
+        var reconcile = dispatcher.DispatchAsync(pool, async token =>
+        {
+            try
+            {
+                started.SetResult();
+                await Task.Delay(System.Threading.Timeout.Infinite, token);
+                registered = true;
+            }
+            finally
+            {
+                finished = true;
+            }
+        }, CancellationToken.None);
+
+        await started.Task.WaitAsync(Timeout);
+        await dispatcher.ForgetAsync(pool).WaitAsync(Timeout);
+
+        // The finalizer unregisters the pool right after this, nothing may register it again
+        Assert.True(finished);
+        Assert.False(registered);
+        await reconcile.WaitAsync(Timeout);
+    }
+
+    [Fact]
+    public async Task ForgetAsync_DropsReconcilesWaitingForThePool()
+    {
+        var dispatcher = CreateDispatcher(2);
+        var pool = TestEntities.CreatePool();
+        var releaseFirst = new TaskCompletionSource(TaskCreationOptions.RunContinuationsAsynchronously);
+        var started = new TaskCompletionSource(TaskCreationOptions.RunContinuationsAsynchronously);
+        var runs = 0;
+
+        var first = dispatcher.DispatchAsync(pool, async _ =>
+        {
+            Interlocked.Increment(ref runs);
+            started.SetResult();
+            await releaseFirst.Task;
+        }, CancellationToken.None);
+        await started.Task.WaitAsync(Timeout);
+
+        var queued = dispatcher.DispatchAsync(pool, _ =>
+        {
+            Interlocked.Increment(ref runs);
+            return Task.CompletedTask;
+        }, CancellationToken.None);
+
+        var forget = dispatcher.ForgetAsync(pool);
+        await queued.WaitAsync(Timeout);
+        Assert.False(forget.IsCompleted);
+
+        releaseFirst.SetResult();
+        await Task.WhenAll(first, forget).WaitAsync(Timeout);
+
+        Assert.Equal(1, runs);
+    }
+
+    private static void InterlockedMax(ref int target, int value)
+    {
+        int current;
+        while (value > (current = Volatile.Read(ref target)) &&
+               Interlocked.CompareExchange(ref target, value, current) != current)
+        {
+        }
+    }
+}
+
+[Collection(EnvironmentCollection.Name)]
+public class ReconcileDispatcherSettingsTests
+{
+    [Theory]
+    [InlineData("4", 4)]
+    [InlineData(null, 1)]
+    [InlineData("0", 1)]
+    [InlineData("many", 1)]
+    public void MaxConcurrentReconciles_IsReadFromTheEnvironment(string? value, int expected)
+    {
+        using var _ = new EnvironmentVariableScope(("MAX_CONCURRENT_RECONCILES", value));
+
+        var dispatcher = new ReconcileDispatcher(NullLogger<ReconcileDispatcher>.Instance, new FakeHostApplicationLifetime());
+
+        Assert.Equal(expected, dispatcher.MaxConcurrentReconciles);
+    }
+}
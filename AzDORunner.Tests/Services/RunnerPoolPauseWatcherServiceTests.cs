@@ -0,0 +1,63 @@
+using AzDORunner.Entities;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using KubeOps.Abstractions.Events;
+
+namespace AzDORunner.Tests.Services;
+
+public class RunnerPoolPauseWatcherServiceTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly RunnerPoolPauseWatcherService _watcher;
+
+    public RunnerPoolPauseWatcherServiceTests()
+    {
+        var podService = new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, new OperatorMetrics());
+        var leaderElection = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client);
+        EventPublisher eventPublisher = (_, _, _, _, _) => Task.CompletedTask;
+
+        _pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, _azureDevOps, podService,
+            _kubernetes.Client, new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance),
+            new OperatorMetrics(), eventPublisher, leaderElection);
+        _watcher = new RunnerPoolPauseWatcherService(NullLogger<RunnerPoolPauseWatcherService>.Instance, _kubernetes.Client, _pollingService);
+    }
+
+    [Fact]
+    public async Task ResumingAPausedPool_PollsItRightAway()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default",
+            p => p.Metadata.Annotations = new Dictionary<string, string> { [AzureDevOpsPollingService.PausedAnnotation] = "true" });
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 1, QueueTime = DateTime.UtcNow });
+        _pollingService.RegisterPool(_kubernetes.Get<V1AzDORunnerEntity>("pool")!, "pat");
+        await _pollingService.PollAllRegisteredPools();
+        Assert.True(_pollingService.IsPaused(pool));
+
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default", p => p.Metadata.Annotations.Remove(AzureDevOpsPollingService.PausedAnnotation));
+        _watcher.ApplyRunnerPool(_kubernetes.Get<V1AzDORunnerEntity>("pool")!);
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.False(_pollingService.IsPaused(pool));
+        Assert.Equal(1, _kubernetes.CountRequests("POST", "/pods"));
+    }
+
+    [Fact]
+    public async Task OtherChangesToAPool_DoNotTriggerAPoll()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _pollingService.RegisterPool(pool, "pat");
+        await _pollingService.PollAllRegisteredPools();
+        _azureDevOps.JobRequestReads.Clear();
+
+        _kubernetes.Update<V1AzDORunnerEntity>("pool", "default",
+            p => p.Metadata.Annotations = new Dictionary<string, string> { ["team"] = "platform" });
+        _watcher.ApplyRunnerPool(_kubernetes.Get<V1AzDORunnerEntity>("pool")!);
+        _watcher.ApplyRunnerPool(TestEntities.CreatePool("unregistered"));
+        await _pollingService.PollAllRegisteredPools();
+
+        Assert.Empty(_azureDevOps.JobRequestReads);
+    }
+}
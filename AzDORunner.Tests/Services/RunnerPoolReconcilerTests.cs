@@ -0,0 +1,134 @@
+using AzDORunner.Entities;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using KubeOps.Abstractions.Events;
+
+namespace AzDORunner.Tests.Services;
+
+public class RunnerPoolReconcilerTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly List<(string Reason, string Message, EventType Type)> _events = new();
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly RunnerPoolReconciler _reconciler;
+
+    public RunnerPoolReconcilerTests()
+    {
+        EventPublisher eventPublisher = (_, reason, message, type, _) =>
+        {
+            lock (_events)
+            {
+                _events.Add((reason, message, type));
+            }
+
+            return Task.CompletedTask;
+        };
+
+        var metrics = new OperatorMetrics();
+        var podService = new KubernetesPodService(_kubernetes.Client, NullLogger<KubernetesPodService>.Instance, metrics);
+        var statusService = new RunnerPoolStatusService(_kubernetes.Client, NullLogger<RunnerPoolStatusService>.Instance);
+        var leaderElection = new LeaderElectionService(NullLogger<LeaderElectionService>.Instance, _kubernetes.Client);
+
+        _pollingService = new AzureDevOpsPollingService(NullLogger<AzureDevOpsPollingService>.Instance, _azureDevOps, podService,
+            _kubernetes.Client, statusService, metrics, eventPublisher, leaderElection);
+
+        _reconciler = new RunnerPoolReconciler(
+            NullLogger<RunnerPoolReconciler>.Instance,
+            _azureDevOps,
+            podService,
+            _kubernetes.Client,
+            _pollingService,
+            new ErrorPodCleanupService(NullLogger<ErrorPodCleanupService>.Instance, podService, _azureDevOps, _kubernetes.Client,
+                leaderElection, _pollingService),
+            statusService,
+            eventPublisher);
+    }
+
+    [Fact]
+    public async Task Reconcile_SetsReadyWhenConnected()
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret());
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+
+        await _reconciler.ReconcileAsync(pool, CancellationToken.None);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.Conditions.Any(c => c.Type == "Ready"));
+        Assert.Equal("Connected", updated.Status.ConnectionStatus);
+        Assert.Equal("True", GetCondition(updated, "Ready").Status);
+        Assert.Equal("False", GetCondition(updated, "Degraded").Status);
+        Assert.True(_pollingService.IsRegistered(pool));
+    }
+
+    [Fact]
+    public async Task Reconcile_MarksThePoolDegradedWhenThePatCannotBeRead()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+
+        await _reconciler.ReconcileAsync(pool, CancellationToken.None);
+
+        var updated = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.Conditions.Any(c => c.Type == "Ready"));
+        Assert.Equal("Error", updated.Status.ConnectionStatus);
+        Assert.Equal("False", GetCondition(updated, "Ready").Status);
+        Assert.Equal("True", GetCondition(updated, "Degraded").Status);
+        Assert.Contains(_events, e => e.Reason == "PATError" && e.Type == EventType.Warning);
+        Assert.False(_pollingService.IsRegistered(pool));
+    }
+
+    [Fact]
+    public async Task Reconcile_FlipsReadyOnceTheRejectedPatIsAccepted()
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret());
+        var pool = _kubernetes.Add(TestEntities.CreatePool());
+        _azureDevOps.Connection = ConnectionCheckResult.Unauthorized;
+
+        await _reconciler.ReconcileAsync(pool, CancellationToken.None);
+        var rejected = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => p.Status.Conditions.Any(c => c.Type == "Ready"));
+
+        _azureDevOps.Connection = ConnectionCheckResult.Connected;
+        await _reconciler.ReconcileAsync(pool, CancellationToken.None);
+        var accepted = await _kubernetes.WaitForAsync<V1AzDORunnerEntity>("pool", p => GetCondition(p, "Ready").Status == "True");
+
+        Assert.Equal("Unauthorized", GetCondition(rejected, "Ready").Reason);
+        Assert.Equal("True", GetCondition(rejected, "Degraded").Status);
+        Assert.Equal("Connected", GetCondition(accepted, "Ready").Reason);
+        Assert.Equal("False", GetCondition(accepted, "Degraded").Status);
+        Assert.True(GetCondition(accepted, "Ready").LastTransitionTime >= GetCondition(rejected, "Ready").LastTransitionTime);
+    }
+
+    [Fact]
+    public async Task Reconcile_PublishesAPatErrorEventWhenTheSecretIsMissing()
+    {
+        var pool = _kubernetes.Add(TestEntities.CreatePool(configure: spec => spec.PatSecretName = "missing-pat"));
+
+        await _reconciler.ReconcileAsync(pool, CancellationToken.None);
+
+        var patError = Assert.Single(_events, e => e.Reason == "PATError");
+        Assert.Equal(EventType.Warning, patError.Type);
+        Assert.Contains("missing-pat", patError.Message);
+    }
+
+    [Fact]
+    public async Task Reconcile_KeepsConcurrentlyReconciledPoolsApart()
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret(namespaceName: "team-a", value: "pat-a"));
+        _kubernetes.Add(TestEntities.CreatePatSecret(namespaceName: "team-b", value: "pat-b"));
+        var poolA = _kubernetes.Add(TestEntities.CreatePool(namespaceName: "team-a"));
+        var poolB = _kubernetes.Add(TestEntities.CreatePool(namespaceName: "team-b"));
+
+        await Task.WhenAll(
+            Task.Run(() => _reconciler.ReconcileAsync(poolA, CancellationToken.None)),
+            Task.Run(() => _reconciler.ReconcileAsync(poolB, CancellationToken.None)));
+
+        Assert.True(_pollingService.IsRegistered(poolA));
+        Assert.True(_pollingService.IsRegistered(poolB));
+        Assert.Equal("pat-a", Assert.Single(_pollingService.GetPoolsUsingSecret("team-a", "azdo-pat")).Pat);
+        Assert.Equal("pat-b", Assert.Single(_pollingService.GetPoolsUsingSecret("team-b", "azdo-pat")).Pat);
+    }
+
+    private static V1AzDORunnerEntity.StatusCondition GetCondition(V1AzDORunnerEntity entity, string type)
+    {
+        return entity.Status.Conditions.Single(c => c.Type == type);
+    }
+}
@@ -0,0 +1,87 @@
+using AzDORunner.Entities;
+using k8s.Models;
+
+namespace AzDORunner.Tests;
+
+public static class TestEntities
+{
+    public static V1AzDORunnerEntity CreatePool(string name = "pool", string namespaceName = "default",
+        Action<V1AzDORunnerEntity.V1AzDORunnerEntitySpec>? configure = null)
+    {
+        var entity = new V1AzDORunnerEntity
+        {
+            ApiVersion = "devops.opentools.mf/v1",
+            Kind = "RunnerPool",
+            Metadata = new V1ObjectMeta
+            {
+                Name = name,
+                NamespaceProperty = namespaceName,
+                Uid = Guid.NewGuid().ToString()
+            },
+            Spec = new V1AzDORunnerEntity.V1AzDORunnerEntitySpec
+            {
+                AzDoUrl = "https://dev.azure.com/myorg",
+                Pool = "self-hosted",
+                PatSecretName = "azdo-pat",
+                Image = "ghcr.io/mahmoudk1000/azdo-runner-operator/agent:latest"
+            },
+            Status = new V1AzDORunnerEntity.V1AzDORunnerEntityStatus()
+        };
+
+        configure?.Invoke(entity.Spec);
+        return entity;
+    }
+
+    public static V1Secret CreatePatSecret(string name = "azdo-pat", string namespaceName = "default", string key = "token", string value = "pat")
+    {
+        return new V1Secret
+        {
+            ApiVersion = "v1",
+            Kind = "Secret",
+            Metadata = new V1ObjectMeta { Name = name, NamespaceProperty = namespaceName },
+            Type = "Opaque",
+            Data = new Dictionary<string, byte[]> { [key] = System.Text.Encoding.UTF8.GetBytes(value) }
+        };
+    }
+
+    public static V1Pod CreateAgentPod(V1AzDORunnerEntity pool, int agentIndex, string phase = "Running", bool isMinAgent = false,
+        DateTime? createdAt = null)
+    {
+        return new V1Pod
+        {
+            ApiVersion = "v1",
+            Kind = "Pod",
+            Metadata = new V1ObjectMeta
+            {
+                Name = $"{pool.Metadata.Name}-agent-{agentIndex}",
+                NamespaceProperty = pool.Metadata.NamespaceProperty,
+                CreationTimestamp = createdAt ?? DateTime.UtcNow.AddHours(-1),
+                Labels = new Dictionary<string, string>
+                {
+                    ["app"] = "azdo-runner",
+                    ["runner-pool"] = pool.Metadata.Name,
+                    ["managed-by"] = "azdo-runner-operator",
+                    ["min-agent"] = isMinAgent.ToString().ToLower(),
+                    ["capability"] = "base"
+                },
+                OwnerReferences = new List<V1OwnerReference>
+                {
+                    new()
+                    {
+                        ApiVersion = pool.ApiVersion,
+                        Kind = pool.Kind,
+                        Name = pool.Metadata.Name,
+                        Uid = pool.Metadata.Uid,
+                        Controller = true,
+                        BlockOwnerDeletion = true
+                    }
+                }
+            },
+            Spec = new V1PodSpec
+            {
+                Containers = new List<V1Container> { new() { Name = "agent", Image = pool.Spec.Image } }
+            },
+            Status = new V1PodStatus { Phase = phase }
+        };
+    }
+}
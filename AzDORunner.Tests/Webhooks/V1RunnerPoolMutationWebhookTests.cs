@@ -0,0 +1,93 @@
+using AzDORunner.Entities;
+using AzDORunner.Webhooks;
+
+namespace AzDORunner.Tests.Webhooks;
+
+public class V1RunnerPoolMutationWebhookTests
+{
+    private readonly V1RunnerPoolMutationWebhook _webhook = new();
+
+    [Fact]
+    public void Create_DefaultsUnsetFields()
+    {
+        var pool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.ImagePullPolicy = string.Empty;
+            spec.MaxAgents = 0;
+            spec.TtlIdleSeconds = null;
+            spec.PollIntervalSeconds = 0;
+            spec.PoolType = string.Empty;
+            spec.JobsPerAgent = 0;
+            spec.SecurityContext = new V1AzDORunnerEntity.SecurityContextSpec { RunAsUser = 0, RunAsGroup = 0, FsGroup = 2000 };
+        });
+
+        var mutated = _webhook.Create(pool, false).ModifiedObject;
+
+        Assert.NotNull(mutated);
+        Assert.Equal("IfNotPresent", mutated.Spec.ImagePullPolicy);
+        Assert.Equal(5, mutated.Spec.MaxAgents);
+        Assert.Equal(10, mutated.Spec.TtlIdleSeconds);
+        Assert.Equal(30, mutated.Spec.PollIntervalSeconds);
+        Assert.Equal("automation", mutated.Spec.PoolType);
+        Assert.Equal(1, mutated.Spec.JobsPerAgent);
+        Assert.Equal(1001, mutated.Spec.SecurityContext.RunAsUser);
+        Assert.Equal(1001, mutated.Spec.SecurityContext.RunAsGroup);
+        Assert.Equal(2000, mutated.Spec.SecurityContext.FsGroup);
+    }
+
+    [Fact]
+    public void Create_KeepsFieldsThatAreSet()
+    {
+        var pool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.ImagePullPolicy = "Always";
+            spec.MaxAgents = 0;
+            spec.MinAgents = 8;
+            spec.TtlIdleSeconds = 0;
+            spec.PollIntervalSeconds = 15;
+            spec.SecurityContext = new V1AzDORunnerEntity.SecurityContextSpec { RunAsUser = 1000, RunAsGroup = 0 };
+        });
+
+        var mutated = _webhook.Create(pool, false).ModifiedObject;
+
+        Assert.NotNull(mutated);
+        Assert.Equal("Always", mutated.Spec.ImagePullPolicy);
+        Assert.Equal(8, mutated.Spec.MaxAgents);
+        Assert.Equal(0, mutated.Spec.TtlIdleSeconds);
+        Assert.Equal(15, mutated.Spec.PollIntervalSeconds);
+        Assert.Equal(1000, mutated.Spec.SecurityContext.RunAsUser);
+        Assert.Equal(1001, mutated.Spec.SecurityContext.RunAsGroup);
+    }
+
+    [Fact]
+    public void Create_LeavesAFullySetPoolUnchanged()
+    {
+        var pool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.ImagePullPolicy = "Always";
+            spec.MaxAgents = 3;
+            spec.TtlIdleSeconds = 300;
+            spec.SecurityContext = new V1AzDORunnerEntity.SecurityContextSpec { RunAsUser = 1000, RunAsGroup = 1000 };
+        });
+        pool.Metadata.Labels = new Dictionary<string, string> { ["managed-by"] = "azdo-runner-operator" };
+
+        var result = _webhook.Create(pool, false);
+
+        Assert.Null(result.ModifiedObject);
+        Assert.Equal(3, pool.Spec.MaxAgents);
+        Assert.Equal(300, pool.Spec.TtlIdleSeconds);
+        Assert.Equal(1000, pool.Spec.SecurityContext.RunAsUser);
+    }
+
+    [Fact]
+    public void Update_DefaultsUnsetFieldsOnTheNewObject()
+    {
+        var oldPool = TestEntities.CreatePool();
+        var newPool = TestEntities.CreatePool(configure: spec => spec.TtlIdleSeconds = null);
+
+        var mutated = _webhook.Update(oldPool, newPool, false).ModifiedObject;
+
+        Assert.NotNull(mutated);
+        Assert.Equal(10, mutated.Spec.TtlIdleSeconds);
+    }
+}
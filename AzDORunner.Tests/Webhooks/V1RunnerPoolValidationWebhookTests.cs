@@ -0,0 +1,613 @@
+using AzDORunner.Entities;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using AzDORunner.Tests.Fakes;
+using AzDORunner.Webhooks;
+using k8s.Models;
+
+namespace AzDORunner.Tests.Webhooks;
+
+public class V1RunnerPoolValidationWebhookTests
+{
+    private readonly FakeKubernetes _kubernetes = new();
+    private readonly FakeAzureDevOpsService _azureDevOps = new();
+    private readonly V1RunnerPoolValidationWebhook _webhook;
+
+    public V1RunnerPoolValidationWebhookTests()
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret("azdo-pat"));
+        _webhook = new V1RunnerPoolValidationWebhook(_kubernetes.Client, _azureDevOps);
+    }
+
+    [Fact]
+    public async Task Create_AllowsSelfHostedPool()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+        Assert.Empty(result.Warnings);
+    }
+
+    [Theory]
+    [InlineData("azdo-pat", null)]
+    [InlineData("missing-pat", "Secret missing-pat not found in namespace default")]
+    [InlineData("wrong-key-pat", "Secret wrong-key-pat in namespace default has no 'token' key")]
+    public async Task Create_ChecksThePatSecretHasATokenKey(string patSecretName, string? expectedError)
+    {
+        _kubernetes.Add(TestEntities.CreatePatSecret("wrong-key-pat", key: "pat"));
+
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.PatSecretName = patSecretName), false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Fact]
+    public async Task Create_WarnsWhenThePatSecretCannotBeRead()
+    {
+        _kubernetes.Intercept = request => request.Path.Contains("/secrets/")
+            ? new HttpResponseMessage(System.Net.HttpStatusCode.Forbidden)
+            : null;
+
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+        Assert.Contains(result.Warnings, w => w.Contains("Could not read secret azdo-pat"));
+        Assert.DoesNotContain(nameof(IAzureDevOpsService.LookupPoolAsync), _azureDevOps.Calls);
+    }
+
+    [Fact]
+    public async Task Create_RejectsPoolMissingFromAzureDevOps()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.Pool = "missing"), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("not found", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_RejectsHostedPool()
+    {
+        _azureDevOps.Pools.Add(new Pool { Id = 2, Name = "Azure Pipelines", IsHosted = true });
+
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.Pool = "Azure Pipelines"), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("Microsoft-hosted", result.StatusMessage);
+    }
+
+    [Theory]
+    [InlineData(ConnectionCheckResult.Unreachable)]
+    [InlineData(ConnectionCheckResult.Error)]
+    [InlineData(ConnectionCheckResult.Unauthorized)]
+    public async Task Create_WarnsInsteadOfRejectingWhenAzureDevOpsDoesNotAnswer(ConnectionCheckResult connection)
+    {
+        _azureDevOps.Connection = connection;
+
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+        Assert.Contains(result.Warnings, w => w.Contains("Could not check pool 'self-hosted'"));
+    }
+
+    [Fact]
+    public async Task Create_AllowsExtraEnvFromEachSourceKind()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.ExtraEnv = new List<V1AzDORunnerEntity.ExtraEnvVar>
+        {
+            new() { Name = "LITERAL", Value = "value" },
+            new()
+            {
+                Name = "FROM_SECRET",
+                ValueFrom = new V1EnvVarSource { SecretKeyRef = new V1SecretKeySelector { Name = "creds", Key = "password" } }
+            },
+            new()
+            {
+                Name = "FROM_CONFIGMAP",
+                ValueFrom = new V1EnvVarSource { ConfigMapKeyRef = new V1ConfigMapKeySelector { Name = "settings", Key = "region" } }
+            }
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+    }
+
+    [Fact]
+    public async Task Create_RejectsExtraEnvWithBothValueAndValueFrom()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.ExtraEnv = new List<V1AzDORunnerEntity.ExtraEnvVar>
+        {
+            new()
+            {
+                Name = "BOTH",
+                Value = "value",
+                ValueFrom = new V1EnvVarSource { SecretKeyRef = new V1SecretKeySelector { Name = "creds", Key = "password" } }
+            }
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("cannot have both Value and ValueFrom", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_RejectsConfigMapRefWithoutKey()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.ExtraEnv = new List<V1AzDORunnerEntity.ExtraEnvVar>
+        {
+            new()
+            {
+                Name = "FROM_CONFIGMAP",
+                ValueFrom = new V1EnvVarSource { ConfigMapKeyRef = new V1ConfigMapKeySelector { Name = "settings" } }
+            }
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("configMapKeyRef must specify both name and key", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_RejectsUrlThatIsNotHttp()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AzDoUrl = "ftp://dev.azure.com/myorg"), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("AzDoUrl must be a valid HTTP or HTTPS URL", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_RejectsUrlWithoutTheOrganization()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AzDoUrl = "https://dev.azure.com/"), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("AzDoUrl must include the organization", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_RejectsMinAgentsAboveMaxAgents()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.MinAgents = 4;
+            spec.MaxAgents = 2;
+        }), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("MinAgents (4) cannot be greater than MaxAgents (2)", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_RejectsEmptyImage()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.Image = ""), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("Image is required", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_ReportsEveryFailureInOneResponse()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.AzDoUrl = "not a url";
+            spec.Image = "";
+            spec.MinAgents = 4;
+            spec.MaxAgents = 2;
+        }), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("AzDoUrl must be a valid HTTP or HTTPS URL", result.StatusMessage);
+        Assert.Contains("Image is required", result.StatusMessage);
+        Assert.Contains("MinAgents (4) cannot be greater than MaxAgents (2)", result.StatusMessage);
+        Assert.Empty(_azureDevOps.Calls);
+    }
+
+    [Theory]
+    [InlineData("https://dev.azure.com/myorg")]
+    [InlineData("https://foo.visualstudio.com")]
+    public async Task Create_AllowsAzureDevOpsServicesHosts(string url)
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AzDoUrl = url), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+    }
+
+    [Fact]
+    public async Task Create_RejectsHostThatIsNotAzureDevOps()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AzDoUrl = "https://github.com/org"), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Contains("host 'github.com' is not an Azure DevOps host", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Create_AllowsOnPremisesHostWithSelfHostedAnnotation()
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.AzDoUrl = "https://tfs.corp.local/tfs/DefaultCollection");
+        pool.Metadata.Annotations = new Dictionary<string, string> { ["azdo.opentools.mf/self-hosted"] = "true" };
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+    }
+
+    [Fact]
+    public void Update_BlocksPoolRename()
+    {
+        var oldPool = TestEntities.CreatePool();
+        var newPool = TestEntities.CreatePool(configure: spec => spec.Pool = "renamed");
+
+        var result = _webhook.Update(oldPool, newPool, false);
+
+        Assert.False(result.Valid);
+        Assert.Contains("Pool cannot be changed from 'self-hosted' to 'renamed'", result.StatusMessage);
+    }
+
+    [Fact]
+    public void Update_AllowsMaxAgentsBump()
+    {
+        var oldPool = TestEntities.CreatePool(configure: spec => spec.MaxAgents = 5);
+        var newPool = TestEntities.CreatePool(configure: spec => spec.MaxAgents = 10);
+
+        var result = _webhook.Update(oldPool, newPool, false);
+
+        Assert.True(result.Valid);
+        Assert.Empty(result.Warnings);
+    }
+
+    [Fact]
+    public void Update_WarnsWhenMaxAgentsDropsBelowRunningAgents()
+    {
+        var oldPool = TestEntities.CreatePool(configure: spec => spec.MaxAgents = 5);
+        oldPool.Status.RunningAgents = 4;
+        var newPool = TestEntities.CreatePool(configure: spec => spec.MaxAgents = 2);
+
+        var result = _webhook.Update(oldPool, newPool, false);
+
+        Assert.True(result.Valid);
+        Assert.Contains(result.Warnings, w => w.Contains("MaxAgents lowered to 2 while 4 agents are running"));
+    }
+
+    [Fact]
+    public async Task Create_WarnsWhenCapabilityAgentsHaveNoRoomAboveMinAgents()
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.CapabilityAware = true;
+            spec.MinAgents = 2;
+            spec.MaxAgents = 2;
+        }), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+        Assert.Contains(result.Warnings, w => w.Contains("MaxAgents (2) leaves no room above MinAgents (2)"));
+    }
+
+    [Fact]
+    public void Update_WarnsWhenMaxAgentsCannotCoverEveryCapability()
+    {
+        var oldPool = TestEntities.CreatePool();
+        var newPool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.CapabilityAware = true;
+            spec.MaxAgents = 2;
+            spec.CapabilityImages = new Dictionary<string, string> { ["java"] = "agent:java", ["node"] = "agent:node" };
+        });
+
+        var result = _webhook.Update(oldPool, newPool, false);
+
+        Assert.True(result.Valid);
+        Assert.Contains(result.Warnings, w => w.Contains("3 capabilities (including base) but MaxAgents is 2"));
+    }
+
+    [Theory]
+    [InlineData(false, 1, 1)]
+    [InlineData(true, 0, 5)]
+    public async Task Create_DoesNotWarnAboutCapacityWhenCapabilityAgentsFit(bool capabilityAware, int minAgents, int maxAgents)
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec =>
+        {
+            spec.CapabilityAware = capabilityAware;
+            spec.MinAgents = minAgents;
+            spec.MaxAgents = maxAgents;
+            spec.CapabilityImages = new Dictionary<string, string> { ["java"] = "agent:java" };
+        }), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+        Assert.Empty(result.Warnings);
+    }
+
+    [Fact]
+    public async Task Delete_RejectsAProtectedPoolWithRunningJobs()
+    {
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            AssignTime = DateTime.UtcNow,
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+        });
+
+        var result = await _webhook.DeleteAsync(CreateProtectedPool(), false, CancellationToken.None);
+
+        Assert.False(result.Valid);
+        Assert.Equal(409, result.StatusCode);
+        Assert.Contains("has 1 running jobs", result.StatusMessage);
+    }
+
+    [Fact]
+    public async Task Delete_AllowsAProtectedIdlePool()
+    {
+        _azureDevOps.JobRequests.Add(new JobRequest { RequestId = 42, QueueTime = DateTime.UtcNow });
+
+        var result = await _webhook.DeleteAsync(CreateProtectedPool(), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+    }
+
+    [Fact]
+    public async Task Delete_AllowsAnUnprotectedPoolWithRunningJobs()
+    {
+        _azureDevOps.JobRequests.Add(new JobRequest
+        {
+            RequestId = 42,
+            AssignTime = DateTime.UtcNow,
+            ReservedAgent = new Agent { Id = 1, Name = "pool-agent-0" }
+        });
+
+        var result = await _webhook.DeleteAsync(TestEntities.CreatePool(), false, CancellationToken.None);
+
+        Assert.True(result.Valid);
+        Assert.DoesNotContain(nameof(IAzureDevOpsService.GetRunningJobsCountAsync), _azureDevOps.Calls);
+    }
+
+    private static V1AzDORunnerEntity CreateProtectedPool()
+    {
+        var pool = TestEntities.CreatePool();
+        pool.Metadata.Annotations = new Dictionary<string, string> { ["azdo.opentools.mf/protect-while-busy"] = "true" };
+        return pool;
+    }
+
+    [Theory]
+    [InlineData("workspace", "/workspace", "10Gi", null)]
+    [InlineData("cache", "/cache", "500Mi", null)]
+    [InlineData("big", "/data", "1Ti", null)]
+    [InlineData("workspace", "/workspace", "10GG", "invalid storage quantity '10GG'")]
+    [InlineData("workspace", "/workspace", "10gi", "invalid storage quantity '10gi'")]
+    [InlineData("workspace", "/workspace", "0", "invalid storage quantity '0'")]
+    [InlineData("workspace", "workspace", "10Gi", "must be an absolute path")]
+    [InlineData("Workspace", "/workspace", "10Gi", "Invalid PVC name 'Workspace'")]
+    [InlineData("work_space", "/workspace", "10Gi", "Invalid PVC name 'work_space'")]
+    public async Task Create_ValidatesPvcNamesPathsAndSizes(string name, string mountPath, string storage, string? expectedError)
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Pvcs = new List<V1AzDORunnerEntity.PvcSpec>
+        {
+            new() { Name = name, MountPath = mountPath, Storage = storage }
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData(4, 0, "PollIntervalSeconds must be at least 5 seconds")]
+    [InlineData(30, -1, "DrainTimeoutSeconds must be a non-negative value")]
+    [InlineData(5, 0, null)]
+    public async Task Create_ValidatesPollIntervalAndDrainTimeout(int pollIntervalSeconds, int drainTimeoutSeconds, string? expectedError)
+    {
+        var pool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.PollIntervalSeconds = pollIntervalSeconds;
+            spec.DrainTimeoutSeconds = drainTimeoutSeconds;
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData(1, 3, null)]
+    [InlineData(3, 2, "CapabilityScaling 'java' MinAgents (3) cannot be greater than its MaxAgents (2)")]
+    [InlineData(0, 6, "CapabilityScaling MaxAgents add up to 8, more than the pool's MaxAgents (5)")]
+    public async Task Create_ValidatesCapabilityScaling(int javaMinAgents, int javaMaxAgents, string? expectedError)
+    {
+        var pool = TestEntities.CreatePool(configure: spec =>
+        {
+            spec.MaxAgents = 5;
+            spec.CapabilityAware = true;
+            spec.CapabilityImages = new Dictionary<string, string> { ["java"] = "agent:java" };
+            spec.CapabilityScaling = new Dictionary<string, V1AzDORunnerEntity.CapabilityScalingSpec>
+            {
+                ["java"] = new() { MinAgents = javaMinAgents, MaxAgents = javaMaxAgents },
+                ["base"] = new() { MaxAgents = 2 }
+            };
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData(1, null)]
+    [InlineData(4, null)]
+    [InlineData(-1, "JobsPerAgent must be at least 1")]
+    public async Task Create_ValidatesJobsPerAgent(int jobsPerAgent, string? expectedError)
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.JobsPerAgent = jobsPerAgent), false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData("500m", "2", null)]
+    [InlineData("1", "1", null)]
+    [InlineData("2", "500m", "Resources.Limits 'cpu' (500m) cannot be lower than Resources.Requests 'cpu' (2)")]
+    [InlineData("lots", "2", "Resources.Requests 'cpu' has invalid quantity 'lots'")]
+    public async Task Create_ValidatesResourceRequestsAgainstLimits(string request, string limit, string? expectedError)
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Resources = new V1AzDORunnerEntity.ResourcesSpec
+        {
+            Requests = new Dictionary<string, string> { ["cpu"] = request },
+            Limits = new Dictionary<string, string> { ["cpu"] = limit }
+        });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData("team-a-ci", null)]
+    [InlineData("Team_A", "AgentNamePrefix 'Team_A' must be a valid Kubernetes name")]
+    [InlineData("a-prefix-that-leaves-no-room-for-the-agent-index-suffix", "of at most 50 characters")]
+    public async Task Create_ValidatesAgentNamePrefix(string prefix, string? expectedError)
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AgentNamePrefix = prefix), false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData("acr-pull", null)]
+    [InlineData("", "ImagePullSecrets entries must be non-empty secret names")]
+    [InlineData("ACR_Pull", "Invalid image pull secret name 'ACR_Pull'")]
+    public async Task Create_ValidatesImagePullSecretNames(string secretName, string? expectedError)
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.ImagePullSecrets = new List<string> { secretName });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData("http://proxy.corp:3128", null)]
+    [InlineData("https://proxy.corp", null)]
+    [InlineData("proxy.corp:3128", "Proxy.HttpsProxy 'proxy.corp:3128' must be an absolute HTTP or HTTPS URL")]
+    [InlineData("socks5://proxy.corp:1080", "Proxy.HttpsProxy 'socks5://proxy.corp:1080' must be an absolute HTTP or HTTPS URL")]
+    public async Task Create_ValidatesProxyUrls(string proxyUrl, string? expectedError)
+    {
+        var pool = TestEntities.CreatePool(configure: spec => spec.Proxy = new V1AzDORunnerEntity.ProxySpec { HttpsProxy = proxyUrl });
+
+        var result = await _webhook.CreateAsync(pool, false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+
+    [Theory]
+    [InlineData("automation", null)]
+    [InlineData("deployment", "PoolType 'deployment' is not supported yet")]
+    [InlineData("environment", "PoolType must be 'automation', got 'environment'")]
+    public async Task Create_AcceptsOnlyAutomationPools(string poolType, string? expectedError)
+    {
+        var result = await _webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.PoolType = poolType), false, CancellationToken.None);
+
+        if (expectedError == null)
+        {
+            Assert.True(result.Valid, result.StatusMessage);
+        }
+        else
+        {
+            Assert.False(result.Valid);
+            Assert.Contains(expectedError, result.StatusMessage);
+        }
+    }
+}
+
+[Collection(EnvironmentCollection.Name)]
+public class V1RunnerPoolValidationWebhookSettingsTests
+{
+    [Fact]
+    public async Task Create_AllowsOnPremisesHostFromAllowedHosts()
+    {
+        using var _ = new EnvironmentVariableScope(("AZDO_ALLOWED_HOSTS", "tfs.corp.local, other.corp.local"));
+        var kubernetes = new FakeKubernetes();
+        kubernetes.Add(TestEntities.CreatePatSecret("azdo-pat"));
+        var webhook = new V1RunnerPoolValidationWebhook(kubernetes.Client, new FakeAzureDevOpsService());
+
+        var allowed = await webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AzDoUrl = "https://tfs.corp.local/tfs/DefaultCollection"), false, CancellationToken.None);
+        var rejected = await webhook.CreateAsync(TestEntities.CreatePool(configure: spec => spec.AzDoUrl = "https://tfs.elsewhere.local/tfs/DefaultCollection"), false, CancellationToken.None);
+
+        Assert.True(allowed.Valid);
+        Assert.False(rejected.Valid);
+    }
+}
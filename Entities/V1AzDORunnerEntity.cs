@@ -14,6 +14,7 @@ namespace AzDORunner.Entities;
 [GenericAdditionalPrinterColumn(".status.queuedJobs", "Queued", "integer")]
 [GenericAdditionalPrinterColumn(".status.agentsSummary", "Agents", "string")]
 [GenericAdditionalPrinterColumn(".status.runningAgents", "Running", "integer")]
+[GenericAdditionalPrinterColumn(".status.onlineAgents", "Online", "integer")]
 public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1AzDORunnerEntitySpec, V1AzDORunnerEntity.V1AzDORunnerEntityStatus>
 {
     public class ExtraEnvVar
@@ -52,6 +53,15 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
         public string SecretName { get; set; } = string.Empty;
     }
 
+    public class CapabilityScalingSpec
+    {
+        [Range(0, int.MaxValue, ErrorMessage = "MinAgents must be a non-negative value")]
+        public int MinAgents { get; set; } = 0;
+
+        // Unset means only the pool's MaxAgents applies
+        public int? MaxAgents { get; set; }
+    }
+
     public class InitContainerSpec
     {
         public string Image { get; set; } = "busybox:latest";
@@ -64,6 +74,39 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
         public int RunAsGroup { get; set; } = 1001;
 
         public int FsGroup { get; set; } = 1001;
+
+        public bool Privileged { get; set; } = false;
+    }
+
+    public class ProxySpec
+    {
+        public string? HttpProxy { get; set; }
+
+        public string? HttpsProxy { get; set; }
+
+        public string? NoProxy { get; set; }
+    }
+
+    public class PodTemplateSpec
+    {
+        public Dictionary<string, string> Labels { get; set; } = new();
+
+        public Dictionary<string, string> Annotations { get; set; } = new();
+    }
+
+    public class ResourcesSpec
+    {
+        public Dictionary<string, string> Requests { get; set; } = new()
+        {
+            ["cpu"] = "100m",
+            ["memory"] = "256Mi"
+        };
+
+        public Dictionary<string, string> Limits { get; set; } = new()
+        {
+            ["cpu"] = "2",
+            ["memory"] = "4Gi"
+        };
     }
 
     public class V1AzDORunnerEntitySpec : IValidatableObject
@@ -74,6 +117,8 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
         [DataAnnotationsRequired]
         public string Pool { get; set; } = string.Empty;
 
+        public string PoolType { get; set; } = "automation";
+
         [DataAnnotationsRequired]
         public string PatSecretName { get; set; } = string.Empty;
 
@@ -82,20 +127,59 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
 
         public string ImagePullPolicy { get; set; } = "IfNotPresent";
 
+        public List<string> ImagePullSecrets { get; set; } = new();
+
+        // Passed to the agent as AZP_WORK, the agent image falls back to "_work"
+        public string? WorkDir { get; set; }
+
+        // Defaults to the RunnerPool name, agents are named "<prefix>-agent-<index>"
+        public string? AgentNamePrefix { get; set; }
+
+        // Active scales the pool, DryRun only reports what would be done
+        public string Mode { get; set; } = "Active";
+
+        // OnDelete keeps agents on their image until they go away, RollingRecreate replaces them
+        public string UpdateStrategy { get; set; } = "OnDelete";
+
         public bool CapabilityAware { get; set; } = false;
 
         public Dictionary<string, string> CapabilityImages { get; set; } = new();
 
+        // Keyed by a CapabilityImages name or "base"
+        public Dictionary<string, CapabilityScalingSpec> CapabilityScaling { get; set; } = new();
+
+        public const int DefaultTtlIdleSeconds = 10;
+
+        public const int DefaultMaxAgents = 5;
+
+        // Unset means DefaultTtlIdleSeconds, an explicit 0 runs one-time agents
         [Range(0, int.MaxValue, ErrorMessage = "TtlIdleSeconds must be a non-negative value")]
-        public int TtlIdleSeconds { get; set; } = 0;
+        public int? TtlIdleSeconds { get; set; }
 
         [Range(0, int.MaxValue, ErrorMessage = "MinAgents must be a non-negative value")]
         public int MinAgents { get; set; } = 0;
 
         [Range(1, int.MaxValue, ErrorMessage = "MaxAgents must be at least 1")]
-        public int MaxAgents { get; set; } = 10;
+        public int MaxAgents { get; set; } = DefaultMaxAgents;
+
+        [Range(5, int.MaxValue, ErrorMessage = "PollIntervalSeconds must be at least 5 seconds")]
+        public int PollIntervalSeconds { get; set; } = 30;
+
+        [Range(0, int.MaxValue, ErrorMessage = "DrainTimeoutSeconds must be a non-negative value")]
+        public int DrainTimeoutSeconds { get; set; } = 600;
+
+        [Range(1, int.MaxValue, ErrorMessage = "MaxSurge must be at least 1")]
+        public int MaxSurge { get; set; } = 3;
+
+        [Range(1, int.MaxValue, ErrorMessage = "JobsPerAgent must be at least 1")]
+        public int JobsPerAgent { get; set; } = 1;
+
+        [Range(0, int.MaxValue, ErrorMessage = "ScaleDownStabilizationSeconds must be a non-negative value")]
+        public int ScaleDownStabilizationSeconds { get; set; } = 0;
 
-        public int PollIntervalSeconds { get; set; } = 5;
+        // 0 leaves stuck job requests alone
+        [Range(0, int.MaxValue, ErrorMessage = "StuckJobTimeoutSeconds must be a non-negative value")]
+        public int StuckJobTimeoutSeconds { get; set; } = 0;
 
         public List<ExtraEnvVar> ExtraEnv { get; set; } = new();
 
@@ -107,6 +191,23 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
 
         public SecurityContextSpec SecurityContext { get; set; } = new();
 
+        public ResourcesSpec Resources { get; set; } = new();
+
+        public PodTemplateSpec? PodTemplate { get; set; }
+
+        public ProxySpec? Proxy { get; set; }
+
+        public Dictionary<string, string>? NodeSelector { get; set; }
+
+        public List<V1Toleration>? Tolerations { get; set; }
+
+        public V1Affinity? Affinity { get; set; }
+
+        public int GetTtlIdleSeconds()
+        {
+            return TtlIdleSeconds ?? DefaultTtlIdleSeconds;
+        }
+
         public IEnumerable<ValidationResult> Validate(ValidationContext validationContext)
         {
             var validImagePullPolicies = new[] { "Always", "IfNotPresent", "Never" };
@@ -117,6 +218,22 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
                     new[] { nameof(ImagePullPolicy) });
             }
 
+            var validModes = new[] { "Active", "DryRun" };
+            if (!string.IsNullOrEmpty(Mode) && !validModes.Contains(Mode))
+            {
+                yield return new ValidationResult(
+                    $"Mode must be one of: {string.Join(", ", validModes)}",
+                    new[] { nameof(Mode) });
+            }
+
+            var validUpdateStrategies = new[] { "OnDelete", "RollingRecreate" };
+            if (!string.IsNullOrEmpty(UpdateStrategy) && !validUpdateStrategies.Contains(UpdateStrategy))
+            {
+                yield return new ValidationResult(
+                    $"UpdateStrategy must be one of: {string.Join(", ", validUpdateStrategies)}",
+                    new[] { nameof(UpdateStrategy) });
+            }
+
             if (PollIntervalSeconds < 5)
             {
                 yield return new ValidationResult(
@@ -124,6 +241,20 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
                     new[] { nameof(PollIntervalSeconds) });
             }
 
+            if (MaxSurge < 1)
+            {
+                yield return new ValidationResult(
+                    "MaxSurge must be at least 1",
+                    new[] { nameof(MaxSurge) });
+            }
+
+            if (JobsPerAgent < 1)
+            {
+                yield return new ValidationResult(
+                    "JobsPerAgent must be at least 1",
+                    new[] { nameof(JobsPerAgent) });
+            }
+
             if (MinAgents > MaxAgents)
             {
                 yield return new ValidationResult(
@@ -233,16 +364,54 @@ public class V1AzDORunnerEntity : CustomKubernetesEntity<V1AzDORunnerEntity.V1Az
     {
         public string ConnectionStatus { get; set; } = "Disconnected";
         public string OrganizationName { get; set; } = string.Empty;
+        public string PoolName { get; set; } = string.Empty;
         public string AgentsSummary { get; set; } = "0/0";
         public bool Active { get; set; } = false;
         public int QueuedJobs { get; set; } = 0;
+        public int RunningJobs { get; set; } = 0;
         public int RunningAgents { get; set; } = 0;
+        public int OnlineAgents { get; set; } = 0;
+        public int WarmingAgents { get; set; } = 0;
+        public int OutdatedAgents { get; set; } = 0;
+        public int OutdatedPods { get; set; } = 0;
+        public int DesiredAgents { get; set; } = 0;
+        public int CurrentAgents { get; set; } = 0;
+        public DateTime? LastScaleTime { get; set; }
         public int CurrentAgentIndex { get; set; } = 0;
         public DateTime? LastPolled { get; set; }
+        public DateTime? LastDemandTime { get; set; }
         public string? LastError { get; set; }
+        public int ConsecutiveFailures { get; set; } = 0;
         public List<Agent> Agents { get; set; } = new();
         public List<StatusCondition> Conditions { get; set; } = new();
         public Dictionary<int, AgentIndexInfo> AgentIndexes { get; set; } = new();
+
+        public void SetCondition(string type, string status, string reason, string message)
+        {
+            var existing = Conditions.FirstOrDefault(c => c.Type == type);
+            if (existing == null)
+            {
+                Conditions.Add(new StatusCondition
+                {
+                    Type = type,
+                    Status = status,
+                    Reason = reason,
+                    Message = message,
+                    LastTransitionTime = DateTime.UtcNow
+                });
+                return;
+            }
+
+            // Only move the transition time when the status actually flips
+            if (existing.Status != status)
+            {
+                existing.LastTransitionTime = DateTime.UtcNow;
+            }
+
+            existing.Status = status;
+            existing.Reason = reason;
+            existing.Message = message;
+        }
     }
 
     public class StatusCondition
@@ -1,5 +1,6 @@
 ﻿using AzDORunner.Entities;
 using AzDORunner.Services;
+using k8s;
 using KubeOps.Abstractions.Finalizer;
 
 namespace AzDORunner.Finalizer;
@@ -8,17 +9,43 @@ public class RunnerPoolFinalizer : IEntityFinalizer<V1AzDORunnerEntity>
 {
     private readonly ILogger<RunnerPoolFinalizer> _logger;
     private readonly KubernetesPodService _kubernetesPodService;
+    private readonly IAzureDevOpsService _azureDevOpsService;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly ErrorPodCleanupService _errorPodCleanupService;
+    private readonly ReconcileDispatcher _reconcileDispatcher;
 
-    public RunnerPoolFinalizer(ILogger<RunnerPoolFinalizer> logger, KubernetesPodService kubernetesPodService)
+    public RunnerPoolFinalizer(
+        ILogger<RunnerPoolFinalizer> logger,
+        KubernetesPodService kubernetesPodService,
+        IAzureDevOpsService azureDevOpsService,
+        IKubernetes kubernetesClient,
+        AzureDevOpsPollingService pollingService,
+        ErrorPodCleanupService errorPodCleanupService,
+        ReconcileDispatcher reconcileDispatcher)
     {
         _logger = logger;
         _kubernetesPodService = kubernetesPodService;
+        _azureDevOpsService = azureDevOpsService;
+        _kubernetesClient = kubernetesClient;
+        _pollingService = pollingService;
+        _errorPodCleanupService = errorPodCleanupService;
+        _reconcileDispatcher = reconcileDispatcher;
     }
 
     public async Task FinalizeAsync(V1AzDORunnerEntity entity, CancellationToken cancellationToken)
     {
         _logger.LogInformation("Finalizing RunnerPool {Name}, cleaning up all agent pods", entity.Metadata.Name);
 
+        // Stop monitoring first, otherwise the next poll recreates the pods deleted below.
+        // The controller's DeletedAsync only runs once the finalizer is gone. A reconcile still
+        // running could register the pool again, so it has to finish before unregistering.
+        await _reconcileDispatcher.ForgetAsync(entity);
+        _pollingService.UnregisterPool(entity);
+        _errorPodCleanupService.UnregisterPool(entity);
+
+        // Cleanup is best effort, throwing here would keep the RunnerPool stuck in Terminating.
+        // The pods are owned by the RunnerPool, so the garbage collector removes whatever we miss.
         try
         {
             var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
@@ -56,13 +83,82 @@ public class RunnerPoolFinalizer : IEntityFinalizer<V1AzDORunnerEntity>
                         pod.Metadata.Name, pod.Status?.Phase);
                 }
             }
+        }
+        catch (Exception ex)
+        {
+            _logger.LogWarning(ex, "Error cleaning up pods of RunnerPool {Name}, deleting them by label instead", entity.Metadata.Name);
+            await _kubernetesPodService.DeleteAllRunnerPodsAsync(entity);
+        }
+
+        // 4. Delete the PVCs marked deleteWithAgent and keep the rest, while the RunnerPool still holds the finalizer
+        try
+        {
+            var deletedPvcs = await _kubernetesPodService.CleanupPoolPvcsAsync(entity);
+            _logger.LogInformation("Deleted {PvcCount} PVCs of RunnerPool {Name}", deletedPvcs, entity.Metadata.Name);
+        }
+        catch (Exception ex)
+        {
+            _logger.LogWarning(ex, "Error cleaning up PVCs of RunnerPool {Name}", entity.Metadata.Name);
+        }
+
+        // 5. Unregister the agents of the deleted pods so they don't linger offline in the pool
+        try
+        {
+            await UnregisterAgentsAsync(entity);
+        }
+        catch (Exception ex)
+        {
+            _logger.LogWarning(ex, "Error unregistering agents of RunnerPool {Name}, they have to be removed from Azure DevOps manually",
+                entity.Metadata.Name);
+        }
+
+        _logger.LogInformation("Finalized RunnerPool {Name}", entity.Metadata.Name);
+    }
+
+    private async Task UnregisterAgentsAsync(V1AzDORunnerEntity entity)
+    {
+        var pat = await GetPatFromSecretAsync(entity);
+        if (string.IsNullOrEmpty(pat))
+        {
+            _logger.LogWarning("No PAT available for RunnerPool {Name}, leaving its agents registered in Azure DevOps",
+                entity.Metadata.Name);
+            return;
+        }
+
+        // The pool may have been deleted or renamed in Azure DevOps, there is nothing left to unregister then
+        var pool = await _azureDevOpsService.GetPoolAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+        if (pool == null)
+        {
+            _logger.LogWarning("Pool '{PoolName}' not found in Azure DevOps, skipping agent unregistration for RunnerPool {Name}",
+                entity.Spec.Pool, entity.Metadata.Name);
+            return;
+        }
+
+        var agents = await _azureDevOpsService.GetPoolAgentsAsync(entity.Spec.AzDoUrl, pool.Name, pat);
+        foreach (var agent in agents.Where(a => AzureDevOpsPollingService.IsOperatorManagedAgent(a.Name, entity)))
+        {
+            if (await _azureDevOpsService.UnregisterAgentAsync(entity.Spec.AzDoUrl, pool.Name, agent.Name, pat))
+            {
+                _logger.LogInformation("Unregistered agent '{AgentName}' during RunnerPool finalization", agent.Name);
+            }
+        }
+    }
+
+    private async Task<string?> GetPatFromSecretAsync(V1AzDORunnerEntity entity)
+    {
+        try
+        {
+            var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+            var secret = await _kubernetesClient.CoreV1.ReadNamespacedSecretAsync(entity.Spec.PatSecretName, namespaceName);
 
-            _logger.LogInformation("Successfully finalized RunnerPool {Name} - all agent pods cleaned up", entity.Metadata.Name);
+            return secret?.Data?.TryGetValue("token", out var tokenBytes) == true
+                ? System.Text.Encoding.UTF8.GetString(tokenBytes)
+                : null;
         }
         catch (Exception ex)
         {
-            _logger.LogError(ex, "Error finalizing RunnerPool {Name}", entity.Metadata.Name);
-            throw;
+            _logger.LogWarning(ex, "Failed to get PAT from secret {SecretName}", entity.Spec.PatSecretName);
+            return null;
         }
     }
 }
@@ -0,0 +1,67 @@
+namespace AzDORunner.Model.Domain;
+
+public class AzureDevOpsUrl
+{
+    public Uri Uri { get; private set; } = null!;
+
+    // Organization for Azure DevOps Services, collection for Azure DevOps Server
+    public string Organization { get; private set; } = string.Empty;
+
+    public bool IsCloud { get; private set; }
+
+    // Accepts:
+    // Cloud: https://dev.azure.com/organization
+    // Cloud: https://organization.visualstudio.com[/DefaultCollection]
+    // On-premises: https://server/tfs/CollectionName
+    // On-premises: https://server/CollectionName
+    public static bool TryParse(string? url, out AzureDevOpsUrl result)
+    {
+        result = null!;
+
+        if (string.IsNullOrWhiteSpace(url) ||
+            !Uri.TryCreate(url.Trim(), UriKind.Absolute, out var uri) ||
+            (uri.Scheme != Uri.UriSchemeHttps && uri.Scheme != Uri.UriSchemeHttp) ||
+            !string.IsNullOrEmpty(uri.Query) || !string.IsNullOrEmpty(uri.Fragment))
+        {
+            return false;
+        }
+
+        var segments = uri.AbsolutePath
+            .Split('/', StringSplitOptions.RemoveEmptyEntries)
+            .Select(Uri.UnescapeDataString)
+            .ToList();
+
+        string? organization;
+        var isCloud = true;
+
+        if (uri.Host.Equals("dev.azure.com", StringComparison.OrdinalIgnoreCase))
+        {
+            organization = segments.FirstOrDefault();
+        }
+        else if (uri.Host.EndsWith(".visualstudio.com", StringComparison.OrdinalIgnoreCase))
+        {
+            organization = uri.Host.Split('.')[0];
+        }
+        else
+        {
+            // Azure DevOps Server always has the collection in the path, optionally behind the /tfs virtual directory
+            isCloud = false;
+            var index = segments.Count > 0 && segments[0].Equals("tfs", StringComparison.OrdinalIgnoreCase) ? 1 : 0;
+            organization = segments.ElementAtOrDefault(index);
+        }
+
+        // Segments starting with "_" are routes such as _apis or _settings, never an organization or collection
+        if (string.IsNullOrWhiteSpace(organization) || organization.StartsWith('_'))
+        {
+            return false;
+        }
+
+        result = new AzureDevOpsUrl
+        {
+            Uri = uri,
+            Organization = organization,
+            IsCloud = isCloud
+        };
+        return true;
+    }
+}
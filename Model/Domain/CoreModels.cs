@@ -15,6 +15,32 @@ namespace AzDORunner.Model.Domain
         public DateTime? CreatedOn { get; set; }
 
         public LastCompletedRequest? LastCompletedRequest { get; set; }
+
+        public string? Version { get; set; }
+
+        // When the agent last went online or offline
+        public DateTime? StatusChangedOn { get; set; }
+
+        // Set by Azure DevOps when it has asked the agent to update itself
+        public AgentPendingUpdate? PendingUpdate { get; set; }
+    }
+
+    public static class AgentExtensions
+    {
+        public static bool IsOfflineLongerThan(this Agent agent, TimeSpan age)
+        {
+            if (!string.Equals(agent.Status, "offline", StringComparison.OrdinalIgnoreCase))
+                return false;
+
+            // Fall back to the last finished job, then registration, when Azure DevOps doesn't say
+            var offlineSince = agent.StatusChangedOn ?? agent.LastActive ?? agent.CreatedAt;
+            return DateTime.UtcNow - offlineSince.ToUniversalTime() > age;
+        }
+    }
+
+    public class AgentPendingUpdate
+    {
+        public DateTime? RequestTime { get; set; }
     }
 
     public class LastCompletedRequest
@@ -27,6 +53,14 @@ namespace AzDORunner.Model.Domain
         public int Id { get; set; }
 
         public string Name { get; set; } = string.Empty;
+
+        // "automation" for pipeline agent pools, "deployment" for deployment groups/environments
+        public string PoolType { get; set; } = "automation";
+
+        // Microsoft-hosted pools are served by Azure DevOps itself
+        public bool IsHosted { get; set; }
+
+        public int Size { get; set; }
     }
 
     public class JobRequest
@@ -39,9 +73,90 @@ namespace AzDORunner.Model.Domain
 
         public DateTime QueueTime { get; set; }
 
+        public DateTime? AssignTime { get; set; }
+
+        public DateTime? ReceiveTime { get; set; }
+
+        public DateTime? FinishTime { get; set; }
+
+        public Agent? ReservedAgent { get; set; }
+
+        public JobDefinition? Definition { get; set; }
+
         public List<string> Demands { get; set; } = new();
 
         public string? RequiredCapability { get; set; }
+
+        // Waiting for an agent to pick it up
+        public bool IsQueued => Result == null && ReservedAgent == null && AssignTime == null && ReceiveTime == null;
+
+        // Assigned to an agent but not finished yet
+        public bool IsRunning => Result == null && FinishTime == null && (ReservedAgent != null || AssignTime != null);
+    }
+
+    public class JobDefinition
+    {
+        public int Id { get; set; }
+
+        public string Name { get; set; } = string.Empty;
+    }
+
+    public class Demand
+    {
+        public string Name { get; set; } = string.Empty;
+
+        public string? Operator { get; set; }
+
+        public string? Value { get; set; }
+
+        // Demands are either a bare name ("java") or "name -operator value" ("Agent.Version -gtVersion 2.0")
+        public static Demand Parse(string demand)
+        {
+            var parts = demand.Trim().Split(' ', 3, StringSplitOptions.RemoveEmptyEntries | StringSplitOptions.TrimEntries);
+            if (parts.Length == 0)
+            {
+                return new Demand();
+            }
+
+            if (parts.Length == 1 || !parts[1].StartsWith('-'))
+            {
+                return new Demand { Name = parts[0] };
+            }
+
+            return new Demand
+            {
+                Name = parts[0],
+                Operator = parts[1].TrimStart('-'),
+                Value = parts.Length > 2 ? parts[2] : null
+            };
+        }
+    }
+
+    public enum ConnectionCheckResult
+    {
+        Connected,
+        Unauthorized,
+        NotFound,
+        Unreachable,
+        Error
+    }
+
+    public enum PoolLookupStatus
+    {
+        Found,
+        NotFound,
+        Ambiguous,
+        Unavailable
+    }
+
+    // Unlike GetPoolAsync, tells a pool that doesn't exist apart from an Azure DevOps that didn't answer
+    public class PoolLookup
+    {
+        public PoolLookupStatus Status { get; set; }
+
+        public Pool? Pool { get; set; }
+
+        public string? Error { get; set; }
     }
 
     public class AgentCapability
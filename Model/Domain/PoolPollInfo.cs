@@ -11,5 +11,18 @@ namespace AzDORunner.Model.Domain
         public DateTime LastPolled { get; set; } = DateTime.MinValue;
 
         public int PollIntervalSeconds { get; set; } = 10;
+
+        public bool ScaleUpPending { get; set; } = false;
+
+        public DateTime? LastDemandTime { get; set; }
+
+        public int ConsecutiveFailures { get; set; } = 0;
+
+        public DateTime? FailingSince { get; set; }
+
+        public bool Paused { get; set; } = false;
+
+        // Stuck job requests Azure DevOps refused to cancel, surfaced once instead of retried every poll
+        public HashSet<int> UncancelableJobRequests { get; set; } = new();
     }
 }
\ No newline at end of file
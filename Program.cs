@@ -1,8 +1,17 @@
+using KubeOps.Abstractions.Events;
 using KubeOps.Operator;
 using AzDORunner.Services;
 using k8s;
 
 var builder = WebApplication.CreateBuilder(args);
+
+// One JSON object per line, including scopes such as runner-pool and agent-index
+if (string.Equals(Environment.GetEnvironmentVariable("LOG_FORMAT"), "json", StringComparison.OrdinalIgnoreCase))
+{
+    builder.Logging.ClearProviders();
+    builder.Logging.AddJsonConsole(o => o.IncludeScopes = true);
+}
+
 var kubernetesClientConfig = KubernetesClientConfiguration.BuildDefaultConfig();
 
 builder.Services
@@ -18,14 +27,22 @@ builder.Services.AddSingleton<IKubernetes>(_ => new Kubernetes(kubernetesClientC
 
 builder.Services.AddControllers(o => o.SuppressImplicitRequiredAttributeForNonNullableReferenceTypes = true);
 
-builder.Services.AddHttpClient<IAzureDevOpsService, AzureDevOpsService>();
+builder.Services.AddSingleton<AzureDevOpsPoolCache>();
+builder.Services.AddHttpClient<IAzureDevOpsService, AzureDevOpsService>()
+    .ConfigurePrimaryHttpMessageHandler(AzureDevOpsService.CreateHttpHandler);
+builder.Services.AddSingleton<OperatorMetrics>();
 builder.Services.AddSingleton<KubernetesPodService>();
 builder.Services.AddSingleton<IRunnerPoolStatusService, RunnerPoolStatusService>();
+builder.Services.AddSingleton<ReconcileDispatcher>();
+builder.Services.AddScoped<RunnerPoolReconciler>();
 
 builder.Services.AddSingleton<AzDORunner.Services.WebhookCertificateManager>();
 builder.Services.AddSingleton<AzDORunner.Services.WebhookCertificateBackgroundService>();
 builder.Services.AddHostedService(provider => provider.GetRequiredService<AzDORunner.Services.WebhookCertificateBackgroundService>());
 
+builder.Services.AddSingleton<LeaderElectionService>();
+builder.Services.AddHostedService(provider => provider.GetRequiredService<LeaderElectionService>());
+
 builder.Services.AddSingleton<AzureDevOpsPollingService>(provider =>
 {
     var pollingService = new AzureDevOpsPollingService(
@@ -33,7 +50,10 @@ builder.Services.AddSingleton<AzureDevOpsPollingService>(provider =>
         provider.GetRequiredService<IAzureDevOpsService>(),
         provider.GetRequiredService<KubernetesPodService>(),
         provider.GetRequiredService<IKubernetes>(),
-        provider.GetRequiredService<IRunnerPoolStatusService>());
+        provider.GetRequiredService<IRunnerPoolStatusService>(),
+        provider.GetRequiredService<OperatorMetrics>(),
+        provider.GetRequiredService<EventPublisher>(),
+        provider.GetRequiredService<LeaderElectionService>());
     return pollingService;
 });
 builder.Services.AddHostedService(provider => provider.GetRequiredService<AzureDevOpsPollingService>());
@@ -44,15 +64,29 @@ builder.Services.AddSingleton<ErrorPodCleanupService>(provider =>
         provider.GetRequiredService<ILogger<ErrorPodCleanupService>>(),
         provider.GetRequiredService<KubernetesPodService>(),
         provider.GetRequiredService<IAzureDevOpsService>(),
-        provider.GetRequiredService<IKubernetes>());
+        provider.GetRequiredService<IKubernetes>(),
+        provider.GetRequiredService<LeaderElectionService>(),
+        provider.GetRequiredService<AzureDevOpsPollingService>());
     return errorCleanupService;
 });
 builder.Services.AddHostedService(provider => provider.GetRequiredService<ErrorPodCleanupService>());
 
+builder.Services.AddHealthChecks()
+    .AddCheck<AzureDevOpsHealthCheck>("azure-devops");
+
+builder.Services.AddHostedService<PatSecretWatcherService>();
+builder.Services.AddHostedService<AgentPodWatcherService>();
+builder.Services.AddHostedService<RunnerPoolPauseWatcherService>();
+
 var app = builder.Build();
 
 app.UseRouting();
 
 app.MapControllers();
 
+app.MapGet("/metrics", (OperatorMetrics metrics) =>
+    Results.Text(metrics.Render(), "text/plain; version=0.0.4"));
+
+app.MapHealthChecks("/readyz");
+
 await app.RunAsync();
@@ -0,0 +1,82 @@
+using k8s;
+using k8s.Models;
+
+namespace AzDORunner.Services;
+
+public class AgentPodWatcherService : BackgroundService
+{
+    #region Fields
+
+    private readonly ILogger<AgentPodWatcherService> _logger;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly AzureDevOpsPollingService _pollingService;
+
+    #endregion
+
+    #region Constructor
+
+    public AgentPodWatcherService(
+        ILogger<AgentPodWatcherService> logger,
+        IKubernetes kubernetesClient,
+        AzureDevOpsPollingService pollingService)
+    {
+        _logger = logger;
+        _kubernetesClient = kubernetesClient;
+        _pollingService = pollingService;
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    protected override async Task ExecuteAsync(CancellationToken stoppingToken)
+    {
+        _logger.LogInformation("Agent Pod Watcher started - deleted or finished agent pods trigger an immediate poll");
+
+        while (!stoppingToken.IsCancellationRequested)
+        {
+            try
+            {
+                var response = _kubernetesClient.CoreV1.ListPodForAllNamespacesWithHttpMessagesAsync(
+                    labelSelector: "managed-by=azdo-runner-operator",
+                    watch: true,
+                    cancellationToken: stoppingToken);
+
+                await foreach (var (eventType, pod) in response.WatchAsync<V1Pod, V1PodList>(cancellationToken: stoppingToken))
+                {
+                    if (IsCapacityLost(eventType, pod) &&
+                        pod.Metadata.Labels?.TryGetValue("runner-pool", out var runnerPool) == true)
+                    {
+                        _logger.LogDebug("Agent pod {PodName} {EventType} (phase {Phase}), requesting poll of pool '{PoolName}'",
+                            pod.Metadata.Name, eventType, pod.Status?.Phase, runnerPool);
+                        _pollingService.RequestPoll(pod.Metadata.NamespaceProperty ?? "default", runnerPool);
+                    }
+                }
+            }
+            catch (OperationCanceledException) when (stoppingToken.IsCancellationRequested)
+            {
+                break;
+            }
+            catch (Exception ex)
+            {
+                _logger.LogWarning(ex, "Agent pod watch failed, restarting");
+                await Task.Delay(TimeSpan.FromSeconds(5), stoppingToken);
+            }
+        }
+
+        _logger.LogInformation("Agent Pod Watcher stopped");
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private static bool IsCapacityLost(WatchEventType eventType, V1Pod pod)
+    {
+        return eventType == WatchEventType.Deleted ||
+               (eventType == WatchEventType.Modified &&
+                (pod.Status?.Phase == "Failed" || pod.Status?.Phase == "Succeeded"));
+    }
+
+    #endregion
+}
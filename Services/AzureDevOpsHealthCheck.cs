@@ -0,0 +1,51 @@
+using Microsoft.Extensions.Diagnostics.HealthChecks;
+
+namespace AzDORunner.Services;
+
+public class AzureDevOpsHealthCheck : IHealthCheck
+{
+    #region Fields
+
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly LeaderElectionService _leaderElection;
+    private readonly TimeSpan _unhealthyAfter;
+
+    #endregion
+
+    #region Constructor
+
+    public AzureDevOpsHealthCheck(AzureDevOpsPollingService pollingService, LeaderElectionService leaderElection)
+    {
+        _pollingService = pollingService;
+        _leaderElection = leaderElection;
+        _unhealthyAfter = TimeSpan.FromSeconds(
+            int.TryParse(Environment.GetEnvironmentVariable("AZDO_UNHEALTHY_AFTER_SECONDS"), out var seconds) && seconds > 0
+                ? seconds
+                : 600);
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    public Task<HealthCheckResult> CheckHealthAsync(HealthCheckContext context, CancellationToken cancellationToken = default)
+    {
+        // Standby replicas don't poll, so they have nothing to report on
+        if (!_leaderElection.IsLeader)
+            return Task.FromResult(HealthCheckResult.Healthy("Not the leader"));
+
+        var pools = _pollingService.GetPoolFailures();
+        if (pools.Count == 0)
+            return Task.FromResult(HealthCheckResult.Healthy("No RunnerPools registered"));
+
+        // A single pool with a bad PAT shouldn't take the operator down, only losing all of them should
+        if (pools.Any(p => p.FailingSince == null || DateTime.UtcNow - p.FailingSince.Value < _unhealthyAfter))
+            return Task.FromResult(HealthCheckResult.Healthy($"{pools.Count(p => p.FailingSince == null)}/{pools.Count} pools connected"));
+
+        var failingFor = DateTime.UtcNow - pools.Max(p => p.FailingSince!.Value);
+        return Task.FromResult(HealthCheckResult.Unhealthy(
+            $"All {pools.Count} pools have failed to reach Azure DevOps for at least {(int)failingFor.TotalSeconds}s"));
+    }
+
+    #endregion
+}
@@ -2,67 +2,178 @@ using AzDORunner.Entities;
 using AzDORunner.Model.Domain;
 using k8s;
 using k8s.Models;
+using KubeOps.Abstractions.Events;
 using System.Collections.Concurrent;
 
 namespace AzDORunner.Services;
 
 public class AzureDevOpsPollingService : BackgroundService
 {
+    // How soon to continue scaling up when MaxSurge held back part of the queue
+    private const int ScaleUpRequeueSeconds = 5;
+
+    // Upper bound for the backoff while Azure DevOps keeps failing
+    private const int MaxBackoffSeconds = 600;
+
+    public const string PausedAnnotation = "azdo.opentools.mf/paused";
+
+    // An agent whose pod restarts is briefly offline, only reap ones that stayed down
+    private static readonly TimeSpan OrphanedAgentMinOfflineAge = TimeSpan.FromSeconds(60);
+
+    // Kept on the pod so a restarted operator continues a drain instead of starting the timeout over
+    private const string DrainStartedAnnotation = "azdo.opentools.mf/drain-started";
+
     private readonly ILogger<AzureDevOpsPollingService> _logger;
     private readonly IAzureDevOpsService _azureDevOpsService;
     private readonly KubernetesPodService _kubernetesPodService;
     private readonly IKubernetes _kubernetesClient;
     private readonly IRunnerPoolStatusService _statusService;
+    private readonly OperatorMetrics _metrics;
+    private readonly EventPublisher _eventPublisher;
+    private readonly LeaderElectionService _leaderElection;
     private readonly ConcurrentDictionary<string, PoolPollInfo> _poolsToMonitor = new();
+    private readonly SemaphoreSlim _pollRequested = new(0, 1);
+    private readonly ConcurrentDictionary<string, AgentDrain> _drainingAgents = new();
 
     public AzureDevOpsPollingService(
         ILogger<AzureDevOpsPollingService> logger,
         IAzureDevOpsService azureDevOpsService,
         KubernetesPodService kubernetesPodService,
         IKubernetes kubernetesClient,
-        IRunnerPoolStatusService statusService)
+        IRunnerPoolStatusService statusService,
+        OperatorMetrics metrics,
+        EventPublisher eventPublisher,
+        LeaderElectionService leaderElection)
     {
         _logger = logger;
         _azureDevOpsService = azureDevOpsService;
         _kubernetesPodService = kubernetesPodService;
         _kubernetesClient = kubernetesClient;
         _statusService = statusService;
+        _metrics = metrics;
+        _eventPublisher = eventPublisher;
+        _leaderElection = leaderElection;
+
+        // A new leader doesn't know when the previous one last polled, so poll everything right away
+        _leaderElection.StartedLeading += () =>
+        {
+            foreach (var pollInfo in _poolsToMonitor.Values)
+            {
+                pollInfo.LastPolled = DateTime.MinValue;
+            }
+            WakePollingLoop();
+        };
     }
 
     public void RegisterPool(V1AzDORunnerEntity entity, string pat)
     {
         var poolName = entity.Metadata.Name;
         var pollInterval = entity.Spec.PollIntervalSeconds > 5 ? entity.Spec.PollIntervalSeconds : 5;
-        _poolsToMonitor.AddOrUpdate(poolName, (key) =>
-        {
-            var pollInfo = new PoolPollInfo
-            {
-                Entity = entity,
-                Pat = pat,
-                PollIntervalSeconds = pollInterval
-            };
-            pollInfo.LastPolled = DateTime.UtcNow.AddSeconds(-pollInfo.PollIntervalSeconds - 1); // Force immediate poll
-            return pollInfo;
-        }, (key, old) =>
-        {
-            old.Entity = entity;
-            old.Pat = pat;
-            old.PollIntervalSeconds = pollInterval;
-            old.LastPolled = DateTime.UtcNow.AddSeconds(-pollInterval - 1);
-            return old;
-        });
+
+        // Always swap in a fresh PoolPollInfo, a poll in flight keeps working on the one it started with
+        var pollInfo = new PoolPollInfo
+        {
+            Entity = entity,
+            Pat = pat,
+            PollIntervalSeconds = pollInterval,
+            LastPolled = DateTime.UtcNow.AddSeconds(-pollInterval - 1), // Force immediate poll
+            // Keep the scale-down window running across spec updates and operator restarts
+            LastDemandTime = _poolsToMonitor.TryGetValue(GetPoolKey(entity), out var existing)
+                ? existing.LastDemandTime
+                : entity.Status?.LastDemandTime,
+            ConsecutiveFailures = existing?.ConsecutiveFailures ?? entity.Status?.ConsecutiveFailures ?? 0,
+            FailingSince = existing?.FailingSince,
+            UncancelableJobRequests = existing?.UncancelableJobRequests ?? new HashSet<int>(),
+            Paused = HasPausedAnnotation(entity)
+        };
+        _poolsToMonitor[GetPoolKey(entity)] = pollInfo;
+
+        // New pools get their minimum agents right away instead of after the current poll interval
+        WakePollingLoop();
         _logger.LogInformation("Registered/updated pool '{PoolName}' for Azure DevOps monitoring with {IntervalSeconds}s interval (immediate poll scheduled)",
             poolName, pollInterval);
     }
 
-    public void UnregisterPool(string poolName)
+    public void UnregisterPool(V1AzDORunnerEntity entity)
     {
-        if (_poolsToMonitor.TryRemove(poolName, out _))
+        var poolName = entity.Metadata.Name;
+        // Drains are keyed by pool, a pool created again under the same name starts over
+        var drainKeyPrefix = $"{GetPoolKey(entity)}/";
+        foreach (var drainKey in _drainingAgents.Keys.Where(k => k.StartsWith(drainKeyPrefix, StringComparison.Ordinal)))
         {
+            _drainingAgents.TryRemove(drainKey, out _);
+        }
+
+        if (_poolsToMonitor.TryRemove(GetPoolKey(entity), out _))
+        {
+            _metrics.RemovePool(entity.Metadata.NamespaceProperty ?? "default", poolName);
             _logger.LogInformation("Unregistered pool '{PoolName}' from Azure DevOps monitoring", poolName);
         }
     }
 
+    public void RequestPoll(string namespaceName, string poolName)
+    {
+        if (!_poolsToMonitor.TryGetValue($"{namespaceName}/{poolName}", out var pollInfo))
+        {
+            return;
+        }
+
+        pollInfo.LastPolled = DateTime.MinValue;
+        WakePollingLoop();
+        _logger.LogDebug("Immediate poll requested for pool '{PoolName}'", poolName);
+    }
+
+    private void WakePollingLoop()
+    {
+        try
+        {
+            _pollRequested.Release();
+        }
+        catch (SemaphoreFullException)
+        {
+            // A wake-up is already pending
+        }
+    }
+
+    public List<(V1AzDORunnerEntity Entity, string Pat)> GetPoolsUsingSecret(string namespaceName, string secretName)
+    {
+        return _poolsToMonitor.Values
+            .Where(info => (info.Entity.Metadata.NamespaceProperty ?? "default") == namespaceName &&
+                           info.Entity.Spec.PatSecretName == secretName)
+            .Select(info => (info.Entity, info.Pat))
+            .ToList();
+    }
+
+    public bool IsRegistered(V1AzDORunnerEntity entity)
+    {
+        return _poolsToMonitor.ContainsKey(GetPoolKey(entity));
+    }
+
+    public bool IsPaused(V1AzDORunnerEntity entity)
+    {
+        return _poolsToMonitor.TryGetValue(GetPoolKey(entity), out var pollInfo) && pollInfo.Paused;
+    }
+
+    internal static bool HasPausedAnnotation(V1AzDORunnerEntity entity)
+    {
+        return entity.Metadata.Annotations?.TryGetValue(PausedAnnotation, out var paused) == true &&
+               string.Equals(paused, "true", StringComparison.OrdinalIgnoreCase);
+    }
+
+    // When each pool started failing to poll, null for pools that are currently fine
+    public List<(string Pool, DateTime? FailingSince)> GetPoolFailures()
+    {
+        return _poolsToMonitor
+            .Select(kv => (kv.Key, kv.Value.ConsecutiveFailures > 0 ? kv.Value.FailingSince : null))
+            .ToList();
+    }
+
+    private static string GetPoolKey(V1AzDORunnerEntity entity)
+    {
+        // RunnerPools with the same name may live in different namespaces
+        return $"{entity.Metadata.NamespaceProperty ?? "default"}/{entity.Metadata.Name}";
+    }
+
     protected override async Task ExecuteAsync(CancellationToken stoppingToken)
     {
         _logger.LogInformation("Azure DevOps Polling Service started - will continuously monitor pools");
@@ -77,14 +188,15 @@ public class AzureDevOpsPollingService : BackgroundService
                 int minPollInterval = 5;
                 if (!_poolsToMonitor.IsEmpty)
                 {
-                    minPollInterval = _poolsToMonitor.Values.Min(p => p.PollIntervalSeconds);
+                    minPollInterval = _poolsToMonitor.Values.Min(GetEffectivePollSeconds);
                 }
 
                 var elapsed = DateTime.UtcNow - pollStart;
                 var delay = TimeSpan.FromSeconds(minPollInterval) - elapsed;
                 if (delay > TimeSpan.Zero)
                 {
-                    await Task.Delay(delay, stoppingToken);
+                    // RequestPoll wakes us up early, e.g. when an agent pod goes away
+                    await _pollRequested.WaitAsync(delay, stoppingToken);
                 }
             }
             catch (Exception ex)
@@ -97,8 +209,15 @@ public class AzureDevOpsPollingService : BackgroundService
         _logger.LogInformation("Azure DevOps Polling Service stopped");
     }
 
-    private async Task PollAllRegisteredPools()
+    internal async Task PollAllRegisteredPools()
     {
+        // Every replica keeps its registrations up to date, but only the leader scales
+        if (!_leaderElection.IsLeader)
+        {
+            _logger.LogDebug("Not the leader, skipping poll of {TotalPools} registered pools", _poolsToMonitor.Count);
+            return;
+        }
+
         if (_poolsToMonitor.IsEmpty)
         {
             _logger.LogDebug("No pools registered for monitoring yet");
@@ -107,7 +226,7 @@ public class AzureDevOpsPollingService : BackgroundService
 
         var currentTime = DateTime.UtcNow;
         var poolsToPoll = _poolsToMonitor.Values
-            .Where(info => currentTime.Subtract(info.LastPolled).TotalSeconds >= info.PollIntervalSeconds)
+            .Where(info => currentTime.Subtract(info.LastPolled).TotalSeconds >= GetEffectivePollSeconds(info))
             .ToList();
 
         _logger.LogDebug("Checking {TotalPools} registered pools, {PollablePools} ready to poll",
@@ -128,7 +247,21 @@ public class AzureDevOpsPollingService : BackgroundService
         }
     }
 
-    private async Task PollSinglePool(PoolPollInfo pollInfo)
+    internal static int GetEffectivePollSeconds(PoolPollInfo info)
+    {
+        if (info.ConsecutiveFailures > 0)
+        {
+            // 1x, 2x, 4x, ... the poll interval, so a down Azure DevOps instance isn't hammered
+            var backoff = info.PollIntervalSeconds * Math.Pow(2, Math.Min(info.ConsecutiveFailures - 1, 16));
+            return (int)Math.Min(backoff, Math.Max(MaxBackoffSeconds, info.PollIntervalSeconds));
+        }
+
+        return info.ScaleUpPending
+            ? Math.Min(info.PollIntervalSeconds, ScaleUpRequeueSeconds)
+            : info.PollIntervalSeconds;
+    }
+
+    internal async Task PollSinglePool(PoolPollInfo pollInfo)
     {
         var entity = pollInfo.Entity;
         var pat = pollInfo.Pat;
@@ -138,31 +271,102 @@ public class AzureDevOpsPollingService : BackgroundService
 
         _logger.LogInformation("Polling Azure DevOps for pool '{PoolName}'", poolName);
 
+        var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+        var podChurnBefore = _metrics.GetPodChurn(namespaceName, poolName);
+        var pollStartedAt = DateTime.UtcNow;
+
+        // Annotation changes don't trigger a reconcile, so look at the live object for the paused flag
+        var liveEntity = await _statusService.GetRunnerPoolAsync(poolName, namespaceName);
+        if (liveEntity != null)
+        {
+            pollInfo.Paused = HasPausedAnnotation(liveEntity);
+        }
+
+        if (pollInfo.Paused)
+        {
+            pollInfo.ScaleUpPending = false;
+            _logger.LogInformation("Pool '{PoolName}' is paused by the {Annotation} annotation, skipping scaling and cleanup", poolName, PausedAnnotation);
+            if (liveEntity != null)
+            {
+                liveEntity.Status.SetCondition("Paused", "True", "Paused", $"Scaling and cleanup are paused by the {PausedAnnotation} annotation");
+                liveEntity.Status.SetCondition("Progressing", "False", "Paused", "Scaling is paused");
+                await _statusService.UpdateStatusAsync(liveEntity);
+            }
+            return;
+        }
+
         try
         {
             // Get current Azure DevOps state
-            var queuedJobs = await _azureDevOpsService.GetQueuedJobsCountAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
-            var azureAgents = await _azureDevOpsService.GetPoolAgentsAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+            var pool = await _azureDevOpsService.GetPoolAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+            if (pool == null)
+            {
+                // Without a pool every other call comes back empty, don't scale against that
+                throw new InvalidOperationException($"Pool '{entity.Spec.Pool}' not found in Azure DevOps or the name matches several pools");
+            }
+
+            if (!string.Equals(pool.PoolType, entity.Spec.PoolType, StringComparison.OrdinalIgnoreCase))
+            {
+                throw new InvalidOperationException($"Pool '{pool.Name}' is a {pool.PoolType} pool, but the RunnerPool expects PoolType '{entity.Spec.PoolType}'");
+            }
+
+            var jobRequests = await _azureDevOpsService.GetJobRequestsAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+            var queuedJobs = jobRequests.Count(j => j.IsQueued);
+            var runningJobs = jobRequests.Count(j => j.IsRunning);
+            if (queuedJobs > 0)
+            {
+                pollInfo.LastDemandTime = DateTime.UtcNow;
+            }
+
             var activePods = await _kubernetesPodService.GetActivePodsAsync(entity);
             var allPods = await _kubernetesPodService.GetAllRunnerPodsAsync(entity);
 
-            _logger.LogInformation("Pool '{PoolName}': {QueuedJobs} queued jobs, {AzureAgents} Azure agents, {ActivePods} active pods",
-                poolName, queuedJobs, azureAgents.Count, activePods.Count);
+            // A pool scaled to zero has no agents to clean up, skip listing them. The size comes from the pool
+            // lookup, which may be cached; agents registered since then belong to pods, so list them while any exist.
+            var azureAgents = pool.Size == 0 && allPods.Count == 0
+                ? new List<Agent>()
+                : await _azureDevOpsService.GetPoolAgentsAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+
+            _logger.LogInformation("Pool '{PoolName}': {QueuedJobs} queued jobs, {RunningJobs} running jobs, {AzureAgents} Azure agents, {ActivePods} active pods",
+                poolName, queuedJobs, runningJobs, azureAgents.Count, activePods.Count);
 
             // If we successfully polled everything, set status to Connected
             connectionStatus = "Connected";
+            pollInfo.ConsecutiveFailures = 0;
+            pollInfo.FailingSince = null;
 
             // Note: Error pod cleanup is now handled by the separate ErrorPodCleanupService
 
+            if (entity.Spec.Mode == "DryRun")
+            {
+                // Report the intended scale instead of touching pods or agents
+                await ReportDryRunAsync(entity, queuedJobs, runningJobs, activePods.Count);
+                UpdateEntityStatus(entity, azureAgents, activePods, queuedJobs, runningJobs, connectionStatus, lastError, pool.Name, pollInfo.LastDemandTime,
+                    GetDesiredAgents(entity, queuedJobs, runningJobs), activePods.Count);
+                return;
+            }
+
             // 1. Clean up completed agents/pods (Failed/Completed pods are deleted immediately)
             await CleanupCompletedAgentsAsync(entity, pat, azureAgents, allPods);
 
+            // 1b. Remove offline agent registrations whose pods are gone
+            if (azureAgents.Count > 0)
+            {
+                await CleanupOrphanedAgentsAsync(entity, pat, allPods);
+            }
+
+            // 1c. Cancel job requests still assigned to agents whose pods are gone
+            await CancelStuckJobRequestsAsync(pollInfo, jobRequests, allPods);
+
             // 2. Clean up idle running agents based on TtlIdleSeconds configuration
-            await CleanupIdleAgentsAsync(entity, pat, azureAgents, allPods);
+            await CleanupIdleAgentsAsync(entity, pat, azureAgents, allPods, pollInfo.LastDemandTime);
 
             // 3. Ensure minimum agents are running
             await EnsureMinimumAgentsAsync(entity, pat);
 
+            // 3b. Keep per-capability minimums warm
+            await EnsureCapabilityMinimumsAsync(entity, pat);
+
             // 4. Optimize minimum agents for required capabilities
             if (queuedJobs > 0)
             {
@@ -172,26 +376,53 @@ public class AzureDevOpsPollingService : BackgroundService
             // 5. Ensure maximum agents limit is respected
             await EnsureMaximumAgentsLimitAsync(entity, pat);
 
+            // 5b. Move agents onto a changed image
+            if (entity.Spec.UpdateStrategy == "RollingRecreate")
+            {
+                await RecreateOutdatedAgentsAsync(entity, pat, azureAgents, jobRequests);
+            }
+
             // 6. Scale up if needed - get fresh pod list after cleanup operations
+            pollInfo.ScaleUpPending = false;
             if (queuedJobs > 0)
             {
                 var freshActivePods = await _kubernetesPodService.GetActivePodsAsync(entity);
-                await ScaleUpForQueuedWorkAsync(entity, pat, queuedJobs, azureAgents, freshActivePods.Count);
+                pollInfo.ScaleUpPending = await ScaleUpForQueuedWorkAsync(entity, pat, queuedJobs, azureAgents, freshActivePods.Count);
+
+                // Coming up from zero, the rest of a pipeline's jobs usually queue right behind the first one
+                if (freshActivePods.Count == 0)
+                {
+                    _logger.LogInformation("Cold start for pool '{PoolName}' with {QueuedJobs} queued jobs, polling again in {RequeueSeconds}s",
+                        poolName, queuedJobs, ScaleUpRequeueSeconds);
+                    pollInfo.ScaleUpPending = true;
+                }
             }
 
+            // 7. Hand back agents whose drain no step asked for anymore
+            await CancelAbandonedDrainsAsync(entity, pat, azureAgents, jobRequests, pollStartedAt);
+
             // 5. Update status with successful connection
-            UpdateEntityStatus(entity, azureAgents, activePods, queuedJobs, connectionStatus, lastError);
+            var scaled = _metrics.GetPodChurn(namespaceName, poolName) != podChurnBefore;
+            var currentAgents = scaled ? (await _kubernetesPodService.GetActivePodsAsync(entity)).Count : activePods.Count;
+            UpdateEntityStatus(entity, azureAgents, activePods, queuedJobs, runningJobs, connectionStatus, lastError, pool.Name, pollInfo.LastDemandTime,
+                GetDesiredAgents(entity, queuedJobs, runningJobs), currentAgents, scaled);
         }
         catch (Exception ex)
         {
-            _logger.LogError(ex, "Failed to poll Azure DevOps for pool '{PoolName}' - marking as disconnected", poolName);
+            pollInfo.ConsecutiveFailures++;
+            pollInfo.FailingSince ??= DateTime.UtcNow;
+            _logger.LogError(ex, "Failed to poll Azure DevOps for pool '{PoolName}' ({Failures} consecutive failures) - marking as disconnected, retrying in {RetrySeconds}s",
+                poolName, pollInfo.ConsecutiveFailures, GetEffectivePollSeconds(pollInfo));
             connectionStatus = "Disconnected";
             lastError = ex.Message;
 
+            await PublishEventAsync(entity, "PollFailed", $"Failed to poll Azure DevOps: {ex.Message}", EventType.Warning);
+
             try
             {
                 var activePods = await _kubernetesPodService.GetActivePodsAsync(entity);
-                UpdateEntityStatus(entity, new List<Agent>(), activePods, 0, connectionStatus, lastError);
+                UpdateEntityStatus(entity, new List<Agent>(), activePods, 0, 0, connectionStatus, lastError,
+                    consecutiveFailures: pollInfo.ConsecutiveFailures);
             }
             catch (Exception statusEx)
             {
@@ -208,6 +439,9 @@ public class AzureDevOpsPollingService : BackgroundService
         // First, clean up job-request-id labels from running pods whose jobs have completed
         await CleanupCompletedJobLabelsAsync(entity, allPods, jobRequests);
 
+        // Then tag pods whose agent picked up a job so they can be correlated with pipelines
+        await LabelPodsWithAssignedJobsAsync(entity, allPods, jobRequests);
+
         // Handle Succeeded and Failed pods based on TTL settings
         var completedPods = allPods.Where(pod =>
             pod.Status?.Phase == "Succeeded" ||
@@ -249,7 +483,7 @@ public class AzureDevOpsPollingService : BackgroundService
 
                 bool shouldCleanup = false;
                 string reason = "";
-                var ttlIdleSeconds = entity.Spec.TtlIdleSeconds;
+                var ttlIdleSeconds = entity.Spec.GetTtlIdleSeconds();
 
                 if (ttlIdleSeconds == 0)
                 {
@@ -279,7 +513,7 @@ public class AzureDevOpsPollingService : BackgroundService
                     // Unregister the agent from Azure DevOps if it exists
                     if (correspondingAgent != null)
                     {
-                        bool isOperatorManaged = IsOperatorManagedAgent(correspondingAgent.Name, entity.Metadata.Name);
+                        bool isOperatorManaged = IsOperatorManagedAgent(correspondingAgent.Name, entity);
                         _logger.LogInformation("{Phase} agent '{AgentName}' - IsOperatorManaged: {IsOperatorManaged}, AgentId: {AgentId}, Status: {Status}",
                             completedPod.Status?.Phase, correspondingAgent.Name, isOperatorManaged, correspondingAgent.Id, correspondingAgent.Status);
 
@@ -321,10 +555,12 @@ public class AzureDevOpsPollingService : BackgroundService
             }
         }
 
-        // Clean up offline operator-managed agents without active pods and not running jobs
+        // Clean up offline operator-managed agents whose pods finished and are not running jobs.
+        // Agents without any pod are handled by CleanupOrphanedAgentsAsync
         var operatorOfflineAgents = azureAgents.Where(agent =>
             agent.Status.ToLower() == "offline" &&
-            IsOperatorManagedAgent(agent.Name, entity.Metadata.Name) &&
+            IsOperatorManagedAgent(agent.Name, entity) &&
+            allPods.Any(pod => pod.Metadata.Name == agent.Name) &&
             !allPods.Any(pod => pod.Metadata.Name == agent.Name &&
                          (pod.Status?.Phase == "Running" || pod.Status?.Phase == "Pending"))
         ).ToList();
@@ -368,6 +604,153 @@ public class AzureDevOpsPollingService : BackgroundService
         }
     }
 
+    private async Task CleanupOrphanedAgentsAsync(V1AzDORunnerEntity entity, string pat, List<V1Pod> allPods)
+    {
+        var offlineAgents = await _azureDevOpsService.GetOfflineAgentsOlderThanAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, OrphanedAgentMinOfflineAge, pat);
+
+        // Only agents following our naming scheme, anything else in the pool isn't ours to remove
+        var orphanedAgents = offlineAgents.Where(agent =>
+            IsOperatorManagedAgent(agent.Name, entity) &&
+            !allPods.Any(pod => pod.Metadata.Name == agent.Name)
+        ).ToList();
+
+        foreach (var orphanedAgent in orphanedAgents)
+        {
+            try
+            {
+                // No pod means nothing can ever bring this agent back, even if a job is still assigned to it
+                _logger.LogInformation("Removing orphaned agent '{AgentName}' (ID: {AgentId}) whose pod no longer exists",
+                    orphanedAgent.Name, orphanedAgent.Id);
+
+                if (await _azureDevOpsService.UnregisterAgentAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, orphanedAgent.Name, pat))
+                {
+                    await PublishEventAsync(entity, "AgentDeleted", $"Deleted orphaned agent {orphanedAgent.Name} whose pod no longer exists");
+                }
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "Failed to remove orphaned agent '{AgentName}'", orphanedAgent.Name);
+            }
+        }
+    }
+
+    private async Task RecreateOutdatedAgentsAsync(V1AzDORunnerEntity entity, string pat, List<Agent> azureAgents, List<JobRequest> jobRequests)
+    {
+        // An image update never kills a job, agents running one are picked up once they are idle.
+        // Pods already draining stay in the batch, so no more than MaxSurge agents are out at a time.
+        var outdatedPods = (await _kubernetesPodService.GetActivePodsAsync(entity))
+            .Where(pod => pod.Status?.Phase == "Running" &&
+                          KubernetesPodService.IsRunningOutdatedImage(entity, pod) &&
+                          (!IsRunningJob(pod, azureAgents, jobRequests) || IsDraining(entity, pod)))
+            .OrderBy(pod => pod.Metadata.CreationTimestamp)
+            .Take(Math.Max(1, entity.Spec.MaxSurge))
+            .ToList();
+
+        var recreated = 0;
+        var removed = 0;
+        foreach (var pod in outdatedPods)
+        {
+            if (IsRunningJob(pod, azureAgents, jobRequests))
+            {
+                _logger.LogInformation("Agent '{PodName}' is finishing a job before moving to the current image", pod.Metadata.Name);
+                continue;
+            }
+
+            try
+            {
+                var agent = azureAgents.FirstOrDefault(a => a.Name == pod.Metadata.Name);
+                if (!await DrainAndRemoveAgentAsync(entity, pat, pod, agent, forceAfterDrainTimeout: false))
+                {
+                    continue;
+                }
+
+                // Minimum agents are meant to be warm, so they come back right away. Other idle agents are
+                // just removed, queued work gets agents on the current image from the scale-up step.
+                var isMinAgent = pod.Metadata.Labels?.TryGetValue("min-agent", out var minAgent) == true && minAgent == "true";
+                if (!isMinAgent)
+                {
+                    removed++;
+                    continue;
+                }
+
+                var agentIndex = _kubernetesPodService.GetNextAvailableAgentIndex(entity);
+                await _kubernetesPodService.CreateAgentPodAsync(entity, pat, agentIndex, true, GetPodCapability(pod));
+                recreated++;
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "Failed to recreate outdated agent '{PodName}'", pod.Metadata.Name);
+            }
+        }
+
+        if (recreated + removed > 0)
+        {
+            _logger.LogInformation("Recreated {Recreated} minimum agents on the current image and removed {Removed} idle outdated agents for pool '{PoolName}'",
+                recreated, removed, entity.Metadata.Name);
+            await PublishEventAsync(entity, "AgentsRecreated",
+                $"Recreated {recreated} minimum agents on the current image and removed {removed} idle agents on an outdated image");
+        }
+    }
+
+    private static bool IsRunningJob(V1Pod pod, List<Agent> azureAgents, List<JobRequest> jobRequests)
+    {
+        var agent = azureAgents.FirstOrDefault(a => a.Name == pod.Metadata.Name);
+        return agent != null && jobRequests.Any(j => j.IsRunning && j.AgentId == agent.Id);
+    }
+
+    // Active pods whose agent isn't online in Azure DevOps yet
+    private static List<V1Pod> GetWarmingPods(List<V1Pod> pods, List<Agent> operatorManagedAgents)
+    {
+        var onlineAgentNames = operatorManagedAgents
+            .Where(a => a.Status?.ToLower() == "online")
+            .Select(a => a.Name)
+            .ToHashSet();
+        return pods.Where(p =>
+            (p.Status?.Phase == "Running" || p.Status?.Phase == "Pending") &&
+            !onlineAgentNames.Contains(p.Metadata.Name)).ToList();
+    }
+
+    private async Task CancelStuckJobRequestsAsync(PoolPollInfo pollInfo, List<JobRequest> jobRequests, List<V1Pod> allPods)
+    {
+        var entity = pollInfo.Entity;
+        var pat = pollInfo.Pat;
+        if (entity.Spec.StuckJobTimeoutSeconds <= 0)
+        {
+            return;
+        }
+
+        // With its pod gone the agent can never finish the job, but Azure DevOps keeps counting it as running
+        var stuckJobs = jobRequests.Where(job =>
+            job.IsRunning &&
+            job.ReservedAgent != null &&
+            IsOperatorManagedAgent(job.ReservedAgent.Name, entity) &&
+            !allPods.Any(pod => pod.Metadata.Name == job.ReservedAgent.Name) &&
+            DateTime.UtcNow - (job.AssignTime ?? job.QueueTime) > TimeSpan.FromSeconds(entity.Spec.StuckJobTimeoutSeconds)
+        ).ToList();
+
+        // Forget requests that finished some other way, e.g. canceled by hand
+        pollInfo.UncancelableJobRequests.IntersectWith(stuckJobs.Select(job => job.RequestId));
+
+        foreach (var job in stuckJobs.Where(job => !pollInfo.UncancelableJobRequests.Contains(job.RequestId)))
+        {
+            _logger.LogWarning("Job request {RequestId} is assigned to agent '{AgentName}' whose pod no longer exists, canceling it",
+                job.RequestId, job.ReservedAgent!.Name);
+
+            if (await _azureDevOpsService.CancelJobRequestAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, job.RequestId, pat))
+            {
+                await PublishEventAsync(entity, "StuckJobCanceled",
+                    $"Canceled job request {job.RequestId} assigned to agent {job.ReservedAgent.Name} whose pod no longer exists", EventType.Warning);
+                continue;
+            }
+
+            // Without the request's lock token Azure DevOps may refuse the cancel, retrying won't change that
+            pollInfo.UncancelableJobRequests.Add(job.RequestId);
+            _logger.LogWarning("Could not cancel job request {RequestId}, it stays stuck until it is canceled in Azure DevOps", job.RequestId);
+            await PublishEventAsync(entity, "StuckJobDetected",
+                $"Job request {job.RequestId} is assigned to agent {job.ReservedAgent.Name} whose pod no longer exists and could not be canceled. Cancel the run in Azure DevOps", EventType.Warning);
+        }
+    }
+
     private async Task CleanupCompletedJobLabelsAsync(V1AzDORunnerEntity entity, List<V1Pod> allPods, List<JobRequest> jobRequests)
     {
         // Find running pods that have job-request-id labels for completed jobs
@@ -388,7 +771,7 @@ public class AzureDevOpsPollingService : BackgroundService
                 {
                     await _kubernetesPodService.UpdatePodLabelsAsync(pod.Metadata.Name,
                         entity.Metadata.NamespaceProperty ?? "default",
-                        new Dictionary<string, string> { { "job-request-id", "" } });
+                        new Dictionary<string, string> { { "job-request-id", "" }, { "job-definition", "" } });
 
                     _logger.LogInformation("Cleared job-request-id label from pod '{PodName}' as job {JobRequestId} completed with result: {Result}",
                         pod.Metadata.Name, jobRequestId, job.Result);
@@ -398,7 +781,7 @@ public class AzureDevOpsPollingService : BackgroundService
                 {
                     await _kubernetesPodService.UpdatePodLabelsAsync(pod.Metadata.Name,
                         entity.Metadata.NamespaceProperty ?? "default",
-                        new Dictionary<string, string> { { "job-request-id", "" } });
+                        new Dictionary<string, string> { { "job-request-id", "" }, { "job-definition", "" } });
 
                     _logger.LogInformation("Cleared job-request-id label from pod '{PodName}' as job {JobRequestId} no longer exists",
                         pod.Metadata.Name, jobRequestId);
@@ -411,11 +794,71 @@ public class AzureDevOpsPollingService : BackgroundService
         }
     }
 
+    private async Task LabelPodsWithAssignedJobsAsync(V1AzDORunnerEntity entity, List<V1Pod> allPods, List<JobRequest> jobRequests)
+    {
+        foreach (var job in jobRequests.Where(j => j.IsRunning && j.ReservedAgent != null))
+        {
+            // Agents register under their pod name
+            var pod = allPods.FirstOrDefault(p => p.Metadata.Name == job.ReservedAgent!.Name && p.Status?.Phase == "Running");
+            if (pod == null)
+            {
+                continue;
+            }
+
+            var jobRequestId = job.RequestId.ToString();
+            var jobDefinition = ToLabelValue(job.Definition?.Name);
+            var currentJobRequestId = pod.Metadata.Labels?.TryGetValue("job-request-id", out var requestIdLabel) == true ? requestIdLabel : null;
+            var currentJobDefinition = pod.Metadata.Labels?.TryGetValue("job-definition", out var definitionLabel) == true ? definitionLabel : null;
+            if (currentJobRequestId == jobRequestId && currentJobDefinition == jobDefinition)
+            {
+                continue;
+            }
+
+            try
+            {
+                await _kubernetesPodService.UpdatePodLabelsAsync(pod.Metadata.Name,
+                    entity.Metadata.NamespaceProperty ?? "default",
+                    new Dictionary<string, string> { { "job-request-id", jobRequestId }, { "job-definition", jobDefinition } });
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "Failed to label pod '{PodName}' with job {JobRequestId}", pod.Metadata.Name, jobRequestId);
+            }
+        }
+    }
+
+    private static string ToLabelValue(string? value)
+    {
+        if (string.IsNullOrEmpty(value))
+        {
+            return string.Empty;
+        }
+
+        // Label values are limited to 63 alphanumerics, '-', '_' or '.', starting and ending alphanumeric
+        var sanitized = new string(value.Select(c => char.IsAsciiLetterOrDigit(c) || c == '-' || c == '_' || c == '.' ? c : '-').ToArray());
+        if (sanitized.Length > 63)
+        {
+            sanitized = sanitized[..63];
+        }
+
+        return sanitized.Trim('-', '_', '.');
+    }
+
 
 
-    private async Task CleanupIdleAgentsAsync(V1AzDORunnerEntity entity, string pat, List<Agent> azureAgents, List<V1Pod> pods)
+    private async Task CleanupIdleAgentsAsync(V1AzDORunnerEntity entity, string pat, List<Agent> azureAgents, List<V1Pod> pods, DateTime? lastDemandTime)
     {
-        var ttlIdleSeconds = entity.Spec.TtlIdleSeconds;
+        // Queue depth is bursty, keep idle agents around until demand has stayed away for the whole window
+        var stabilizationSeconds = entity.Spec.ScaleDownStabilizationSeconds;
+        if (stabilizationSeconds > 0 && lastDemandTime.HasValue &&
+            DateTime.UtcNow - lastDemandTime.Value < TimeSpan.FromSeconds(stabilizationSeconds))
+        {
+            _logger.LogDebug("Skipping idle agent cleanup for pool '{PoolName}', last demand at {LastDemandTime} is within the {StabilizationSeconds}s stabilization window",
+                entity.Metadata.Name, lastDemandTime, stabilizationSeconds);
+            return;
+        }
+
+        var ttlIdleSeconds = entity.Spec.GetTtlIdleSeconds();
         var queuedJobs = await _azureDevOpsService.GetQueuedJobsCountAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
 
         // Get minimum agent pods to protect them from cleanup
@@ -428,6 +871,12 @@ public class AzureDevOpsPollingService : BackgroundService
         // Get running pods that are not minimum agents
         var runningPods = pods.Where(pod => pod.Status?.Phase == "Running").ToList();
 
+        // Per-capability minimums are protected like minimum agents, counted down as pods go away
+        var capabilityCounts = pods
+            .Where(pod => pod.Status?.Phase == "Running" || pod.Status?.Phase == "Pending")
+            .GroupBy(GetPodCapability)
+            .ToDictionary(g => g.Key, g => g.Count());
+
         foreach (var pod in runningPods)
         {
             try
@@ -439,6 +888,16 @@ public class AzureDevOpsPollingService : BackgroundService
                     continue;
                 }
 
+                var podCapability = GetPodCapability(pod);
+                if (entity.Spec.CapabilityAware &&
+                    entity.Spec.CapabilityScaling.TryGetValue(podCapability, out var capabilityScaling) &&
+                    capabilityCounts.GetValueOrDefault(podCapability) <= capabilityScaling.MinAgents)
+                {
+                    _logger.LogDebug("Skipping cleanup of agent '{PodName}', capability '{Capability}' is at its minimum of {MinAgents}",
+                        pod.Metadata.Name, podCapability, capabilityScaling.MinAgents);
+                    continue;
+                }
+
                 // Grace period: do not delete pod if it is less than 2 minutes old (allow time for registration)
                 if (pod.Metadata.CreationTimestamp.HasValue &&
                     DateTime.UtcNow - pod.Metadata.CreationTimestamp.Value < TimeSpan.FromMinutes(2))
@@ -535,44 +994,19 @@ public class AzureDevOpsPollingService : BackgroundService
                 {
                     _logger.LogInformation("Cleaning up idle agent '{AgentName}' - {Reason}", pod.Metadata.Name, reason);
 
-                    // Unregister from Azure DevOps first
-                    if (correspondingAgent != null)
-                    {
-                        bool isOperatorManaged = IsOperatorManagedAgent(correspondingAgent.Name, entity.Metadata.Name);
-                        _logger.LogInformation("Agent '{AgentName}' - IsOperatorManaged: {IsOperatorManaged}, AgentId: {AgentId}, Status: {Status}",
-                            correspondingAgent.Name, isOperatorManaged, correspondingAgent.Id, correspondingAgent.Status);
-
-                        if (isOperatorManaged)
-                        {
-                            _logger.LogInformation("Unregistering agent '{AgentName}' (ID: {AgentId}) from Azure DevOps pool '{Pool}'",
-                                correspondingAgent.Name, correspondingAgent.Id, entity.Spec.Pool);
-
-                            var unregistered = await _azureDevOpsService.UnregisterAgentAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, correspondingAgent.Name, pat);
-
-                            if (unregistered)
-                            {
-                                _logger.LogInformation("Successfully unregistered agent '{AgentName}' from Azure DevOps", correspondingAgent.Name);
-                            }
-                            else
-                            {
-                                _logger.LogWarning("Failed to unregister agent '{AgentName}' from Azure DevOps (but will still delete pod)", correspondingAgent.Name);
-                            }
-                        }
-                        else
-                        {
-                            _logger.LogWarning("Skipping Azure DevOps unregistration for agent '{AgentName}' - not operator managed", correspondingAgent.Name);
-                        }
-                    }
-                    else
+                    if (correspondingAgent == null)
                     {
                         _logger.LogInformation("No corresponding Azure DevOps agent found for pod '{PodName}' - proceeding with pod deletion only", pod.Metadata.Name);
                     }
 
-                    // Delete the pod
-                    await _kubernetesPodService.DeletePodAsync(pod.Metadata.Name,
-                        entity.Metadata.NamespaceProperty ?? "default");
+                    if (!await DrainAndRemoveAgentAsync(entity, pat, pod, correspondingAgent))
+                    {
+                        continue;
+                    }
 
+                    capabilityCounts[podCapability] = capabilityCounts.GetValueOrDefault(podCapability) - 1;
                     _logger.LogInformation("Successfully cleaned up idle agent pod '{AgentName}'", pod.Metadata.Name);
+                    await PublishEventAsync(entity, "AgentDeleted", $"Deleted agent {pod.Metadata.Name}: {reason}");
                 }
             }
             catch (Exception ex)
@@ -582,10 +1016,11 @@ public class AzureDevOpsPollingService : BackgroundService
         }
     }
 
-    private async Task ScaleUpForQueuedWorkAsync(V1AzDORunnerEntity entity, string pat, int queuedJobs, List<Agent> agents, int activePods)
+    // Returns true when MaxSurge held back jobs, so the pool gets polled again soon
+    private async Task<bool> ScaleUpForQueuedWorkAsync(V1AzDORunnerEntity entity, string pat, int queuedJobs, List<Agent> agents, int activePods)
     {
         // Filter to only count operator-managed agents (ignore external agents like "Labby")
-        var operatorManagedAgents = agents.Where(a => IsOperatorManagedAgent(a.Name, entity.Metadata.Name)).ToList();
+        var operatorManagedAgents = agents.Where(a => IsOperatorManagedAgent(a.Name, entity)).ToList();
 
         // Fetch all job requests for the pool to determine if an agent is running a job
         var jobRequests = await _azureDevOpsService.GetJobRequestsAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
@@ -615,9 +1050,45 @@ public class AzureDevOpsPollingService : BackgroundService
             }
         }
 
+        // A pod whose agent hasn't come online yet picks up a queued job as soon as it registers, so it
+        // covers one (or a batch) of the jobs left over. Pods started for a job that is still queued
+        // were already matched to that job above.
+        var jobsPerAgent = Math.Max(1, entity.Spec.JobsPerAgent);
+        var stillQueuedJobIds = jobRequests.Where(j => j.IsQueued).Select(j => j.RequestId.ToString()).ToHashSet();
+        var uncommittedWarmingPods = GetWarmingPods(allPods, operatorManagedAgents).Count(pod =>
+            pod.Metadata.Labels?.TryGetValue("job-request-id", out var val) != true || !stillQueuedJobIds.Contains(val));
+        if (uncommittedWarmingPods > 0 && jobsToSpawn.Count > 0)
+        {
+            _logger.LogInformation("{WarmingPods} agents of pool '{PoolName}' are still coming online, not starting new agents for the jobs they will pick up",
+                uncommittedWarmingPods, entity.Metadata.Name);
+            jobsToSpawn = jobsToSpawn.Skip(uncommittedWarmingPods * jobsPerAgent).ToList();
+        }
+
+        if (jobsPerAgent > 1)
+        {
+            // A pod started for a batch carries the id of one job until its agent picks something up,
+            // the rest of that batch is still waiting on it
+            var podsAwaitingBatch = allPods.Count(pod =>
+                pod.Metadata.Labels?.TryGetValue("job-request-id", out var val) == true && stillQueuedJobIds.Contains(val));
+            jobsToSpawn = jobsToSpawn
+                .Skip(podsAwaitingBatch * (jobsPerAgent - 1))
+                .Where((_, i) => i % jobsPerAgent == 0)
+                .ToList();
+        }
+
         var availableSlots = entity.Spec.MaxAgents - totalAgentCount;
         jobsToSpawn = jobsToSpawn.Take(availableSlots).ToList();
 
+        // Don't flood the API server and scheduler when a large queue shows up at once
+        var maxSurge = Math.Max(1, entity.Spec.MaxSurge);
+        var surgeLimited = jobsToSpawn.Count > maxSurge;
+        if (surgeLimited)
+        {
+            _logger.LogInformation("Limiting scale-up for pool '{PoolName}' to {MaxSurge} of {NeededAgents} agents, continuing in {RequeueSeconds}s",
+                entity.Metadata.Name, maxSurge, jobsToSpawn.Count, ScaleUpRequeueSeconds);
+            jobsToSpawn = jobsToSpawn.Take(maxSurge).ToList();
+        }
+
         if (jobsToSpawn.Count > 0)
         {
             _logger.LogInformation("PENDING WORK DETECTED: Spawning {NeededAgents} agents for {JobsWithoutAgent} unassigned queued jobs (max agents: {MaxAgents}, total agents: {TotalAgentCount})",
@@ -647,6 +1118,7 @@ public class AzureDevOpsPollingService : BackgroundService
             }
 
             _logger.LogInformation("Created {NeededAgents} agent pods for pending work", jobsToSpawn.Count);
+            await PublishEventAsync(entity, "ScaledUp", $"Created {jobsToSpawn.Count} agent pods for queued jobs");
         }
         else if (jobsWithoutAgentOrPod.Count == 0)
         {
@@ -656,24 +1128,32 @@ public class AzureDevOpsPollingService : BackgroundService
         {
             _logger.LogInformation("All {JobCount} unassigned jobs were handled by reusing idle agents.", jobsWithoutAgentOrPod.Count);
         }
+
+        return surgeLimited;
     }
 
     private async Task SpawnCapabilityAwareAgentsFromJobDemands(V1AzDORunnerEntity entity, string pat, List<JobRequest> jobsToSpawn, Dictionary<string, string>? extraLabels = null)
     {
         try
         {
+            var capabilityCounts = (await _kubernetesPodService.GetActivePodsAsync(entity))
+                .GroupBy(GetPodCapability)
+                .ToDictionary(g => g.Key, g => g.Count());
+
             foreach (var job in jobsToSpawn)
             {
-                string capability = "base";
-                if (job.Demands != null && entity.Spec.CapabilityImages != null)
+                // Use the first demand that matches a capability image
+                var capability = MatchCapabilityImage(entity, job.Demands) ?? "base";
+                if (entity.Spec.CapabilityScaling.TryGetValue(capability, out var capabilityScaling) &&
+                    capabilityScaling.MaxAgents.HasValue &&
+                    capabilityCounts.GetValueOrDefault(capability) >= capabilityScaling.MaxAgents.Value)
                 {
-                    // Use the first demand that matches a capability image
-                    var matched = job.Demands.FirstOrDefault(d => entity.Spec.CapabilityImages.ContainsKey(d));
-                    if (!string.IsNullOrEmpty(matched))
-                    {
-                        capability = matched;
-                    }
+                    _logger.LogInformation("Not spawning an agent for job {JobId}, capability '{Capability}' is at its maximum of {MaxAgents}",
+                        job.RequestId, capability, capabilityScaling.MaxAgents.Value);
+                    continue;
                 }
+
+                capabilityCounts[capability] = capabilityCounts.GetValueOrDefault(capability) + 1;
                 var labels = extraLabels != null ? new Dictionary<string, string>(extraLabels) : new Dictionary<string, string>();
                 labels["job-request-id"] = job.RequestId.ToString();
                 var agentIndex = _kubernetesPodService.GetNextAvailableAgentIndex(entity);
@@ -697,12 +1177,12 @@ public class AzureDevOpsPollingService : BackgroundService
         try
         {
             // Only try to reuse agents if TtlIdleSeconds > 0 (reuse is only meaningful with a grace period)
-            if (entity.Spec.TtlIdleSeconds <= 0)
+            if (entity.Spec.GetTtlIdleSeconds() <= 0)
             {
                 return false;
             }
 
-            var ttlIdleSeconds = entity.Spec.TtlIdleSeconds;
+            var ttlIdleSeconds = entity.Spec.GetTtlIdleSeconds();
             var idleThreshold = DateTime.UtcNow.AddSeconds(-ttlIdleSeconds);
 
             // Get minimum agent pods to protect them from being reassigned
@@ -713,7 +1193,7 @@ public class AzureDevOpsPollingService : BackgroundService
             var eligibleIdleAgents = operatorManagedAgents.Where(agent =>
                 // Agent must be online or running (but not busy)
                 (agent.Status?.ToLower() == "online" || agent.Status?.ToLower() == "running") &&
-                IsOperatorManagedAgent(agent.Name, entity.Metadata.Name) &&
+                IsOperatorManagedAgent(agent.Name, entity) &&
                 // Don't reuse minimum agents
                 !minAgentNames.Contains(agent.Name) &&
                 // Agent must be within the idle time window (not yet expired)
@@ -732,13 +1212,9 @@ public class AzureDevOpsPollingService : BackgroundService
 
             // Determine required capability for the job
             string requiredCapability = "base";
-            if (entity.Spec.CapabilityAware && job.Demands != null && entity.Spec.CapabilityImages != null)
+            if (entity.Spec.CapabilityAware)
             {
-                var matched = job.Demands.FirstOrDefault(d => entity.Spec.CapabilityImages.ContainsKey(d));
-                if (!string.IsNullOrEmpty(matched))
-                {
-                    requiredCapability = matched;
-                }
+                requiredCapability = MatchCapabilityImage(entity, job.Demands) ?? "base";
             }
 
             // Find a pod that matches the required capability and is truly idle
@@ -898,30 +1374,15 @@ public class AzureDevOpsPollingService : BackgroundService
     {
         try
         {
-            // Try to unregister from Azure DevOps first
             var azureAgents = await _azureDevOpsService.GetPoolAgentsAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
             var correspondingAgent = azureAgents.FirstOrDefault(agent => agent.Name == podToRemove.Metadata.Name);
 
-            if (correspondingAgent != null && IsOperatorManagedAgent(correspondingAgent.Name, entity.Metadata.Name))
+            // A base agent may be running a job, let it finish; if it's still around next poll
+            // it shows up as an excess minimum agent and the drain continues from there
+            if (await DrainAndRemoveAgentAsync(entity, pat, podToRemove, correspondingAgent))
             {
-                var unregistered = await _azureDevOpsService.UnregisterAgentAsync(
-                    entity.Spec.AzDoUrl, entity.Spec.Pool, correspondingAgent.Name, pat);
-
-                if (unregistered)
-                {
-                    _logger.LogInformation("Unregistered minimum agent '{AgentName}' from Azure DevOps", correspondingAgent.Name);
-                }
-                else
-                {
-                    _logger.LogWarning("Failed to unregister minimum agent '{AgentName}' from Azure DevOps, but continuing with pod deletion",
-                        correspondingAgent.Name);
-                }
+                _logger.LogInformation("Deleted minimum agent pod '{PodName}'", podToRemove.Metadata.Name);
             }
-
-            // Delete the pod
-            await _kubernetesPodService.DeletePodAsync(podToRemove.Metadata.Name,
-                podToRemove.Metadata.NamespaceProperty ?? "default");
-            _logger.LogInformation("Deleted minimum agent pod '{PodName}'", podToRemove.Metadata.Name);
         }
         catch (Exception ex)
         {
@@ -929,7 +1390,7 @@ public class AzureDevOpsPollingService : BackgroundService
         }
     }
 
-    private async void UpdateEntityStatus(V1AzDORunnerEntity entity, List<Agent> azureAgents, List<V1Pod> pods, int queuedJobs, string connectionStatus = "Disconnected", string? lastError = null)
+    private async void UpdateEntityStatus(V1AzDORunnerEntity entity, List<Agent> azureAgents, List<V1Pod> pods, int queuedJobs, int runningJobs, string connectionStatus = "Disconnected", string? lastError = null, string? resolvedPoolName = null, DateTime? lastDemandTime = null, int? desiredAgents = null, int? currentAgents = null, bool scaled = false, int consecutiveFailures = 0)
     {
         try
         {
@@ -938,7 +1399,7 @@ public class AzureDevOpsPollingService : BackgroundService
             if (freshEntity != null)
             {
                 // Filter to only count operator-managed agents for status
-                var operatorManagedAgents = azureAgents.Where(a => IsOperatorManagedAgent(a.Name, entity.Metadata.Name)).ToList();
+                var operatorManagedAgents = azureAgents.Where(a => IsOperatorManagedAgent(a.Name, entity)).ToList();
 
                 var runningPods = pods.Count(p => p.Status?.Phase == "Running");
                 var pendingPods = pods.Count(p => p.Status?.Phase == "Pending");
@@ -949,43 +1410,106 @@ public class AzureDevOpsPollingService : BackgroundService
                 var availableAgents = operatorManagedAgents.Count(a => a.Status?.ToLower() == "online" || a.Status?.ToLower() == "idle" || a.Status?.ToLower() == "running");
                 var offlineAgents = operatorManagedAgents.Count(a => a.Status?.ToLower() == "offline");
 
+                // A Running pod only provides capacity once its agent is online in Azure DevOps. Until then
+                // it is warming: it still covers its job, but the queue isn't actually being served yet.
+                var warmingPods = GetWarmingPods(pods, operatorManagedAgents).Count;
+
+                _metrics.SetPoolGauges(entity.Metadata.NamespaceProperty ?? "default", entity.Metadata.Name,
+                    availableAgents, queuedJobs, activePods);
+
                 freshEntity.Status.QueuedJobs = queuedJobs;
+                freshEntity.Status.RunningJobs = runningJobs;
                 freshEntity.Status.RunningAgents = operatorManagedAgents.Count;
+                freshEntity.Status.OnlineAgents = availableAgents;
+                freshEntity.Status.WarmingAgents = warmingPods;
+                var (outdatedAgents, newestVersion) = GetOutdatedAgents(operatorManagedAgents);
+                freshEntity.Status.OutdatedAgents = outdatedAgents.Count;
+                var outdatedPods = pods.Count(p => KubernetesPodService.IsRunningOutdatedImage(freshEntity, p));
+                freshEntity.Status.OutdatedPods = outdatedPods;
+                if (desiredAgents.HasValue)
+                {
+                    freshEntity.Status.DesiredAgents = desiredAgents.Value;
+                }
+                if (currentAgents.HasValue)
+                {
+                    freshEntity.Status.CurrentAgents = currentAgents.Value;
+                }
+                if (scaled)
+                {
+                    // Only moves when this poll actually created or deleted pods
+                    freshEntity.Status.LastScaleTime = DateTime.UtcNow;
+                }
                 freshEntity.Status.LastPolled = DateTime.UtcNow;
+                if (lastDemandTime.HasValue)
+                {
+                    freshEntity.Status.LastDemandTime = lastDemandTime;
+                }
                 freshEntity.Status.Active = connectionStatus == "Connected";
                 freshEntity.Status.ConnectionStatus = connectionStatus;
                 freshEntity.Status.LastError = lastError;
+                freshEntity.Status.ConsecutiveFailures = consecutiveFailures;
                 freshEntity.Status.OrganizationName = _azureDevOpsService.ExtractOrganizationName(freshEntity.Spec.AzDoUrl);
+                if (!string.IsNullOrEmpty(resolvedPoolName))
+                {
+                    // Use the canonical name from Azure DevOps, the spec lookup is case-insensitive
+                    freshEntity.Status.PoolName = resolvedPoolName;
+                }
                 freshEntity.Status.AgentsSummary = $"{operatorManagedAgents.Count}/{freshEntity.Spec.MaxAgents}";
                 freshEntity.Status.Agents = operatorManagedAgents; // Only show operator-managed agents
 
-                freshEntity.Status.Conditions.Clear();
+                // "Error" was replaced by the Degraded condition
+                freshEntity.Status.Conditions.RemoveAll(c => c.Type == "Error");
+
+                if (freshEntity.Status.Conditions.Any(c => c.Type == "Paused"))
+                {
+                    freshEntity.Status.SetCondition("Paused", "False", "Resumed", string.Empty);
+                }
 
                 if (connectionStatus == "Connected")
                 {
                     var podStatusMessage = containerCreatingPods > 0
-                        ? $"{activePods} pods ({runningPods} running, {pendingPods} pending, {containerCreatingPods} starting)"
-                        : $"{activePods} pods ({runningPods} running, {pendingPods} pending)";
+                        ? $"{activePods} pods ({runningPods} running, {pendingPods} pending, {containerCreatingPods} starting, {warmingPods} warming)"
+                        : $"{activePods} pods ({runningPods} running, {pendingPods} pending, {warmingPods} warming)";
+
+                    freshEntity.Status.SetCondition("Ready", "True", "Reconciled",
+                        $"Pool has {operatorManagedAgents.Count} operator-managed agents ({availableAgents} available, {offlineAgents} offline), {podStatusMessage}, {queuedJobs} queued jobs");
+                    freshEntity.Status.SetCondition("Degraded", "False", "AsExpected", string.Empty);
+
+                    if (outdatedAgents.Count > 0)
+                    {
+                        freshEntity.Status.SetCondition("AgentUpdateRequired", "True", "OutdatedAgents",
+                            $"{outdatedAgents.Count} agents are older than {newestVersion?.ToString() ?? "the newest agent"} or have an update pending: {string.Join(", ", outdatedAgents.Select(a => $"{a.Name} ({a.Version})"))}");
+                    }
+                    else
+                    {
+                        freshEntity.Status.SetCondition("AgentUpdateRequired", "False", "UpToDate", string.Empty);
+                    }
 
-                    freshEntity.Status.Conditions.Add(new V1AzDORunnerEntity.StatusCondition
+                    if (pendingPods > 0 || queuedJobs > 0 || warmingPods > 0)
+                    {
+                        freshEntity.Status.SetCondition("Progressing", "True", "Scaling",
+                            $"{queuedJobs} queued jobs, {pendingPods} pods starting, {warmingPods} agents not online yet");
+                    }
+                    else if (outdatedPods > 0 && freshEntity.Spec.UpdateStrategy == "RollingRecreate")
+                    {
+                        freshEntity.Status.SetCondition("Progressing", "True", "Updating",
+                            $"{outdatedPods} agent pods still run an outdated image");
+                    }
+                    else if (activePods == 0 && freshEntity.Spec.MinAgents == 0)
                     {
-                        Type = "Ready",
-                        Status = "True",
-                        Reason = "Reconciled",
-                        Message = $"Pool has {operatorManagedAgents.Count} operator-managed agents ({availableAgents} available, {offlineAgents} offline), {podStatusMessage}, {queuedJobs} queued jobs",
-                        LastTransitionTime = DateTime.UtcNow
-                    });
+                        freshEntity.Status.SetCondition("Progressing", "False", "ScaledToZero", "No queued jobs and no agents, waiting for work");
+                    }
+                    else
+                    {
+                        freshEntity.Status.SetCondition("Progressing", "False", "Stable", "No queued jobs and all agents are online");
+                    }
                 }
                 else
                 {
-                    freshEntity.Status.Conditions.Add(new V1AzDORunnerEntity.StatusCondition
-                    {
-                        Type = "Error",
-                        Status = "True",
-                        Reason = "Disconnected",
-                        Message = $"Failed to connect to Azure DevOps: {lastError ?? "Unknown error"}",
-                        LastTransitionTime = DateTime.UtcNow
-                    });
+                    var message = $"Failed to connect to Azure DevOps: {lastError ?? "Unknown error"}";
+                    freshEntity.Status.SetCondition("Ready", "False", "Disconnected", message);
+                    freshEntity.Status.SetCondition("Degraded", "True", "Disconnected", message);
+                    freshEntity.Status.SetCondition("Progressing", "False", "Disconnected", message);
                 }
 
                 // Update the status using our status service
@@ -1000,9 +1524,90 @@ public class AzureDevOpsPollingService : BackgroundService
         }
     }
 
-    private static bool IsOperatorManagedAgent(string agentName, string runnerPoolName)
+    private static (List<Agent> Outdated, Version? Newest) GetOutdatedAgents(List<Agent> agents)
     {
-        var expectedPrefix = $"{runnerPoolName}-agent-";
+        // Azure DevOps doesn't expose a target version, so the newest agent in the pool sets the bar
+        var newest = agents
+            .Select(a => Version.TryParse(a.Version, out var version) ? version : null)
+            .Where(version => version != null)
+            .Max();
+
+        var outdated = agents
+            .Where(a => a.PendingUpdate != null ||
+                        (newest != null && Version.TryParse(a.Version, out var version) && version < newest))
+            .ToList();
+        return (outdated, newest);
+    }
+
+    private static string GetPodCapability(V1Pod pod)
+    {
+        return pod.Metadata.Labels?.TryGetValue("capability", out var capability) == true ? capability : "base";
+    }
+
+    private async Task EnsureCapabilityMinimumsAsync(V1AzDORunnerEntity entity, string pat)
+    {
+        if (!entity.Spec.CapabilityAware || entity.Spec.CapabilityScaling.Count == 0)
+        {
+            return;
+        }
+
+        try
+        {
+            var activePods = await _kubernetesPodService.GetActivePodsAsync(entity);
+            var availableSlots = entity.Spec.MaxAgents - activePods.Count;
+
+            foreach (var (capability, scaling) in entity.Spec.CapabilityScaling)
+            {
+                var neededAgents = scaling.MinAgents - activePods.Count(pod => GetPodCapability(pod) == capability);
+                if (neededAgents <= 0)
+                {
+                    continue;
+                }
+
+                if (availableSlots < neededAgents)
+                {
+                    _logger.LogInformation("Only {AvailableSlots} of {NeededAgents} '{Capability}' agents fit under MaxAgents ({MaxAgents}) for pool '{PoolName}'",
+                        Math.Max(0, availableSlots), neededAgents, capability, entity.Spec.MaxAgents, entity.Metadata.Name);
+                    neededAgents = Math.Max(0, availableSlots);
+                }
+
+                for (var i = 0; i < neededAgents; i++)
+                {
+                    var agentIndex = _kubernetesPodService.GetNextAvailableAgentIndex(entity);
+                    await _kubernetesPodService.CreateAgentPodAsync(entity, pat, agentIndex, false, capability);
+                    availableSlots--;
+                }
+
+                if (neededAgents > 0)
+                {
+                    _logger.LogInformation("Created {NeededAgents} '{Capability}' agents to reach its minimum of {MinAgents} in pool '{PoolName}'",
+                        neededAgents, capability, scaling.MinAgents, entity.Metadata.Name);
+                    await PublishEventAsync(entity, "ScaledUp", $"Created {neededAgents} '{capability}' agent pods to reach its minimum of {scaling.MinAgents}");
+                }
+            }
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to ensure capability minimums for pool '{PoolName}'", entity.Metadata.Name);
+        }
+    }
+
+    private static string? MatchCapabilityImage(V1AzDORunnerEntity entity, List<string>? demands)
+    {
+        if (demands == null || entity.Spec.CapabilityImages == null)
+        {
+            return null;
+        }
+
+        // Compare on the demand name only, version constraints don't pick a different image
+        return demands
+            .Select(d => Demand.Parse(d).Name)
+            .FirstOrDefault(name => !string.IsNullOrEmpty(name) && entity.Spec.CapabilityImages.ContainsKey(name));
+    }
+
+    internal static bool IsOperatorManagedAgent(string agentName, V1AzDORunnerEntity entity)
+    {
+        var expectedPrefix = KubernetesPodService.GetAgentNamePrefix(entity);
         if (!agentName.StartsWith(expectedPrefix))
         {
             return false;
@@ -1052,6 +1657,19 @@ public class AzureDevOpsPollingService : BackgroundService
 
             var neededMinAgents = requiredMinAgents - currentMinAgentCount;
 
+            if (neededMinAgents > 0)
+            {
+                // Busy regular agents still count against MaxAgents, the min agents catch up once they finish
+                var activePods = await _kubernetesPodService.GetActivePodsAsync(entity);
+                var availableSlots = Math.Max(0, maxAgents - activePods.Count);
+                if (availableSlots < neededMinAgents)
+                {
+                    _logger.LogInformation("Only {AvailableSlots} of {NeededMinAgents} minimum agents fit under MaxAgents ({MaxAgents}) for pool '{PoolName}'",
+                        availableSlots, neededMinAgents, maxAgents, entity.Metadata.Name);
+                    neededMinAgents = availableSlots;
+                }
+            }
+
             if (neededMinAgents > 0)
             {
                 // Scale up: Create additional minimum agents
@@ -1063,6 +1681,9 @@ public class AzureDevOpsPollingService : BackgroundService
                     var agentIndex = _kubernetesPodService.GetNextAvailableAgentIndex(entity);
                     await _kubernetesPodService.CreateAgentPodAsync(entity, pat, agentIndex, true);
                 }
+
+                await PublishEventAsync(entity, "ScaledUp",
+                    $"Created {neededMinAgents} minimum agents ({currentMinAgentCount} -> {currentMinAgentCount + neededMinAgents} of {requiredMinAgents})");
             }
             else if (neededMinAgents < 0)
             {
@@ -1072,6 +1693,8 @@ public class AzureDevOpsPollingService : BackgroundService
                     excessMinAgents, entity.Metadata.Name, currentMinAgentCount, requiredMinAgents);
 
                 await RemoveExcessMinimumAgentsAsync(entity, pat, currentMinAgents, excessMinAgents);
+                await PublishEventAsync(entity, "ScaledDown",
+                    $"Removed {excessMinAgents} excess minimum agents ({currentMinAgentCount} -> {requiredMinAgents})");
             }
             else
             {
@@ -1118,14 +1741,11 @@ public class AzureDevOpsPollingService : BackgroundService
                         continue;
                     }
 
-                    if (correspondingAgent != null && IsOperatorManagedAgent(correspondingAgent.Name, entity.Metadata.Name))
+                    if (!await DrainAndRemoveAgentAsync(entity, pat, podToRemove, correspondingAgent))
                     {
-                        _logger.LogInformation("Unregistering excess minimum agent '{AgentName}' from Azure DevOps", correspondingAgent.Name);
-                        await _azureDevOpsService.UnregisterAgentAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, correspondingAgent.Name, pat);
+                        continue;
                     }
 
-                    await _kubernetesPodService.DeletePodAsync(podToRemove.Metadata.Name,
-                        entity.Metadata.NamespaceProperty ?? "default");
                     _logger.LogInformation("Removed excess minimum agent pod '{PodName}' for pool '{PoolName}'",
                         podToRemove.Metadata.Name, entity.Metadata.Name);
                 }
@@ -1235,20 +1855,14 @@ public class AzureDevOpsPollingService : BackgroundService
                         _logger.LogInformation("Skipping removal of agent '{AgentName}' for MaxAgents compliance because it is running a job", podToRemove.Metadata.Name);
                         continue;
                     }
-                    if (correspondingAgent != null && IsOperatorManagedAgent(correspondingAgent.Name, entity.Metadata.Name))
+                    if (!await DrainAndRemoveAgentAsync(entity, pat, podToRemove, correspondingAgent))
                     {
-                        var isMinAgent = podToRemove.Metadata.Labels?.ContainsKey("min-agent") == true &&
-                                        podToRemove.Metadata.Labels["min-agent"] == "true";
-                        var agentType = isMinAgent ? "minimum" : "regular";
-
-                        _logger.LogInformation("Unregistering excess {AgentType} agent '{AgentName}' from Azure DevOps for MaxAgents compliance",
-                            agentType, correspondingAgent.Name);
-                        await _azureDevOpsService.UnregisterAgentAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, correspondingAgent.Name, pat);
+                        continue;
                     }
-                    await _kubernetesPodService.DeletePodAsync(podToRemove.Metadata.Name,
-                        entity.Metadata.NamespaceProperty ?? "default");
                     _logger.LogInformation("Removed excess agent pod '{PodName}' for MaxAgents compliance in pool '{PoolName}'",
                         podToRemove.Metadata.Name, entity.Metadata.Name);
+                    await PublishEventAsync(entity, "ScaledDown",
+                        $"Deleted agent {podToRemove.Metadata.Name} to stay within maxAgents ({entity.Spec.MaxAgents})");
                 }
                 catch (Exception ex)
                 {
@@ -1262,4 +1876,183 @@ public class AzureDevOpsPollingService : BackgroundService
             _logger.LogError(ex, "Failed to remove excess agents for pool '{PoolName}'", entity.Metadata.Name);
         }
     }
+
+    // Returns true once the pod is gone, false while the agent is still finishing its job
+    private async Task<bool> DrainAndRemoveAgentAsync(V1AzDORunnerEntity entity, string pat, V1Pod pod, Agent? agent, bool forceAfterDrainTimeout = true)
+    {
+        var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+        var drainKey = GetDrainKey(entity, pod.Metadata.Name);
+
+        if (agent != null && IsOperatorManagedAgent(agent.Name, entity))
+        {
+            DateTime drainStarted;
+            if (_drainingAgents.TryGetValue(drainKey, out var drain))
+            {
+                drainStarted = drain.StartedAt;
+            }
+            else if (TryGetDrainStarted(pod, out drainStarted))
+            {
+                _logger.LogInformation("Resuming drain of agent '{AgentName}' started at {DrainStarted}", agent.Name, drainStarted);
+            }
+            else
+            {
+                // Disabled agents get no new jobs, so whatever is running now is the last one
+                _logger.LogInformation("Draining agent '{AgentName}' before removal", agent.Name);
+                if (!await _azureDevOpsService.DisableAgentAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, agent.Name, pat))
+                {
+                    // An agent that can still be handed jobs isn't draining, try again on the next poll
+                    _logger.LogWarning("Failed to disable agent '{AgentName}', retrying the drain on the next poll", agent.Name);
+                    return false;
+                }
+
+                drainStarted = DateTime.UtcNow;
+                await _kubernetesPodService.UpdatePodAnnotationsAsync(pod.Metadata.Name, namespaceName,
+                    new Dictionary<string, string> { { DrainStartedAnnotation, drainStarted.ToString("o") } });
+            }
+
+            // Refreshed on every poll that still wants the agent gone, see CancelAbandonedDrainsAsync
+            _drainingAgents[drainKey] = new AgentDrain(drainStarted, DateTime.UtcNow);
+
+            // Re-read after disabling, a job may have been assigned right before
+            var jobRequests = await _azureDevOpsService.GetJobRequestsAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+            var runningJob = jobRequests.FirstOrDefault(j => j.IsRunning && j.AgentId == agent.Id);
+            if (runningJob != null)
+            {
+                // Without forcing, e.g. for an image update, the job gets as long as it needs
+                var drainTimeout = TimeSpan.FromSeconds(entity.Spec.DrainTimeoutSeconds);
+                if (!forceAfterDrainTimeout || DateTime.UtcNow - drainStarted < drainTimeout)
+                {
+                    _logger.LogInformation("Agent '{AgentName}' is draining, waiting for job {JobRequestId} to finish",
+                        agent.Name, runningJob.RequestId);
+                    return false;
+                }
+
+                _logger.LogWarning("Agent '{AgentName}' still running job {JobRequestId} after {DrainTimeoutSeconds}s drain timeout, force deleting",
+                    agent.Name, runningJob.RequestId, entity.Spec.DrainTimeoutSeconds);
+                await PublishEventAsync(entity, "DrainTimeout",
+                    $"Force deleted agent {agent.Name} still running job {runningJob.RequestId} after {entity.Spec.DrainTimeoutSeconds}s",
+                    EventType.Warning);
+            }
+
+            var unregistered = await _azureDevOpsService.UnregisterAgentAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, agent.Name, pat);
+            if (!unregistered)
+            {
+                _logger.LogWarning("Failed to unregister agent '{AgentName}' from Azure DevOps (but will still delete pod)", agent.Name);
+            }
+        }
+
+        await _kubernetesPodService.DeletePodAsync(pod.Metadata.Name, namespaceName);
+        _drainingAgents.TryRemove(drainKey, out _);
+        return true;
+    }
+
+    // A drain nothing asked for during this poll was called off, e.g. because demand came back before the
+    // agent went idle. Left disabled, the agent would sit without jobs for as long as its pod lives.
+    private async Task CancelAbandonedDrainsAsync(V1AzDORunnerEntity entity, string pat, List<Agent> azureAgents, List<JobRequest> jobRequests, DateTime pollStartedAt)
+    {
+        var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+        var runningPods = (await _kubernetesPodService.GetActivePodsAsync(entity)).Where(pod => pod.Status?.Phase == "Running");
+
+        foreach (var pod in runningPods)
+        {
+            var drainKey = GetDrainKey(entity, pod.Metadata.Name);
+            var abandoned = _drainingAgents.TryGetValue(drainKey, out var drain)
+                ? drain.LastRequestedAt < pollStartedAt
+                : TryGetDrainStarted(pod, out _);
+            if (!abandoned)
+            {
+                continue;
+            }
+
+            // The last job of a draining agent still gets to finish
+            if (IsRunningJob(pod, azureAgents, jobRequests))
+            {
+                continue;
+            }
+
+            var agent = azureAgents.FirstOrDefault(a => a.Name == pod.Metadata.Name);
+
+            try
+            {
+                if (agent != null && !await _azureDevOpsService.SetAgentEnabledAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, agent.Name, true, pat))
+                {
+                    _logger.LogWarning("Failed to re-enable agent '{AgentName}' after its drain was called off, retrying on the next poll", agent.Name);
+                    continue;
+                }
+
+                await _kubernetesPodService.UpdatePodAnnotationsAsync(pod.Metadata.Name, namespaceName,
+                    new Dictionary<string, string> { { DrainStartedAnnotation, "" } });
+                _drainingAgents.TryRemove(drainKey, out _);
+                _logger.LogInformation("Called off the drain of agent '{AgentName}', it takes jobs again", pod.Metadata.Name);
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "Failed to call off the drain of agent '{AgentName}'", pod.Metadata.Name);
+            }
+        }
+    }
+
+    private bool IsDraining(V1AzDORunnerEntity entity, V1Pod pod)
+    {
+        return _drainingAgents.ContainsKey(GetDrainKey(entity, pod.Metadata.Name)) || TryGetDrainStarted(pod, out _);
+    }
+
+    private static bool TryGetDrainStarted(V1Pod pod, out DateTime drainStarted)
+    {
+        if (pod.Metadata.Annotations?.TryGetValue(DrainStartedAnnotation, out var startedValue) == true &&
+            DateTime.TryParse(startedValue, null, System.Globalization.DateTimeStyles.RoundtripKind, out var startedAt))
+        {
+            drainStarted = startedAt.ToUniversalTime();
+            return true;
+        }
+
+        drainStarted = default;
+        return false;
+    }
+
+    private static string GetDrainKey(V1AzDORunnerEntity entity, string podName)
+    {
+        return $"{GetPoolKey(entity)}/{podName}";
+    }
+
+    private static int GetDesiredAgents(V1AzDORunnerEntity entity, int queuedJobs, int runningJobs)
+    {
+        // One agent per running job and per JobsPerAgent queued jobs, kept between MinAgents and MaxAgents
+        var jobsPerAgent = Math.Max(1, entity.Spec.JobsPerAgent);
+        var queuedAgents = (queuedJobs + jobsPerAgent - 1) / jobsPerAgent;
+        return Math.Min(entity.Spec.MaxAgents, Math.Max(entity.Spec.MinAgents, queuedAgents + runningJobs));
+    }
+
+    private async Task ReportDryRunAsync(V1AzDORunnerEntity entity, int queuedJobs, int runningJobs, int activePods)
+    {
+        var desiredAgents = GetDesiredAgents(entity, queuedJobs, runningJobs);
+        if (desiredAgents == activePods)
+        {
+            _logger.LogInformation("DRY RUN: pool '{PoolName}' is at its desired {DesiredAgents} agents", entity.Metadata.Name, desiredAgents);
+            return;
+        }
+
+        var action = desiredAgents > activePods
+            ? $"create {desiredAgents - activePods} agent pods"
+            : $"remove {activePods - desiredAgents} agent pods";
+        var message = $"Dry run: would {action} ({activePods} -> {desiredAgents}) for {queuedJobs} queued and {runningJobs} running jobs";
+
+        _logger.LogInformation("DRY RUN: {Message} in pool '{PoolName}'", message, entity.Metadata.Name);
+        await PublishEventAsync(entity, "DryRun", message);
+    }
+
+    private async Task PublishEventAsync(V1AzDORunnerEntity entity, string reason, string message, EventType type = EventType.Normal)
+    {
+        try
+        {
+            await _eventPublisher(entity, reason, message, type);
+        }
+        catch (Exception ex)
+        {
+            // Events are informational, never let them break a poll
+            _logger.LogDebug(ex, "Failed to publish {Reason} event for pool '{PoolName}'", reason, entity.Metadata.Name);
+        }
+    }
+
+    private record AgentDrain(DateTime StartedAt, DateTime LastRequestedAt);
 }
@@ -0,0 +1,70 @@
+using System.Collections.Concurrent;
+using System.Security.Cryptography;
+using System.Text;
+using AzDORunner.Model.Domain;
+
+namespace AzDORunner.Services;
+
+public class AzureDevOpsPoolCache
+{
+    #region Fields
+
+    private readonly ConcurrentDictionary<CacheKey, CacheEntry> _pools = new();
+    private readonly TimeSpan _ttl = TimeSpan.FromMinutes(10);
+
+    #endregion
+
+    #region Public Methods
+
+    public bool TryGet(string azDoUrl, string poolName, string pat, out Pool pool)
+    {
+        if (_pools.TryGetValue(CreateKey(azDoUrl, poolName, pat), out var entry) &&
+            DateTime.UtcNow - entry.CachedAt < _ttl)
+        {
+            pool = entry.Pool;
+            return true;
+        }
+
+        pool = null!;
+        return false;
+    }
+
+    public void Set(string azDoUrl, string poolName, string pat, Pool pool)
+    {
+        _pools[CreateKey(azDoUrl, poolName, pat)] = new CacheEntry(pool, DateTime.UtcNow);
+    }
+
+    public void Evict(string azDoUrl, string poolName)
+    {
+        var url = NormalizeUrl(azDoUrl);
+        foreach (var key in _pools.Keys.Where(k => k.AzDoUrl == url && k.PoolName == poolName.ToLowerInvariant()))
+        {
+            _pools.TryRemove(key, out _);
+        }
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private static CacheKey CreateKey(string azDoUrl, string poolName, string pat)
+    {
+        // The PAT is part of the key so a rotated token never reuses a lookup made with the old one.
+        // The token is what matters rather than the Secret's resourceVersion: a label edit changes the
+        // version but not the token, and a PAT revoked in Azure DevOps changes neither. That case is
+        // covered by failing list calls evicting the pool.
+        var patHash = Convert.ToHexString(SHA256.HashData(Encoding.UTF8.GetBytes(pat)));
+        return new CacheKey(NormalizeUrl(azDoUrl), poolName.ToLowerInvariant(), patHash);
+    }
+
+    private static string NormalizeUrl(string azDoUrl)
+    {
+        return azDoUrl.TrimEnd('/').ToLowerInvariant();
+    }
+
+    private record CacheKey(string AzDoUrl, string PoolName, string PatHash);
+
+    private record CacheEntry(Pool Pool, DateTime CachedAt);
+
+    #endregion
+}
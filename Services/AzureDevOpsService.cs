@@ -1,4 +1,7 @@
+using System.Net.Security;
+using System.Security.Cryptography.X509Certificates;
 using System.Text.Json;
+using System.Text.Json.Nodes;
 using System.Text;
 using AzDORunner.Model.Domain;
 
@@ -9,10 +12,22 @@ public interface IAzureDevOpsService
     Task<List<JobRequest>> GetJobRequestsAsync(string azDoUrl, string poolName, string pat);
     Task<List<JobRequest>> GetQueuedJobsWithCapabilitiesAsync(string azDoUrl, string poolName, string pat);
     Task<bool> TestConnectionAsync(string azDoUrl, string pat);
+    Task<ConnectionCheckResult> CheckConnectionAsync(string azDoUrl, string pat);
     Task<int> GetQueuedJobsCountAsync(string azDoUrl, string poolName, string pat);
+    Task<int> GetRunningJobsCountAsync(string azDoUrl, string poolName, string pat);
+    Task<List<Pool>> ListPoolsAsync(string azDoUrl, string pat);
     Task<List<string>> GetAvailablePoolNamesAsync(string azDoUrl, string pat);
+    Task<Pool?> GetPoolAsync(string azDoUrl, string poolName, string pat);
+    Task<PoolLookup> LookupPoolAsync(string azDoUrl, string poolName, string pat, TimeSpan timeout, CancellationToken cancellationToken);
+    void EvictCachedPool(string azDoUrl, string poolName);
     Task<List<Agent>> GetPoolAgentsAsync(string azDoUrl, string poolName, string pat);
+    Task<int?> GetPoolAgentCountAsync(string azDoUrl, string poolName, string pat);
+    Task<List<Agent>> GetOfflineAgentsOlderThanAsync(string azDoUrl, string poolName, TimeSpan age, string pat);
+    Task<Agent?> GetAgentByNameAsync(string azDoUrl, string poolName, string agentName, string pat);
     Task<bool> UnregisterAgentAsync(string azDoUrl, string poolName, string agentName, string pat);
+    Task<bool> CancelJobRequestAsync(string azDoUrl, string poolName, int requestId, string pat);
+    Task<bool> DisableAgentAsync(string azDoUrl, string poolName, string agentName, string pat);
+    Task<bool> SetAgentEnabledAsync(string azDoUrl, string poolName, string agentName, bool enabled, string pat);
     string ExtractOrganizationName(string azDoUrl);
 }
 
@@ -20,17 +35,78 @@ public class AzureDevOpsService : IAzureDevOpsService
 {
     #region Fields
 
+    private static readonly TimeSpan MaxRetryAfter = TimeSpan.FromSeconds(60);
+
     private readonly HttpClient _httpClient;
     private readonly ILogger<AzureDevOpsService> _logger;
+    private readonly AzureDevOpsPoolCache _poolCache;
+    private readonly int _maxRetryAttempts;
+    private readonly TimeSpan _retryBaseDelay;
+    private readonly TimeSpan _requestTimeout;
+    private readonly CancellationToken _stoppingToken;
 
     #endregion
 
     #region Constructor
 
-    public AzureDevOpsService(HttpClient httpClient, ILogger<AzureDevOpsService> logger)
+    public AzureDevOpsService(HttpClient httpClient, ILogger<AzureDevOpsService> logger, AzureDevOpsPoolCache poolCache, IHostApplicationLifetime lifetime)
     {
         _httpClient = httpClient;
         _logger = logger;
+        _poolCache = poolCache;
+        _stoppingToken = lifetime.ApplicationStopping;
+        _maxRetryAttempts = int.TryParse(Environment.GetEnvironmentVariable("AZDO_RETRY_MAX_ATTEMPTS"), out var attempts) && attempts > 0
+            ? attempts
+            : 4;
+        _retryBaseDelay = TimeSpan.FromMilliseconds(
+            int.TryParse(Environment.GetEnvironmentVariable("AZDO_RETRY_BASE_DELAY_MS"), out var delayMs) && delayMs > 0
+                ? delayMs
+                : 500);
+        _requestTimeout = TimeSpan.FromSeconds(
+            int.TryParse(Environment.GetEnvironmentVariable("AZDO_REQUEST_TIMEOUT_SECONDS"), out var timeoutSeconds) && timeoutSeconds > 0
+                ? timeoutSeconds
+                : 15);
+    }
+
+    #endregion
+
+    #region Http Handler
+
+    // AZDO_CA_BUNDLE points at a PEM file with the CA(s) of an on-prem Azure DevOps Server.
+    // Certificates that chain to those roots are accepted on top of the system trust store.
+    public static HttpMessageHandler CreateHttpHandler()
+    {
+        var handler = new SocketsHttpHandler();
+        var caBundlePath = Environment.GetEnvironmentVariable("AZDO_CA_BUNDLE");
+        if (string.IsNullOrWhiteSpace(caBundlePath))
+            return handler;
+
+        var extraRoots = new X509Certificate2Collection();
+        extraRoots.ImportFromPemFile(caBundlePath);
+
+        handler.SslOptions.RemoteCertificateValidationCallback = (_, certificate, chain, errors) =>
+        {
+            if (errors == SslPolicyErrors.None)
+                return true;
+
+            // Only chain errors can be fixed by extra roots, a name mismatch stays fatal
+            if (certificate == null || errors != SslPolicyErrors.RemoteCertificateChainErrors)
+                return false;
+
+            using var customChain = new X509Chain();
+            customChain.ChainPolicy.TrustMode = X509ChainTrustMode.CustomRootTrust;
+            customChain.ChainPolicy.CustomTrustStore.AddRange(extraRoots);
+            customChain.ChainPolicy.RevocationMode = X509RevocationMode.NoCheck;
+            if (chain != null)
+            {
+                foreach (var element in chain.ChainElements)
+                    customChain.ChainPolicy.ExtraStore.Add(element.Certificate);
+            }
+
+            return customChain.Build(new X509Certificate2(certificate));
+        };
+
+        return handler;
     }
 
     #endregion
@@ -47,35 +123,36 @@ public class AzureDevOpsService : IAzureDevOpsService
             if (poolId == null)
             {
                 _logger.LogWarning("Pool '{PoolName}' not found for job requests", poolName);
-                return new List<JobRequest>();
+                throw ListFailed(azDoUrl, poolName, "job requests");
             }
 
-            var request = new HttpRequestMessage(HttpMethod.Get,
-                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests?api-version=7.0");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
-
-            var response = await _httpClient.SendAsync(request);
-            if (!response.IsSuccessStatusCode)
+            var allJobs = await GetAllPagesAsync<JobRequest>(
+                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests?api-version=7.0", pat);
+            if (allJobs == null)
             {
-                _logger.LogError("Failed to get job requests for pool '{PoolName}': {StatusCode}", poolName, response.StatusCode);
-                return new List<JobRequest>();
+                _logger.LogError("Failed to get job requests for pool '{PoolName}'", poolName);
+                throw ListFailed(azDoUrl, poolName, "job requests");
             }
 
-            var content = await response.Content.ReadAsStringAsync();
-            var jobRequests = JsonSerializer.Deserialize<JobRequestsResponse>(content, new JsonSerializerOptions
+            // The queue can shift between pages, a job showing up twice would get two agents
+            allJobs = allJobs.DistinctBy(j => j.RequestId).ToList();
+
+            foreach (var job in allJobs)
             {
-                PropertyNameCaseInsensitive = true
-            });
+                // The API reports the assigned agent as reservedAgent rather than a flat agent id
+                if (job.ReservedAgent != null)
+                {
+                    job.AgentId = job.ReservedAgent.Id;
+                }
+            }
 
-            var allJobs = jobRequests?.Value ?? new List<JobRequest>();
             _logger.LogInformation("Pool '{PoolName}': {JobCount} total job requests", poolName, allJobs.Count);
             return allJobs;
         }
-        catch (Exception ex)
+        catch (Exception ex) when (ex is not AzureDevOpsRequestException)
         {
             _logger.LogError(ex, "Failed to get job requests for pool '{PoolName}' from {AzDoUrl}", poolName, azDoUrl);
-            return new List<JobRequest>();
+            throw ListFailed(azDoUrl, poolName, "job requests", ex);
         }
     }
 
@@ -89,28 +166,18 @@ public class AzureDevOpsService : IAzureDevOpsService
             if (poolId == null)
             {
                 _logger.LogWarning("Pool '{PoolName}' not found for job requests with capabilities", poolName);
-                return new List<JobRequest>();
+                throw ListFailed(azDoUrl, poolName, "job requests");
             }
 
-            var request = new HttpRequestMessage(HttpMethod.Get,
-                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests?api-version=7.0&$expand=jobs");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
-
-            var response = await _httpClient.SendAsync(request);
-            if (!response.IsSuccessStatusCode)
+            var jobRequests = await GetAllPagesAsync<JobRequest>(
+                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests?api-version=7.0&$expand=jobs", pat);
+            if (jobRequests == null)
             {
-                _logger.LogError("Failed to get job requests with capabilities for pool '{PoolName}': {StatusCode}", poolName, response.StatusCode);
-                return new List<JobRequest>();
+                _logger.LogError("Failed to get job requests with capabilities for pool '{PoolName}'", poolName);
+                throw ListFailed(azDoUrl, poolName, "job requests");
             }
 
-            var content = await response.Content.ReadAsStringAsync();
-            var jobRequests = JsonSerializer.Deserialize<JobRequestsResponse>(content, new JsonSerializerOptions
-            {
-                PropertyNameCaseInsensitive = true
-            });
-
-            var queuedJobs = jobRequests?.Value?.Where(j => j.Result == null).ToList() ?? new List<JobRequest>();
+            var queuedJobs = jobRequests.Where(j => j.IsQueued).DistinctBy(j => j.RequestId).ToList();
 
             // Parse demands/capabilities from each job
             foreach (var job in queuedJobs)
@@ -121,150 +188,91 @@ public class AzureDevOpsService : IAzureDevOpsService
             _logger.LogInformation("Pool '{PoolName}': {JobCount} queued jobs with capabilities parsed", poolName, queuedJobs.Count);
             return queuedJobs;
         }
-        catch (Exception ex)
+        catch (Exception ex) when (ex is not AzureDevOpsRequestException)
         {
             _logger.LogError(ex, "Failed to get queued jobs with capabilities for pool '{PoolName}' from {AzDoUrl}", poolName, azDoUrl);
-            return new List<JobRequest>();
+            throw ListFailed(azDoUrl, poolName, "job requests", ex);
         }
     }
 
     public string ExtractOrganizationName(string azDoUrl)
     {
-        try
-        {
-            // Handle formats like:
-            // Cloud: https://dev.azure.com/organization
-            // Cloud: https://organization.visualstudio.com
-            // On-premises: https://tfs.company.com/tfs/CollectionName
-            // On-premises: https://azuredevops.company.com/CollectionName
-            // On-premises: https://server/tfs/CollectionName
-            var uri = new Uri(azDoUrl);
-
-            if (uri.Host == "dev.azure.com")
-            {
-                // Extract from path: /organization
-                var segments = uri.Segments;
-                if (segments.Length > 1)
-                {
-                    return segments[1].TrimEnd('/');
-                }
-            }
-            else if (uri.Host.EndsWith(".visualstudio.com"))
-            {
-                // Extract from subdomain: organization.visualstudio.com
-                var parts = uri.Host.Split('.');
-                if (parts.Length > 0)
-                {
-                    return parts[0];
-                }
-            }
-            else
-            {
-                // Self-hosted Azure DevOps Server/TFS
-                // Extract collection name from path segments
-                var segments = uri.Segments;
-
-                // Look for collection name in various patterns:
-                // /tfs/CollectionName -> return CollectionName
-                // /CollectionName -> return CollectionName
-                if (segments.Length > 1)
-                {
-                    // Skip empty segments and common prefixes
-                    var meaningfulSegments = segments
-                        .Where(s => !string.IsNullOrWhiteSpace(s) && s != "/")
-                        .Select(s => s.TrimEnd('/'))
-                        .Where(s => !string.IsNullOrEmpty(s))
-                        .ToList();
-
-                    if (meaningfulSegments.Any())
-                    {
-                        if (meaningfulSegments.Count > 1 &&
-                            meaningfulSegments[0].Equals("tfs", StringComparison.OrdinalIgnoreCase))
-                        {
-                            return meaningfulSegments[1];
-                        }
-
-                        return meaningfulSegments[0];
-                    }
-                }
-
-                return uri.Host;
-            }
-
-            return "Unknown";
-        }
-        catch
-        {
-            return "Invalid";
-        }
+        return AzureDevOpsUrl.TryParse(azDoUrl, out var parsed) ? parsed.Organization : "Invalid";
     }
 
     public async Task<bool> TestConnectionAsync(string azDoUrl, string pat)
+    {
+        return await CheckConnectionAsync(azDoUrl, pat) == ConnectionCheckResult.Connected;
+    }
+
+    public async Task<ConnectionCheckResult> CheckConnectionAsync(string azDoUrl, string pat)
     {
         try
         {
             _logger.LogDebug("Testing Azure DevOps connection to {AzDoUrl}", azDoUrl);
 
-            var request = new HttpRequestMessage(HttpMethod.Get, $"{azDoUrl.TrimEnd('/')}/_apis/projects?api-version=7.0");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
-
-            var response = await _httpClient.SendAsync(request);
-            var isSuccess = response.IsSuccessStatusCode;
+            // Listing pools needs the same PAT scope the operator uses for everything else
+            var response = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Get, $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools?api-version=7.0", pat));
 
-            if (isSuccess)
+            if (response.IsSuccessStatusCode && response.StatusCode != System.Net.HttpStatusCode.NonAuthoritativeInformation)
             {
                 _logger.LogDebug("Azure DevOps connection test successful for {AzDoUrl}", azDoUrl);
-            }
-            else
-            {
-                _logger.LogWarning("Azure DevOps connection test failed for {AzDoUrl}: {StatusCode}", azDoUrl, response.StatusCode);
+                return ConnectionCheckResult.Connected;
             }
 
-            return isSuccess;
+            _logger.LogWarning("Azure DevOps connection test failed for {AzDoUrl}: {StatusCode}", azDoUrl, response.StatusCode);
+
+            return response.StatusCode switch
+            {
+                // Azure DevOps answers an invalid PAT with a 203 sign-in page instead of a 401
+                System.Net.HttpStatusCode.NonAuthoritativeInformation => ConnectionCheckResult.Unauthorized,
+                System.Net.HttpStatusCode.Unauthorized => ConnectionCheckResult.Unauthorized,
+                System.Net.HttpStatusCode.Forbidden => ConnectionCheckResult.Unauthorized,
+                System.Net.HttpStatusCode.NotFound => ConnectionCheckResult.NotFound,
+                _ => ConnectionCheckResult.Error
+            };
+        }
+        catch (Exception ex) when (ex is HttpRequestException || ex is TaskCanceledException || ex is TimeoutException)
+        {
+            _logger.LogError(ex, "Azure DevOps at {AzDoUrl} is unreachable", azDoUrl);
+            return ConnectionCheckResult.Unreachable;
         }
         catch (Exception ex)
         {
             _logger.LogError(ex, "Failed to test Azure DevOps connection to {AzDoUrl}", azDoUrl);
-            return false;
+            return ConnectionCheckResult.Error;
         }
     }
 
-    public async Task<List<string>> GetAvailablePoolNamesAsync(string azDoUrl, string pat)
+    public async Task<List<Pool>> ListPoolsAsync(string azDoUrl, string pat)
     {
         try
         {
-            _logger.LogDebug("Getting available pool names from {AzDoUrl}", azDoUrl);
-
-            var request = new HttpRequestMessage(HttpMethod.Get,
-                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools?api-version=7.0");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
+            _logger.LogDebug("Listing pools from {AzDoUrl}", azDoUrl);
 
-            var response = await _httpClient.SendAsync(request);
-            if (!response.IsSuccessStatusCode)
+            var pools = await GetAllPagesAsync<Pool>($"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools?api-version=7.0", pat);
+            if (pools == null)
             {
-                _logger.LogError("Failed to get pools: {StatusCode}", response.StatusCode);
-                return new List<string>();
+                _logger.LogError("Failed to get pools from {AzDoUrl}", azDoUrl);
+                return new List<Pool>();
             }
 
-            var content = await response.Content.ReadAsStringAsync();
-            var pools = JsonSerializer.Deserialize<PoolsResponse>(content, new JsonSerializerOptions
-            {
-                PropertyNameCaseInsensitive = true
-            });
-
-            var poolNames = pools?.Value?.Select(p => p.Name).ToList() ?? new List<string>();
-            _logger.LogDebug("Found {PoolCount} available pools: [{PoolNames}]", poolNames.Count, string.Join(", ", poolNames));
-            return poolNames;
+            return pools;
         }
         catch (Exception ex)
         {
-            _logger.LogError(ex, "Failed to get available pool names from {AzDoUrl}", azDoUrl);
-            return new List<string>();
+            _logger.LogError(ex, "Failed to list pools from {AzDoUrl}", azDoUrl);
+            return new List<Pool>();
         }
     }
 
+    public async Task<List<string>> GetAvailablePoolNamesAsync(string azDoUrl, string pat)
+    {
+        var poolNames = (await ListPoolsAsync(azDoUrl, pat)).Select(p => p.Name).ToList();
+        _logger.LogDebug("Found {PoolCount} available pools: [{PoolNames}]", poolNames.Count, string.Join(", ", poolNames));
+        return poolNames;
+    }
+
     public async Task<int> GetQueuedJobsCountAsync(string azDoUrl, string poolName, string pat)
     {
         try
@@ -279,31 +287,20 @@ public class AzureDevOpsService : IAzureDevOpsService
                 var availablePools = await GetAvailablePoolNamesAsync(azDoUrl, pat);
                 _logger.LogWarning("Pool '{PoolName}' not found. Available pools: [{AvailablePools}]",
                     poolName, string.Join(", ", availablePools));
-                return 0;
+                throw ListFailed(azDoUrl, poolName, "job requests");
             }
 
             // Get queued jobs for the pool
-            var request = new HttpRequestMessage(HttpMethod.Get,
-                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests?api-version=7.0");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
-
-            var response = await _httpClient.SendAsync(request);
-            if (!response.IsSuccessStatusCode)
+            var allJobs = await GetAllPagesAsync<JobRequest>(
+                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests?api-version=7.0", pat);
+            if (allJobs == null)
             {
-                _logger.LogError("Failed to get job requests for pool '{PoolName}': {StatusCode}", poolName, response.StatusCode);
-                return 0;
+                _logger.LogError("Failed to get job requests for pool '{PoolName}'", poolName);
+                throw ListFailed(azDoUrl, poolName, "job requests");
             }
 
-            var content = await response.Content.ReadAsStringAsync();
-            var jobRequests = JsonSerializer.Deserialize<JobRequestsResponse>(content, new JsonSerializerOptions
-            {
-                PropertyNameCaseInsensitive = true
-            });
-
-            // Enhanced queued job detection with detailed logging
-            var allJobs = jobRequests?.Value ?? new List<JobRequest>();
-            var queuedJobs = allJobs.Where(j => j.Result == null).ToList();
+            // Jobs already assigned to an agent are running, not waiting for capacity
+            var queuedJobs = allJobs.Where(j => j.IsQueued).ToList();
 
             _logger.LogInformation("Pool '{PoolName}': {QueuedJobs} queued jobs out of {TotalJobs} total jobs",
                 poolName, queuedJobs.Count, allJobs.Count);
@@ -317,13 +314,24 @@ public class AzureDevOpsService : IAzureDevOpsService
 
             return queuedJobs.Count;
         }
-        catch (Exception ex)
+        catch (Exception ex) when (ex is not AzureDevOpsRequestException)
         {
             _logger.LogError(ex, "Failed to get queued jobs count for pool '{PoolName}' from {AzDoUrl}", poolName, azDoUrl);
-            return 0;
+            throw ListFailed(azDoUrl, poolName, "job requests", ex);
         }
     }
 
+    public async Task<int> GetRunningJobsCountAsync(string azDoUrl, string poolName, string pat)
+    {
+        var allJobs = await GetJobRequestsAsync(azDoUrl, poolName, pat);
+        var runningJobs = allJobs.Count(j => j.IsRunning);
+
+        _logger.LogDebug("Pool '{PoolName}': {RunningJobs} running jobs out of {TotalJobs} total jobs",
+            poolName, runningJobs, allJobs.Count);
+
+        return runningJobs;
+    }
+
     public async Task<List<Agent>> GetPoolAgentsAsync(string azDoUrl, string poolName, string pat)
     {
         try
@@ -334,50 +342,89 @@ public class AzureDevOpsService : IAzureDevOpsService
             if (poolId == null)
             {
                 _logger.LogWarning("Pool '{PoolName}' not found for agent listing", poolName);
-                return new List<Agent>();
+                throw ListFailed(azDoUrl, poolName, "agents");
             }
 
-            var request = new HttpRequestMessage(HttpMethod.Get,
-                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/agents?api-version=7.0&includeCapabilities=false&includeLastCompletedRequest=true");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
-
-            var response = await _httpClient.SendAsync(request);
-            if (!response.IsSuccessStatusCode)
+            var agents = await GetAllPagesAsync<Agent>(
+                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/agents?api-version=7.0&includeCapabilities=false&includeLastCompletedRequest=true", pat);
+            if (agents == null)
             {
-                _logger.LogError("Failed to get agents for pool '{PoolName}': {StatusCode}", poolName, response.StatusCode);
-                return new List<Agent>();
+                _logger.LogError("Failed to get agents for pool '{PoolName}'", poolName);
+                throw ListFailed(azDoUrl, poolName, "agents");
             }
 
-            var content = await response.Content.ReadAsStringAsync();
-            var agentsResponse = JsonSerializer.Deserialize<AgentsResponse>(content, new JsonSerializerOptions
-            {
-                PropertyNameCaseInsensitive = true
-            });
-
-            if (agentsResponse?.Value != null)
+            // Process the agents to set the application properties from API properties
+            foreach (var agent in agents)
             {
-                // Process the agents to set the application properties from API properties
-                foreach (var agent in agentsResponse.Value)
-                {
-                    agent.CreatedAt = agent.CreatedOn ?? DateTime.UtcNow;
-                    agent.LastActive = agent.LastCompletedRequest?.FinishTime;
-                    agent.Status = agent.Status == "online" ? "Online" : "Offline";
-                }
+                agent.CreatedAt = agent.CreatedOn ?? DateTime.UtcNow;
+                agent.LastActive = agent.LastCompletedRequest?.FinishTime;
+                agent.Status = agent.Status == "online" ? "Online" : "Offline";
             }
 
-            var agents = agentsResponse?.Value ?? new List<Agent>();
-
             _logger.LogInformation("Found {AgentCount} agents in pool '{PoolName}': [{AgentNames}]",
                 agents.Count, poolName, string.Join(", ", agents.Select(a => $"{a.Name}({a.Status})")));
 
             return agents;
         }
-        catch (Exception ex)
+        catch (Exception ex) when (ex is not AzureDevOpsRequestException)
         {
             _logger.LogError(ex, "Failed to get agents for pool '{PoolName}' from {AzDoUrl}", poolName, azDoUrl);
-            return new List<Agent>();
+            throw ListFailed(azDoUrl, poolName, "agents", ex);
+        }
+    }
+
+    public async Task<List<Agent>> GetOfflineAgentsOlderThanAsync(string azDoUrl, string poolName, TimeSpan age, string pat)
+    {
+        var agents = await GetPoolAgentsAsync(azDoUrl, poolName, pat);
+        return agents.Where(a => a.IsOfflineLongerThan(age)).ToList();
+    }
+
+    public async Task<int?> GetPoolAgentCountAsync(string azDoUrl, string poolName, string pat)
+    {
+        try
+        {
+            var poolId = await GetPoolIdAsync(azDoUrl, poolName, pat);
+            if (poolId == null)
+            {
+                _logger.LogWarning("Pool '{PoolName}' not found for counting agents", poolName);
+                return null;
+            }
+
+            // The cached pool's size goes stale, fetch the pool itself. This is one small object
+            // instead of every agent in the pool, use GetPoolAgentsAsync when statuses are needed.
+            var response = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Get,
+                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}?api-version=7.0", pat));
+            if (!response.IsSuccessStatusCode)
+            {
+                _logger.LogError("Failed to get pool '{PoolName}' for counting agents: {StatusCode}", poolName, response.StatusCode);
+                return null;
+            }
+
+            var pool = JsonSerializer.Deserialize<Pool>(await response.Content.ReadAsStringAsync(_stoppingToken), new JsonSerializerOptions
+            {
+                PropertyNameCaseInsensitive = true
+            });
+            return pool?.Size;
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to count agents for pool '{PoolName}' from {AzDoUrl}", poolName, azDoUrl);
+            return null;
+        }
+    }
+
+    public async Task<Agent?> GetAgentByNameAsync(string azDoUrl, string poolName, string agentName, string pat)
+    {
+        // Agent names are unique within a pool and match the pod name for operator-managed agents
+        var agents = await GetPoolAgentsAsync(azDoUrl, poolName, pat);
+        var agent = agents.FirstOrDefault(a => a.Name == agentName);
+        if (agent == null)
+        {
+            _logger.LogDebug("Agent '{AgentName}' not found in pool '{PoolName}'. Available agents: [{AvailableAgents}]",
+                agentName, poolName, string.Join(", ", agents.Select(a => a.Name)));
         }
+
+        return agent;
     }
 
     public async Task<bool> UnregisterAgentAsync(string azDoUrl, string poolName, string agentName, string pat)
@@ -396,14 +443,10 @@ public class AzureDevOpsService : IAzureDevOpsService
             _logger.LogDebug("Found pool ID {PoolId} for pool '{PoolName}'", poolId, poolName);
 
             // First find the agent ID
-            var agents = await GetPoolAgentsAsync(azDoUrl, poolName, pat);
-            _logger.LogDebug("Retrieved {AgentCount} agents from pool '{PoolName}'", agents.Count, poolName);
-
-            var agent = agents.FirstOrDefault(a => a.Name == agentName);
+            var agent = await GetAgentByNameAsync(azDoUrl, poolName, agentName, pat);
             if (agent == null)
             {
-                _logger.LogWarning("Agent '{AgentName}' not found in pool '{PoolName}'. Available agents: [{AvailableAgents}]",
-                    agentName, poolName, string.Join(", ", agents.Select(a => a.Name)));
+                _logger.LogWarning("Agent '{AgentName}' not found in pool '{PoolName}'", agentName, poolName);
                 return false;
             }
 
@@ -414,12 +457,8 @@ public class AzureDevOpsService : IAzureDevOpsService
             var deleteUrl = $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/agents/{agent.Id}?api-version=7.0";
             _logger.LogDebug("Sending DELETE request to: {DeleteUrl}", deleteUrl);
 
-            var request = new HttpRequestMessage(HttpMethod.Delete, deleteUrl);
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
-
-            var response = await _httpClient.SendAsync(request);
-            var responseContent = await response.Content.ReadAsStringAsync();
+            var response = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Delete, deleteUrl, pat));
+            var responseContent = await response.Content.ReadAsStringAsync(_stoppingToken);
 
             if (response.IsSuccessStatusCode)
             {
@@ -441,6 +480,208 @@ public class AzureDevOpsService : IAzureDevOpsService
         }
     }
 
+    public async Task<bool> CancelJobRequestAsync(string azDoUrl, string poolName, int requestId, string pat)
+    {
+        try
+        {
+            var poolId = await GetPoolIdAsync(azDoUrl, poolName, pat);
+            if (poolId == null)
+            {
+                _logger.LogWarning("Pool '{PoolName}' not found for canceling job request {RequestId}", poolName, requestId);
+                return false;
+            }
+
+            // The operator never holds the request's lock, so it finishes the request with the empty lock token
+            var requestUrl = $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/jobrequests/{requestId}?lockToken={Guid.Empty}&api-version=7.0";
+            var body = JsonSerializer.Serialize(new
+            {
+                requestId,
+                finishTime = DateTime.UtcNow,
+                result = "canceled"
+            });
+
+            var response = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Patch, requestUrl, pat,
+                new StringContent(body, Encoding.UTF8, "application/json")));
+
+            if (!response.IsSuccessStatusCode)
+            {
+                _logger.LogError("Failed to cancel job request {RequestId} in pool '{PoolName}': {StatusCode}", requestId, poolName, response.StatusCode);
+                return false;
+            }
+
+            _logger.LogInformation("Canceled job request {RequestId} in pool '{PoolName}'", requestId, poolName);
+            return true;
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to cancel job request {RequestId} in pool '{PoolName}'", requestId, poolName);
+            return false;
+        }
+    }
+
+    public Task<bool> DisableAgentAsync(string azDoUrl, string poolName, string agentName, string pat)
+    {
+        return SetAgentEnabledAsync(azDoUrl, poolName, agentName, false, pat);
+    }
+
+    public async Task<bool> SetAgentEnabledAsync(string azDoUrl, string poolName, string agentName, bool enabled, string pat)
+    {
+        try
+        {
+            var poolId = await GetPoolIdAsync(azDoUrl, poolName, pat);
+            if (poolId == null)
+            {
+                _logger.LogWarning("Pool '{PoolName}' not found for updating agent", poolName);
+                return false;
+            }
+
+            var agent = await GetAgentByNameAsync(azDoUrl, poolName, agentName, pat);
+            if (agent == null)
+            {
+                _logger.LogWarning("Agent '{AgentName}' not found in pool '{PoolName}' for updating", agentName, poolName);
+                return false;
+            }
+
+            var agentUrl = $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools/{poolId}/agents/{agent.Id}?api-version=7.0";
+
+            // Send back the full agent definition so the update doesn't drop fields we don't model
+            var getResponse = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Get, agentUrl, pat));
+            if (!getResponse.IsSuccessStatusCode)
+            {
+                _logger.LogError("Failed to get agent '{AgentName}' in pool '{PoolName}': {StatusCode}", agentName, poolName, getResponse.StatusCode);
+                return false;
+            }
+
+            var definition = JsonNode.Parse(await getResponse.Content.ReadAsStringAsync(_stoppingToken))?.AsObject();
+            if (definition == null)
+            {
+                _logger.LogError("Empty definition returned for agent '{AgentName}' in pool '{PoolName}'", agentName, poolName);
+                return false;
+            }
+
+            definition["enabled"] = enabled;
+            var body = definition.ToJsonString();
+
+            var response = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Patch, agentUrl, pat,
+                new StringContent(body, Encoding.UTF8, "application/json")));
+
+            if (!response.IsSuccessStatusCode)
+            {
+                _logger.LogError("Failed to set enabled={Enabled} on agent '{AgentName}' in pool '{PoolName}': {StatusCode}",
+                    enabled, agentName, poolName, response.StatusCode);
+                return false;
+            }
+
+            _logger.LogInformation("Set enabled={Enabled} on agent '{AgentName}' in pool '{PoolName}'", enabled, agentName, poolName);
+            return true;
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to set enabled={Enabled} on agent '{AgentName}' in pool '{PoolName}'", enabled, agentName, poolName);
+            return false;
+        }
+    }
+
+    public async Task<Pool?> GetPoolAsync(string azDoUrl, string poolName, string pat)
+    {
+        try
+        {
+            // Every pool-scoped call resolves the pool first, don't list all pools each time
+            if (_poolCache.TryGet(azDoUrl, poolName, pat, out var cachedPool))
+            {
+                return cachedPool;
+            }
+
+            _logger.LogDebug("Looking up pool '{PoolName}'", poolName);
+
+            var pools = await GetAllPagesAsync<Pool>($"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools?api-version=7.0", pat);
+            if (pools == null)
+            {
+                _logger.LogError("Failed to get pools list from {AzDoUrl}", azDoUrl);
+                return null;
+            }
+
+            var matchingPools = FindMatchingPools(pools, poolName);
+            if (matchingPools.Count > 1)
+            {
+                _logger.LogError("Pool name '{PoolName}' is ambiguous, it matches pools [{MatchingPools}]. Use the exact name",
+                    poolName, string.Join(", ", matchingPools.Select(p => $"{p.Name} (ID: {p.Id})")));
+                return null;
+            }
+
+            var matchedPool = matchingPools.FirstOrDefault();
+            if (matchedPool != null)
+            {
+                _logger.LogDebug("Found pool: ID={PoolId}, Name='{PoolName}'", matchedPool.Id, matchedPool.Name);
+                _poolCache.Set(azDoUrl, poolName, pat, matchedPool);
+                return matchedPool;
+            }
+
+            _logger.LogWarning("No pool found with name '{PoolName}'", poolName);
+            return null;
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to get pool '{PoolName}'", poolName);
+            return null;
+        }
+    }
+
+    public async Task<PoolLookup> LookupPoolAsync(string azDoUrl, string poolName, string pat, TimeSpan timeout, CancellationToken cancellationToken)
+    {
+        if (_poolCache.TryGet(azDoUrl, poolName, pat, out var cachedPool))
+        {
+            return new PoolLookup { Status = PoolLookupStatus.Found, Pool = cachedPool };
+        }
+
+        // Admission has to answer before the apiserver gives up on the webhook, so there is one
+        // attempt with a short deadline instead of the retries the polling loop can afford
+        using var deadline = CancellationTokenSource.CreateLinkedTokenSource(cancellationToken);
+        deadline.CancelAfter(timeout);
+        try
+        {
+            var pools = await GetAllPagesAsync<Pool>($"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools?api-version=7.0", pat,
+                maxAttempts: 1, cancellationToken: deadline.Token);
+            if (pools == null)
+            {
+                return new PoolLookup { Status = PoolLookupStatus.Unavailable, Error = "Azure DevOps did not return the pool list" };
+            }
+
+            var matchingPools = FindMatchingPools(pools, poolName);
+            if (matchingPools.Count > 1)
+            {
+                return new PoolLookup
+                {
+                    Status = PoolLookupStatus.Ambiguous,
+                    Error = $"the name matches pools [{string.Join(", ", matchingPools.Select(p => p.Name))}]"
+                };
+            }
+
+            if (matchingPools.Count == 0)
+            {
+                return new PoolLookup { Status = PoolLookupStatus.NotFound };
+            }
+
+            _poolCache.Set(azDoUrl, poolName, pat, matchingPools[0]);
+            return new PoolLookup { Status = PoolLookupStatus.Found, Pool = matchingPools[0] };
+        }
+        catch (OperationCanceledException) when (deadline.IsCancellationRequested)
+        {
+            _logger.LogWarning("Looking up pool '{PoolName}' did not finish within {TimeoutSeconds}s", poolName, timeout.TotalSeconds);
+            return new PoolLookup { Status = PoolLookupStatus.Unavailable, Error = $"no answer within {timeout.TotalSeconds}s" };
+        }
+        catch (Exception ex) when (ex is HttpRequestException || ex is TimeoutException || ex is JsonException)
+        {
+            _logger.LogWarning(ex, "Failed to look up pool '{PoolName}'", poolName);
+            return new PoolLookup { Status = PoolLookupStatus.Unavailable, Error = ex.Message };
+        }
+    }
+
+    public void EvictCachedPool(string azDoUrl, string poolName)
+    {
+        _poolCache.Evict(azDoUrl, poolName);
+    }
+
     #endregion
 
     #region Private Methods
@@ -455,7 +696,8 @@ public class AzureDevOpsService : IAzureDevOpsService
         // it will return "mykeyword" directly for exact matching
         foreach (var demand in demands)
         {
-            var cleanDemand = demand.Trim().ToLowerInvariant();
+            // "docker -equals true" asks for the same capability as "docker"
+            var cleanDemand = Demand.Parse(demand).Name.ToLowerInvariant();
 
             // Return the demand as-is for direct matching with capabilityImages keys
             // This enables custom keywords like "mykeyword", "gpu", "docker", etc.
@@ -469,48 +711,164 @@ public class AzureDevOpsService : IAzureDevOpsService
         return null; // No demands found
     }
 
-    private async Task<int?> GetPoolIdAsync(string azDoUrl, string poolName, string pat)
+    private async Task<List<T>?> GetAllPagesAsync<T>(string url, string pat, int? maxAttempts = null, CancellationToken cancellationToken = default)
     {
-        try
-        {
-            _logger.LogDebug("Looking up pool ID for '{PoolName}'", poolName);
+        using var token = CancellationTokenSource.CreateLinkedTokenSource(_stoppingToken, cancellationToken);
+        var items = new List<T>();
+        string? continuationToken = null;
 
-            var request = new HttpRequestMessage(HttpMethod.Get,
-                $"{azDoUrl.TrimEnd('/')}/_apis/distributedtask/pools?api-version=7.0");
-            request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
-                "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
+        // List endpoints return one page at a time and hand out the next page via x-ms-continuationtoken
+        do
+        {
+            var pageUrl = continuationToken == null
+                ? url
+                : $"{url}&continuationToken={Uri.EscapeDataString(continuationToken)}";
 
-            var response = await _httpClient.SendAsync(request);
-            if (!response.IsSuccessStatusCode)
+            var response = await SendWithRetryAsync(() => CreateRequest(HttpMethod.Get, pageUrl, pat), maxAttempts, cancellationToken);
+            // 203 is the sign-in page Azure DevOps serves for a rejected PAT, not a page of results
+            if (!response.IsSuccessStatusCode || response.StatusCode == System.Net.HttpStatusCode.NonAuthoritativeInformation)
             {
-                _logger.LogError("Failed to get pools list: {StatusCode}", response.StatusCode);
+                _logger.LogError("Request to {Url} failed: {StatusCode}", pageUrl, response.StatusCode);
                 return null;
             }
 
-            var content = await response.Content.ReadAsStringAsync();
-            var pools = JsonSerializer.Deserialize<PoolsResponse>(content, new JsonSerializerOptions
+            var content = await response.Content.ReadAsStringAsync(token.Token);
+            var page = JsonSerializer.Deserialize<ApiResponse<T>>(content, new JsonSerializerOptions
             {
                 PropertyNameCaseInsensitive = true
             });
+            items.AddRange(page?.Value ?? new List<T>());
 
-            var matchedPool = pools?.Value?.FirstOrDefault(p =>
-                string.Equals(p.Name, poolName, StringComparison.OrdinalIgnoreCase));
+            var nextToken = response.Headers.TryGetValues("x-ms-continuationtoken", out var values)
+                ? values.FirstOrDefault()
+                : null;
 
-            if (matchedPool != null)
+            // Guard against a server handing back the same token forever
+            continuationToken = nextToken != continuationToken ? nextToken : null;
+        }
+        while (!string.IsNullOrEmpty(continuationToken));
+
+        return items;
+    }
+
+    private static HttpRequestMessage CreateRequest(HttpMethod method, string url, string pat, HttpContent? content = null)
+    {
+        var request = new HttpRequestMessage(method, url) { Content = content };
+        request.Headers.Authorization = new System.Net.Http.Headers.AuthenticationHeaderValue(
+            "Basic", Convert.ToBase64String(Encoding.ASCII.GetBytes($":{pat}")));
+        return request;
+    }
+
+    private async Task<HttpResponseMessage> SendWithRetryAsync(Func<HttpRequestMessage> createRequest, int? maxAttempts = null, CancellationToken cancellationToken = default)
+    {
+        var attempts = maxAttempts ?? _maxRetryAttempts;
+
+        // A request message can only be sent once, so every attempt builds a fresh one
+        for (var attempt = 1; ; attempt++)
+        {
+            var request = createRequest();
+            HttpResponseMessage response;
+
+            // Bound every attempt, a hung Azure DevOps endpoint would otherwise stall the whole poll
+            // Shutdown cancels the request too, so the operator doesn't wait out a slow call before exiting
+            using (var timeout = CancellationTokenSource.CreateLinkedTokenSource(_stoppingToken, cancellationToken))
             {
-                _logger.LogDebug("Found pool: ID={PoolId}, Name='{PoolName}'", matchedPool.Id, matchedPool.Name);
-                return matchedPool.Id;
+                timeout.CancelAfter(_requestTimeout);
+                try
+                {
+                    response = await _httpClient.SendAsync(request, timeout.Token);
+                }
+                catch (OperationCanceledException) when (timeout.IsCancellationRequested && !_stoppingToken.IsCancellationRequested && !cancellationToken.IsCancellationRequested)
+                {
+                    throw new TimeoutException($"{request.Method} {request.RequestUri} did not respond within {_requestTimeout.TotalSeconds}s");
+                }
             }
 
-            _logger.LogWarning("No pool found with name '{PoolName}'", poolName);
-            return null;
+            if (!IsTransientFailure(response.StatusCode))
+            {
+                return response;
+            }
+
+            if (attempt >= attempts)
+            {
+                _logger.LogWarning("Giving up on {Method} {Url} after {Attempts} attempts: {StatusCode}",
+                    request.Method, request.RequestUri, attempt, response.StatusCode);
+                return response;
+            }
+
+            var delay = GetRetryDelay(response, attempt);
+            _logger.LogWarning("Transient failure {StatusCode} for {Method} {Url}, retrying in {DelayMs}ms (attempt {Attempt}/{MaxAttempts})",
+                response.StatusCode, request.Method, request.RequestUri, (int)delay.TotalMilliseconds, attempt, attempts);
+
+            response.Dispose();
+            using var delayToken = CancellationTokenSource.CreateLinkedTokenSource(_stoppingToken, cancellationToken);
+            await Task.Delay(delay, delayToken.Token);
         }
-        catch (Exception ex)
+    }
+
+    private static bool IsTransientFailure(System.Net.HttpStatusCode statusCode)
+    {
+        return statusCode == System.Net.HttpStatusCode.TooManyRequests || (int)statusCode >= 500;
+    }
+
+    internal TimeSpan GetRetryDelay(HttpResponseMessage response, int attempt)
+    {
+        // Azure DevOps sends Retry-After when it throttles, prefer it over our own backoff.
+        // Capped, so a bogus header can't park the poll for hours
+        var retryAfter = response.Headers.RetryAfter;
+        if (retryAfter?.Delta != null)
         {
-            _logger.LogError(ex, "Failed to get pool ID for '{PoolName}'", poolName);
-            return null;
+            return retryAfter.Delta.Value < MaxRetryAfter ? retryAfter.Delta.Value : MaxRetryAfter;
+        }
+
+        if (retryAfter?.Date != null)
+        {
+            var untilDate = retryAfter.Date.Value - DateTimeOffset.UtcNow;
+            if (untilDate > TimeSpan.Zero)
+            {
+                return untilDate < MaxRetryAfter ? untilDate : MaxRetryAfter;
+            }
         }
+
+        var backoffMs = _retryBaseDelay.TotalMilliseconds * Math.Pow(2, attempt - 1);
+        var jitterMs = Random.Shared.NextDouble() * _retryBaseDelay.TotalMilliseconds;
+        return TimeSpan.FromMilliseconds(backoffMs + jitterMs);
+    }
+
+    private static List<Pool> FindMatchingPools(List<Pool> pools, string poolName)
+    {
+        // An exact match wins, otherwise the name has to identify a single pool regardless of case
+        var matchingPools = pools.Where(p => string.Equals(p.Name, poolName, StringComparison.Ordinal)).ToList();
+        if (matchingPools.Count == 0)
+        {
+            matchingPools = pools.Where(p => string.Equals(p.Name, poolName, StringComparison.OrdinalIgnoreCase)).ToList();
+        }
+
+        return matchingPools;
+    }
+
+    // An empty list reads as an idle pool and gets agents scaled down, so a failed list call throws instead.
+    // The cached pool goes too, the next lookup finds out whether the pool or the PAT is gone.
+    private AzureDevOpsRequestException ListFailed(string azDoUrl, string poolName, string items, Exception? innerException = null)
+    {
+        _poolCache.Evict(azDoUrl, poolName);
+        return new AzureDevOpsRequestException($"Failed to get {items} for pool '{poolName}' from Azure DevOps", innerException);
+    }
+
+    private async Task<int?> GetPoolIdAsync(string azDoUrl, string poolName, string pat)
+    {
+        var pool = await GetPoolAsync(azDoUrl, poolName, pat);
+        return pool?.Id;
     }
 
     #endregion
 }
+
+// A list call that failed or was rejected, as opposed to a pool that is really empty
+public class AzureDevOpsRequestException : Exception
+{
+    public AzureDevOpsRequestException(string message, Exception? innerException = null)
+        : base(message, innerException)
+    {
+    }
+}
@@ -13,6 +13,8 @@ public class ErrorPodCleanupService : BackgroundService
     private readonly KubernetesPodService _kubernetesPodService;
     private readonly IAzureDevOpsService _azureDevOpsService;
     private readonly IKubernetes _kubernetesClient;
+    private readonly LeaderElectionService _leaderElection;
+    private readonly AzureDevOpsPollingService _pollingService;
     private readonly ConcurrentDictionary<string, ErrorPodMonitorInfo> _poolsToMonitor = new();
     private readonly TimeSpan _errorPodCheckInterval = TimeSpan.FromSeconds(10); // Check every 10 seconds
 
@@ -24,12 +26,16 @@ public class ErrorPodCleanupService : BackgroundService
         ILogger<ErrorPodCleanupService> logger,
         KubernetesPodService kubernetesPodService,
         IAzureDevOpsService azureDevOpsService,
-        IKubernetes kubernetesClient)
+        IKubernetes kubernetesClient,
+        LeaderElectionService leaderElection,
+        AzureDevOpsPollingService pollingService)
     {
         _logger = logger;
         _kubernetesPodService = kubernetesPodService;
         _azureDevOpsService = azureDevOpsService;
         _kubernetesClient = kubernetesClient;
+        _leaderElection = leaderElection;
+        _pollingService = pollingService;
     }
 
     #endregion
@@ -39,22 +45,25 @@ public class ErrorPodCleanupService : BackgroundService
     public void RegisterPool(V1AzDORunnerEntity entity, string pat)
     {
         var poolName = entity.Metadata.Name;
-        _poolsToMonitor.AddOrUpdate(poolName, (key) => new ErrorPodMonitorInfo
+
+        // Replace rather than mutate the entry, a cleanup pass may be reading the old one
+        _poolsToMonitor.AddOrUpdate(GetPoolKey(entity), (key) => new ErrorPodMonitorInfo
         {
             Entity = entity,
             Pat = pat
-        }, (key, old) =>
+        }, (key, old) => new ErrorPodMonitorInfo
         {
-            old.Entity = entity;
-            old.Pat = pat;
-            return old;
+            Entity = entity,
+            Pat = pat,
+            LastChecked = old.LastChecked
         });
         _logger.LogInformation("Registered pool '{PoolName}' for error pod monitoring", poolName);
     }
 
-    public void UnregisterPool(string poolName)
+    public void UnregisterPool(V1AzDORunnerEntity entity)
     {
-        if (_poolsToMonitor.TryRemove(poolName, out _))
+        var poolName = entity.Metadata.Name;
+        if (_poolsToMonitor.TryRemove(GetPoolKey(entity), out _))
         {
             _logger.LogInformation("Unregistered pool '{PoolName}' from error pod monitoring", poolName);
         }
@@ -86,9 +95,14 @@ public class ErrorPodCleanupService : BackgroundService
 
     #region Private Methods
 
+    private static string GetPoolKey(V1AzDORunnerEntity entity)
+    {
+        return $"{entity.Metadata.NamespaceProperty ?? "default"}/{entity.Metadata.Name}";
+    }
+
     private async Task CheckAndCleanupErrorPods()
     {
-        if (_poolsToMonitor.IsEmpty)
+        if (_poolsToMonitor.IsEmpty || !_leaderElection.IsLeader)
         {
             return;
         }
@@ -106,6 +120,12 @@ public class ErrorPodCleanupService : BackgroundService
                     continue;
                 }
 
+                // Dry-run pools must not lose pods, not even failed ones
+                if (monitorInfo.Entity.Spec.Mode == "DryRun" || _pollingService.IsPaused(monitorInfo.Entity))
+                {
+                    continue;
+                }
+
                 await CleanupErrorPodsForPool(monitorInfo);
                 monitorInfo.LastChecked = currentTime;
             }
@@ -9,21 +9,24 @@ public class KubernetesPodService
 {
     private readonly IKubernetes _kubernetesClient;
     private readonly ILogger<KubernetesPodService> _logger;
+    private readonly OperatorMetrics _metrics;
 
-    public KubernetesPodService(IKubernetes kubernetesClient, ILogger<KubernetesPodService> logger)
+    public KubernetesPodService(IKubernetes kubernetesClient, ILogger<KubernetesPodService> logger, OperatorMetrics metrics)
     {
         _kubernetesClient = kubernetesClient;
         _logger = logger;
+        _metrics = metrics;
     }
 
     public async Task<V1Pod> CreateAgentPodAsync(V1AzDORunnerEntity runnerPool, string pat, int agentIndex, bool isMinAgent = false, string? requiredCapability = null, Dictionary<string, string>? extraLabels = null)
     {
-        var podName = $"{runnerPool.Metadata.Name}-agent-{agentIndex}";
+        var podName = $"{GetAgentNamePrefix(runnerPool)}{agentIndex}";
         var namespaceName = runnerPool.Metadata.NamespaceProperty ?? "default";
 
         // Determine which image to use based on capability requirements
         var imageToUse = DetermineImageForCapability(runnerPool, requiredCapability);
         var capabilityLabel = requiredCapability ?? "base";
+        using var logScope = BeginAgentScope(runnerPool, agentIndex, capabilityLabel);
 
         var labels = new Dictionary<string, string>
         {
@@ -41,6 +44,15 @@ public class KubernetesPodService
                 labels[kv.Key] = kv.Value;
             }
         }
+
+        // Custom labels never replace the ones the operator selects and tracks pods by
+        foreach (var kv in runnerPool.Spec.PodTemplate?.Labels ?? new Dictionary<string, string>())
+        {
+            if (!labels.TryAdd(kv.Key, kv.Value))
+            {
+                _logger.LogDebug("Ignoring podTemplate label {Label} on pod {PodName}, it is reserved by the operator", kv.Key, podName);
+            }
+        }
         var pod = new V1Pod
         {
             ApiVersion = "v1",
@@ -50,22 +62,17 @@ public class KubernetesPodService
                 Name = podName,
                 NamespaceProperty = namespaceName,
                 Labels = labels,
-                OwnerReferences = new List<V1OwnerReference>
-                {
-                    new()
-                    {
-                        ApiVersion = runnerPool.ApiVersion,
-                        Kind = runnerPool.Kind,
-                        Name = runnerPool.Metadata.Name,
-                        Uid = runnerPool.Metadata.Uid,
-                        Controller = true,
-                        BlockOwnerDeletion = true
-                    }
-                }
+                Annotations = runnerPool.Spec.PodTemplate?.Annotations?.Count > 0
+                    ? new Dictionary<string, string>(runnerPool.Spec.PodTemplate.Annotations)
+                    : null,
+                OwnerReferences = new List<V1OwnerReference> { CreateOwnerReference(runnerPool) }
             },
             Spec = new V1PodSpec
             {
                 RestartPolicy = "Never",
+                ImagePullSecrets = runnerPool.Spec.ImagePullSecrets?.Count > 0
+                    ? runnerPool.Spec.ImagePullSecrets.Select(name => new V1LocalObjectReference { Name = name }).ToList()
+                    : null,
                 TerminationGracePeriodSeconds = 30,
                 Containers = new List<V1Container>
                 {
@@ -74,7 +81,7 @@ public class KubernetesPodService
                         Name = "agent",
                         Image = imageToUse,
                         ImagePullPolicy = runnerPool.Spec.ImagePullPolicy,
-                        Args = (!isMinAgent && runnerPool.Spec.TtlIdleSeconds == 0) ? new List<string> { "--once" } : null,
+                        Args = (!isMinAgent && runnerPool.Spec.GetTtlIdleSeconds() == 0) ? new List<string> { "--once" } : null,
                         Env = new List<V1EnvVar>
                         {
                             new()
@@ -101,6 +108,7 @@ public class KubernetesPodService
                             },
                             new()
                             {
+                                // The agent registers under the pod name, so pods and agents map one to one
                                 Name = "AZP_AGENT_NAME",
                                 Value = podName
                             },
@@ -110,6 +118,12 @@ public class KubernetesPodService
                                 Value = capabilityLabel
                             }
                         }.Concat(
+                            string.IsNullOrWhiteSpace(runnerPool.Spec.WorkDir)
+                                ? Enumerable.Empty<V1EnvVar>()
+                                : new[] { new V1EnvVar { Name = "AZP_WORK", Value = runnerPool.Spec.WorkDir } }
+                        ).Concat(
+                            GetProxyEnv(runnerPool.Spec.Proxy)
+                        ).Concat(
                             runnerPool.Spec.ExtraEnv.Select(env => new V1EnvVar
                             {
                                 Name = env.Name,
@@ -122,9 +136,9 @@ public class KubernetesPodService
                             Name = $"{runnerPool.Metadata.Name}-agent-{agentIndex}-{pvc.Name}",
                             MountPath = pvc.MountPath
                         }).Concat(
-                            runnerPool.Spec.CertTrustStore.Select(cert => new V1VolumeMount
+                            runnerPool.Spec.CertTrustStore.Select((cert, certIndex) => new V1VolumeMount
                             {
-                                Name = $"cert-{cert.SecretName}",
+                                Name = GetCertTrustStoreVolumeName(certIndex),
                                 MountPath = $"/etc/ssl/certs/{cert.SecretName}.crt",
                                 SubPath = "tls.crt",
                                 ReadOnlyProperty = true
@@ -132,16 +146,8 @@ public class KubernetesPodService
                         ).ToList(),
                         Resources = new V1ResourceRequirements
                         {
-                            Requests = new Dictionary<string, ResourceQuantity>
-                            {
-                                ["cpu"] = new("100m"),
-                                ["memory"] = new("256Mi")
-                            },
-                            Limits = new Dictionary<string, ResourceQuantity>
-                            {
-                                ["cpu"] = new("2"),
-                                ["memory"] = new("4Gi")
-                            }
+                            Requests = ToResourceQuantities(runnerPool.Spec.Resources?.Requests),
+                            Limits = ToResourceQuantities(runnerPool.Spec.Resources?.Limits)
                         },
                         Lifecycle = new V1Lifecycle
                         {
@@ -153,13 +159,15 @@ public class KubernetesPodService
                                 }
                             }
                         },
-                        SecurityContext = runnerPool.Spec.InitContainer != null ? new V1SecurityContext
+                        SecurityContext = new V1SecurityContext
                         {
                             RunAsUser = runnerPool.Spec.SecurityContext.RunAsUser,
                             RunAsGroup = runnerPool.Spec.SecurityContext.RunAsGroup,
                             RunAsNonRoot = runnerPool.Spec.SecurityContext.RunAsUser != 0,
-                            AllowPrivilegeEscalation = false
-                        } : null
+                            Privileged = runnerPool.Spec.SecurityContext.Privileged,
+                            // Kubernetes rejects privileged containers that disallow privilege escalation
+                            AllowPrivilegeEscalation = runnerPool.Spec.SecurityContext.Privileged
+                        }
                     }
                 },
                 InitContainers = runnerPool.Spec.InitContainer != null ? new List<V1Container>
@@ -188,13 +196,13 @@ public class KubernetesPodService
                         }
                     }
                 } : null,
-                SecurityContext = runnerPool.Spec.InitContainer != null ? new V1PodSecurityContext
+                SecurityContext = new V1PodSecurityContext
                 {
-                    FsGroup = runnerPool.Spec.SecurityContext.FsGroup,
-                    RunAsUser = runnerPool.Spec.SecurityContext.RunAsUser,
-                    RunAsGroup = runnerPool.Spec.SecurityContext.RunAsGroup,
-                    RunAsNonRoot = runnerPool.Spec.SecurityContext.RunAsUser != 0
-                } : null,
+                    FsGroup = runnerPool.Spec.SecurityContext.FsGroup
+                },
+                NodeSelector = runnerPool.Spec.NodeSelector?.Count > 0 ? runnerPool.Spec.NodeSelector : null,
+                Tolerations = runnerPool.Spec.Tolerations?.Count > 0 ? runnerPool.Spec.Tolerations : null,
+                Affinity = runnerPool.Spec.Affinity,
                 Volumes = runnerPool.Spec.Pvcs.Select(pvc => new V1Volume
                 {
                     Name = $"{runnerPool.Metadata.Name}-agent-{agentIndex}-{pvc.Name}",
@@ -203,9 +211,9 @@ public class KubernetesPodService
                         ClaimName = $"{runnerPool.Metadata.Name}-agent-{agentIndex}-{pvc.Name}"
                     }
                 }).Concat(
-                    runnerPool.Spec.CertTrustStore.Select(cert => new V1Volume
+                    runnerPool.Spec.CertTrustStore.Select((cert, certIndex) => new V1Volume
                     {
-                        Name = $"cert-{cert.SecretName}",
+                        Name = GetCertTrustStoreVolumeName(certIndex),
                         Secret = new V1SecretVolumeSource
                         {
                             SecretName = cert.SecretName,
@@ -282,10 +290,11 @@ public class KubernetesPodService
             }
 
             var createdPod = _kubernetesClient.CoreV1.CreateNamespacedPod(pod, namespaceName);
+            _metrics.IncrementPodsCreated(namespaceName, runnerPool.Metadata.Name);
             var agentType = isMinAgent ? "minimum" : "regular";
-            var mode = (!isMinAgent && runnerPool.Spec.TtlIdleSeconds == 0) ? "one-time (--once)" : "continuous";
+            var mode = (!isMinAgent && runnerPool.Spec.GetTtlIdleSeconds() == 0) ? "one-time (--once)" : "continuous";
             _logger.LogInformation("Created {AgentType} agent pod {PodName} in namespace {Namespace} (Mode: {Mode}, TtlIdleSeconds: {TtlIdleSeconds}, Capability: {Capability}, Image: {Image}, ImagePullPolicy: {ImagePullPolicy})",
-                agentType, podName, namespaceName, mode, runnerPool.Spec.TtlIdleSeconds, capabilityLabel, imageToUse, runnerPool.Spec.ImagePullPolicy);
+                agentType, podName, namespaceName, mode, runnerPool.Spec.GetTtlIdleSeconds(), capabilityLabel, imageToUse, runnerPool.Spec.ImagePullPolicy);
             return createdPod;
         }
         catch (Exception ex)
@@ -371,9 +380,19 @@ public class KubernetesPodService
 
     public Task DeletePodAsync(string podName, string namespaceName)
     {
+        using var logScope = _logger.BeginScope(new Dictionary<string, object>
+        {
+            ["pod"] = podName,
+            ["namespace"] = namespaceName
+        });
+
         try
         {
-            _kubernetesClient.CoreV1.DeleteNamespacedPod(podName, namespaceName);
+            var deletedPod = _kubernetesClient.CoreV1.DeleteNamespacedPod(podName, namespaceName);
+            if (deletedPod?.Metadata?.Labels?.TryGetValue("runner-pool", out var runnerPoolName) == true)
+            {
+                _metrics.IncrementPodsDeleted(namespaceName, runnerPoolName);
+            }
             _logger.LogInformation("Deleted pod {PodName} in namespace {Namespace}", podName, namespaceName);
             return Task.CompletedTask;
         }
@@ -384,30 +403,95 @@ public class KubernetesPodService
         }
     }
 
-    public async Task UpdatePodLabelsAsync(string podName, string namespaceName, Dictionary<string, string> labelsToUpdate)
+    // Pods an earlier operator instance created for this RunnerPool are part of the pool's live state.
+    // Pods without this RunnerPool as their controller, e.g. left by a deleted pool of the same name,
+    // are never taken over; they belong to the garbage collector or whoever created them.
+    public async Task<int> CountOwnedPodsAsync(V1AzDORunnerEntity runnerPool)
+    {
+        var owned = 0;
+
+        foreach (var pod in await GetAllRunnerPodsAsync(runnerPool))
+        {
+            var controllerRef = pod.Metadata.OwnerReferences?.FirstOrDefault(o => o.Controller == true);
+            if (controllerRef?.Uid == runnerPool.Metadata.Uid)
+            {
+                owned++;
+                continue;
+            }
+
+            _logger.LogWarning("Pod {PodName} carries runner-pool={RunnerPool} but is not controlled by this RunnerPool, leaving it alone",
+                pod.Metadata.Name, runnerPool.Metadata.Name);
+        }
+
+        return owned;
+    }
+
+    public async Task UpdatePodAnnotationsAsync(string podName, string namespaceName, Dictionary<string, string> annotations)
     {
         try
         {
-            // Get the current pod to retrieve existing labels
             var currentPod = await _kubernetesClient.CoreV1.ReadNamespacedPodAsync(podName, namespaceName);
-
-            // Create a patch to update only the specified labels
-            var patch = new V1Patch(System.Text.Json.JsonSerializer.Serialize(new
+            // Merge onto the current annotations, an empty value removes the annotation
+            currentPod.Metadata.Annotations ??= new Dictionary<string, string>();
+            foreach (var (key, value) in annotations)
             {
-                metadata = new
+                if (string.IsNullOrEmpty(value))
+                {
+                    currentPod.Metadata.Annotations.Remove(key);
+                }
+                else
                 {
-                    labels = labelsToUpdate
+                    currentPod.Metadata.Annotations[key] = value;
                 }
-            }), V1Patch.PatchType.MergePatch);
+            }
 
-            await _kubernetesClient.CoreV1.PatchNamespacedPodAsync(patch, podName, namespaceName);
-            _logger.LogInformation("Updated labels for pod {PodName} in namespace {Namespace}: {Labels}",
-                podName, namespaceName, string.Join(", ", labelsToUpdate.Select(kv => $"{kv.Key}={kv.Value}")));
+            await _kubernetesClient.CoreV1.ReplaceNamespacedPodAsync(currentPod, podName, namespaceName);
         }
         catch (Exception ex)
         {
-            _logger.LogError(ex, "Failed to update labels for pod {PodName} in namespace {Namespace}", podName, namespaceName);
-            throw;
+            _logger.LogWarning(ex, "Failed to update annotations for pod {PodName} in namespace {Namespace}", podName, namespaceName);
+        }
+    }
+
+    public async Task UpdatePodLabelsAsync(string podName, string namespaceName, Dictionary<string, string> labelsToUpdate)
+    {
+        const int maxAttempts = 5;
+
+        for (var attempt = 1; ; attempt++)
+        {
+            try
+            {
+                // Merge onto the current labels, an empty value removes the label
+                var currentPod = await _kubernetesClient.CoreV1.ReadNamespacedPodAsync(podName, namespaceName);
+                currentPod.Metadata.Labels ??= new Dictionary<string, string>();
+                foreach (var (key, value) in labelsToUpdate)
+                {
+                    if (string.IsNullOrEmpty(value))
+                    {
+                        currentPod.Metadata.Labels.Remove(key);
+                    }
+                    else
+                    {
+                        currentPod.Metadata.Labels[key] = value;
+                    }
+                }
+
+                // Replace carries the resourceVersion we read, so a concurrent writer makes this fail instead of being clobbered
+                await _kubernetesClient.CoreV1.ReplaceNamespacedPodAsync(currentPod, podName, namespaceName);
+                _logger.LogInformation("Updated labels for pod {PodName} in namespace {Namespace}: {Labels}",
+                    podName, namespaceName, string.Join(", ", labelsToUpdate.Select(kv => $"{kv.Key}={kv.Value}")));
+                return;
+            }
+            catch (k8s.Autorest.HttpOperationException ex) when (ex.Response.StatusCode == System.Net.HttpStatusCode.Conflict && attempt < maxAttempts)
+            {
+                _logger.LogDebug("Conflict updating labels for pod {PodName}, retrying (attempt {Attempt}/{MaxAttempts})",
+                    podName, attempt, maxAttempts);
+            }
+            catch (Exception ex)
+            {
+                _logger.LogError(ex, "Failed to update labels for pod {PodName} in namespace {Namespace}", podName, namespaceName);
+                throw;
+            }
         }
     }
 
@@ -434,6 +518,7 @@ public class KubernetesPodService
                 try
                 {
                     _kubernetesClient.CoreV1.DeleteNamespacedPod(pod.Metadata.Name, namespaceName);
+                    _metrics.IncrementPodsDeleted(namespaceName, runnerPool.Metadata.Name);
                     _logger.LogInformation("Immediately deleted completed pod {PodName} (Phase: {Phase})",
                         pod.Metadata.Name, pod.Status?.Phase);
                     deletedCount++;
@@ -463,10 +548,112 @@ public class KubernetesPodService
         }
     }
 
+    // Pod and agent names share this prefix. Agent names are unique per Azure DevOps pool, so
+    // RunnerPools with the same name in different namespaces need their own AgentNamePrefix.
+    public static string GetAgentNamePrefix(V1AzDORunnerEntity runnerPool)
+    {
+        var baseName = string.IsNullOrWhiteSpace(runnerPool.Spec.AgentNamePrefix)
+            ? runnerPool.Metadata.Name
+            : runnerPool.Spec.AgentNamePrefix;
+        return $"{baseName}-agent-";
+    }
+
+    private static IEnumerable<V1EnvVar> GetProxyEnv(ProxySpec? proxy)
+    {
+        if (proxy == null)
+        {
+            yield break;
+        }
+
+        // Build tools disagree on the casing, so set both. VSTS_HTTP_PROXY is what the agent itself reads.
+        if (!string.IsNullOrWhiteSpace(proxy.HttpProxy))
+        {
+            yield return new V1EnvVar { Name = "HTTP_PROXY", Value = proxy.HttpProxy };
+            yield return new V1EnvVar { Name = "http_proxy", Value = proxy.HttpProxy };
+        }
+
+        if (!string.IsNullOrWhiteSpace(proxy.HttpsProxy))
+        {
+            yield return new V1EnvVar { Name = "HTTPS_PROXY", Value = proxy.HttpsProxy };
+            yield return new V1EnvVar { Name = "https_proxy", Value = proxy.HttpsProxy };
+        }
+
+        var agentProxy = !string.IsNullOrWhiteSpace(proxy.HttpsProxy) ? proxy.HttpsProxy : proxy.HttpProxy;
+        if (!string.IsNullOrWhiteSpace(agentProxy))
+        {
+            yield return new V1EnvVar { Name = "VSTS_HTTP_PROXY", Value = agentProxy };
+        }
+
+        if (!string.IsNullOrWhiteSpace(proxy.NoProxy))
+        {
+            yield return new V1EnvVar { Name = "NO_PROXY", Value = proxy.NoProxy };
+            yield return new V1EnvVar { Name = "no_proxy", Value = proxy.NoProxy };
+        }
+    }
+
+    private static V1OwnerReference CreateOwnerReference(V1AzDORunnerEntity runnerPool)
+    {
+        return new V1OwnerReference
+        {
+            ApiVersion = runnerPool.ApiVersion,
+            Kind = runnerPool.Kind,
+            Name = runnerPool.Metadata.Name,
+            Uid = runnerPool.Metadata.Uid,
+            Controller = true,
+            BlockOwnerDeletion = true
+        };
+    }
+
+    // Ties every log line of a pod/PVC operation to its pool and agent, visible with LOG_FORMAT=json
+    private IDisposable? BeginAgentScope(V1AzDORunnerEntity runnerPool, int agentIndex, string? capability = null)
+    {
+        var scope = new Dictionary<string, object>
+        {
+            ["runner-pool"] = runnerPool.Metadata.Name,
+            ["namespace"] = runnerPool.Metadata.NamespaceProperty ?? "default",
+            ["agent-index"] = agentIndex
+        };
+
+        if (capability != null)
+        {
+            scope["capability"] = capability;
+        }
+
+        return _logger.BeginScope(scope);
+    }
+
+    private static Dictionary<string, ResourceQuantity>? ToResourceQuantities(Dictionary<string, string>? resources)
+    {
+        // An empty map leaves the container without requests/limits instead of sending an empty object
+        if (resources == null || resources.Count == 0)
+            return null;
+
+        return resources.ToDictionary(r => r.Key, r => new ResourceQuantity(r.Value));
+    }
+
+    public async Task DeleteAllRunnerPodsAsync(V1AzDORunnerEntity runnerPool)
+    {
+        var namespaceName = runnerPool.Metadata.NamespaceProperty ?? "default";
+
+        try
+        {
+            // One request for everything carrying our label, no need to know the individual pods
+            await _kubernetesClient.CoreV1.DeleteCollectionNamespacedPodAsync(namespaceName,
+                labelSelector: $"runner-pool={runnerPool.Metadata.Name},managed-by=azdo-runner-operator");
+            _logger.LogInformation("Deleted all pods labelled runner-pool={Name} in namespace {Namespace}",
+                runnerPool.Metadata.Name, namespaceName);
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to delete pods by label for RunnerPool {Name}", runnerPool.Metadata.Name);
+        }
+    }
+
     public async Task DeleteAgentAsync(V1AzDORunnerEntity runnerPool, int agentIndex)
     {
         var namespaceName = runnerPool.Metadata.NamespaceProperty ?? "default";
-        var podName = $"{runnerPool.Metadata.Name}-agent-{agentIndex}";
+        var podName = $"{GetAgentNamePrefix(runnerPool)}{agentIndex}";
+        using var logScope = BeginAgentScope(runnerPool, agentIndex);
 
         try
         {
@@ -530,6 +717,7 @@ public class KubernetesPodService
     {
         var pvcName = $"{runnerPool.Metadata.Name}-agent-{agentIndex}-{pvcSpec.Name}";
         var namespaceName = runnerPool.Metadata.NamespaceProperty ?? "default";
+        using var logScope = BeginAgentScope(runnerPool, agentIndex);
 
         var pvc = new V1PersistentVolumeClaim
         {
@@ -547,18 +735,7 @@ public class KubernetesPodService
                     ["agent-index"] = agentIndex.ToString(),
                     ["pvc-name"] = pvcSpec.Name
                 },
-                OwnerReferences = new List<V1OwnerReference>
-                {
-                    new()
-                    {
-                        ApiVersion = runnerPool.ApiVersion,
-                        Kind = runnerPool.Kind,
-                        Name = runnerPool.Metadata.Name,
-                        Uid = runnerPool.Metadata.Uid,
-                        Controller = true,
-                        BlockOwnerDeletion = true
-                    }
-                }
+                OwnerReferences = new List<V1OwnerReference> { CreateOwnerReference(runnerPool) }
             },
             Spec = new V1PersistentVolumeClaimSpec
             {
@@ -605,6 +782,12 @@ public class KubernetesPodService
 
     public Task DeletePvcAsync(string pvcName, string namespaceName)
     {
+        using var logScope = _logger.BeginScope(new Dictionary<string, object>
+        {
+            ["pvc"] = pvcName,
+            ["namespace"] = namespaceName
+        });
+
         try
         {
             _kubernetesClient.CoreV1.DeleteNamespacedPersistentVolumeClaim(pvcName, namespaceName);
@@ -618,6 +801,54 @@ public class KubernetesPodService
         }
     }
 
+    // Runs when the RunnerPool is deleted. PVCs marked deleteWithAgent are removed, the others are released
+    // from the pool's owner reference so the garbage collector keeps them once the RunnerPool is gone
+    public async Task<int> CleanupPoolPvcsAsync(V1AzDORunnerEntity runnerPool)
+    {
+        var namespaceName = runnerPool.Metadata.NamespaceProperty ?? "default";
+        var deleted = 0;
+
+        var pvcs = await _kubernetesClient.CoreV1.ListNamespacedPersistentVolumeClaimAsync(
+            namespaceName, labelSelector: $"runner-pool={runnerPool.Metadata.Name}");
+
+        foreach (var pvc in pvcs.Items)
+        {
+            var pvcName = pvc.Metadata.Name;
+            var pvcSpec = pvc.Metadata.Labels?.TryGetValue("pvc-name", out var specName) == true
+                ? runnerPool.Spec.Pvcs.FirstOrDefault(p => p.Name == specName)
+                : null;
+
+            if (pvcSpec?.DeleteWithAgent == true)
+            {
+                await DeletePvcAsync(pvcName, namespaceName);
+                deleted++;
+                continue;
+            }
+
+            if (pvc.Metadata.OwnerReferences?.Any(o => o.Uid == runnerPool.Metadata.Uid) != true)
+            {
+                continue;
+            }
+
+            try
+            {
+                var currentPvc = await _kubernetesClient.CoreV1.ReadNamespacedPersistentVolumeClaimAsync(pvcName, namespaceName);
+                currentPvc.Metadata.OwnerReferences = currentPvc.Metadata.OwnerReferences?
+                    .Where(o => o.Uid != runnerPool.Metadata.Uid)
+                    .ToList();
+                await _kubernetesClient.CoreV1.ReplaceNamespacedPersistentVolumeClaimAsync(currentPvc, pvcName, namespaceName);
+                _logger.LogInformation("Retained PVC {PvcName} of RunnerPool {RunnerPool}", pvcName, runnerPool.Metadata.Name);
+            }
+            catch (Exception ex)
+            {
+                _logger.LogWarning(ex, "Failed to release PVC {PvcName} from RunnerPool {RunnerPool}, it may be garbage collected",
+                    pvcName, runnerPool.Metadata.Name);
+            }
+        }
+
+        return deleted;
+    }
+
     public int GetNextAvailableAgentIndex(V1AzDORunnerEntity runnerPool)
     {
         var namespaceName = runnerPool.Metadata.NamespaceProperty ?? "default";
@@ -630,11 +861,12 @@ public class KubernetesPodService
                 pod.Metadata.Labels["runner-pool"] == runnerPool.Metadata.Name).ToList();
 
             var usedIndexes = new HashSet<int>();
+            var agentNamePrefix = GetAgentNamePrefix(runnerPool);
             foreach (var pod in runnerPods)
             {
-                if (pod.Metadata.Name.StartsWith($"{runnerPool.Metadata.Name}-agent-"))
+                if (pod.Metadata.Name.StartsWith(agentNamePrefix))
                 {
-                    var indexStr = pod.Metadata.Name.Substring($"{runnerPool.Metadata.Name}-agent-".Length);
+                    var indexStr = pod.Metadata.Name.Substring(agentNamePrefix.Length);
                     if (int.TryParse(indexStr, out var index))
                     {
                         usedIndexes.Add(index);
@@ -661,6 +893,18 @@ public class KubernetesPodService
         }
     }
 
+    public static bool IsRunningOutdatedImage(V1AzDORunnerEntity runnerPool, V1Pod pod)
+    {
+        var capability = pod.Metadata.Labels?.TryGetValue("capability", out var label) == true ? label : null;
+        var expectedImage = runnerPool.Spec.CapabilityAware && capability != null &&
+                            runnerPool.Spec.CapabilityImages.TryGetValue(capability, out var capabilityImage)
+            ? capabilityImage
+            : runnerPool.Spec.Image;
+
+        var agentImage = pod.Spec?.Containers?.FirstOrDefault(c => c.Name == "agent")?.Image;
+        return agentImage != null && agentImage != expectedImage;
+    }
+
     private string DetermineImageForCapability(V1AzDORunnerEntity runnerPool, string? requiredCapability)
     {
         if (!runnerPool.Spec.CapabilityAware)
@@ -685,6 +929,13 @@ public class KubernetesPodService
         return runnerPool.Spec.Image;
     }
 
+    private static string GetCertTrustStoreVolumeName(int certIndex)
+    {
+        // Secret names can be up to 253 characters and contain dots, neither of which is allowed
+        // in a volume name, so trust store volumes are named by position instead
+        return $"cert-trust-store-{certIndex}";
+    }
+
     private string GenerateInitContainerScript(V1AzDORunnerEntity runnerPool, int agentIndex)
     {
         if (runnerPool.Spec.InitContainer == null)
@@ -0,0 +1,79 @@
+using k8s;
+using k8s.LeaderElection;
+using k8s.LeaderElection.ResourceLock;
+
+namespace AzDORunner.Services;
+
+public class LeaderElectionService : BackgroundService
+{
+    #region Fields
+
+    private const string LeaseName = "azdo-runner-operator-polling";
+
+    private readonly ILogger<LeaderElectionService> _logger;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly bool _enabled;
+    private volatile bool _isLeader;
+
+    #endregion
+
+    #region Constructor
+
+    public LeaderElectionService(ILogger<LeaderElectionService> logger, IKubernetes kubernetesClient)
+    {
+        _logger = logger;
+        _kubernetesClient = kubernetesClient;
+        _enabled = string.Equals(Environment.GetEnvironmentVariable("LEADER_ELECTION"), "true", StringComparison.OrdinalIgnoreCase);
+
+        // Without leader election there is only one replica, and it is always in charge
+        _isLeader = !_enabled;
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    // Only the leader polls Azure DevOps and creates or deletes agent pods
+    public bool IsLeader => _isLeader;
+
+    public event Action? StartedLeading;
+
+    protected override async Task ExecuteAsync(CancellationToken stoppingToken)
+    {
+        if (!_enabled)
+        {
+            _logger.LogInformation("Leader election disabled - this replica polls all pools");
+            return;
+        }
+
+        var namespaceName = Environment.GetEnvironmentVariable("POD_NAMESPACE") ?? "default";
+        var identity = Environment.MachineName;
+
+        var leaderElector = new LeaderElector(new LeaderElectionConfig(
+            new LeaseLock(_kubernetesClient, namespaceName, LeaseName, identity))
+        {
+            LeaseDuration = TimeSpan.FromSeconds(15),
+            RenewDeadline = TimeSpan.FromSeconds(10),
+            RetryPeriod = TimeSpan.FromSeconds(2)
+        });
+
+        leaderElector.OnStartedLeading += () =>
+        {
+            _isLeader = true;
+            _logger.LogInformation("Acquired lease {LeaseName} as {Identity} - starting to poll pools", LeaseName, identity);
+            StartedLeading?.Invoke();
+        };
+        leaderElector.OnStoppedLeading += () =>
+        {
+            _isLeader = false;
+            _logger.LogWarning("Lost lease {LeaseName} - no longer polling pools", LeaseName);
+        };
+        leaderElector.OnNewLeader += leader =>
+            _logger.LogInformation("Pool polling leader is now {Leader}", leader);
+
+        _logger.LogInformation("Leader election enabled - waiting for lease {LeaseName} in namespace {Namespace}", LeaseName, namespaceName);
+        await leaderElector.RunAndTryToHoldLeadershipForeverAsync(stoppingToken);
+    }
+
+    #endregion
+}
@@ -0,0 +1,93 @@
+using System.Collections.Concurrent;
+using System.Globalization;
+using System.Text;
+
+namespace AzDORunner.Services;
+
+public class OperatorMetrics
+{
+    #region Fields
+
+    private readonly ConcurrentDictionary<(string Namespace, string Pool), int> _onlineAgents = new();
+    private readonly ConcurrentDictionary<(string Namespace, string Pool), int> _queuedJobs = new();
+    private readonly ConcurrentDictionary<(string Namespace, string Pool), int> _activePods = new();
+    private readonly ConcurrentDictionary<(string Namespace, string Pool), long> _podsCreated = new();
+    private readonly ConcurrentDictionary<(string Namespace, string Pool), long> _podsDeleted = new();
+
+    #endregion
+
+    #region Public Methods
+
+    public void SetPoolGauges(string namespaceName, string poolName, int onlineAgents, int queuedJobs, int activePods)
+    {
+        var key = (namespaceName, poolName);
+        _onlineAgents[key] = onlineAgents;
+        _queuedJobs[key] = queuedJobs;
+        _activePods[key] = activePods;
+    }
+
+    public void IncrementPodsCreated(string namespaceName, string poolName)
+    {
+        _podsCreated.AddOrUpdate((namespaceName, poolName), 1, (_, count) => count + 1);
+    }
+
+    public void IncrementPodsDeleted(string namespaceName, string poolName)
+    {
+        _podsDeleted.AddOrUpdate((namespaceName, poolName), 1, (_, count) => count + 1);
+    }
+
+    // Pods created plus pods deleted, a change between two reads means the pool was scaled
+    public long GetPodChurn(string namespaceName, string poolName)
+    {
+        var key = (namespaceName, poolName);
+        return _podsCreated.GetValueOrDefault(key) + _podsDeleted.GetValueOrDefault(key);
+    }
+
+    public void RemovePool(string namespaceName, string poolName)
+    {
+        // Counters are kept so rate() over a deleted pool doesn't see a reset
+        var key = (namespaceName, poolName);
+        _onlineAgents.TryRemove(key, out _);
+        _queuedJobs.TryRemove(key, out _);
+        _activePods.TryRemove(key, out _);
+    }
+
+    public string Render()
+    {
+        var builder = new StringBuilder();
+        AppendMetric(builder, "azdo_runner_online_agents", "gauge", "Online operator-managed agents in the Azure DevOps pool", _onlineAgents);
+        AppendMetric(builder, "azdo_runner_queued_jobs", "gauge", "Job requests waiting for an agent", _queuedJobs);
+        AppendMetric(builder, "azdo_runner_active_pods", "gauge", "Running or pending agent pods", _activePods);
+        AppendMetric(builder, "azdo_runner_pods_created_total", "counter", "Agent pods created by the operator", _podsCreated);
+        AppendMetric(builder, "azdo_runner_pods_deleted_total", "counter", "Agent pods deleted by the operator", _podsDeleted);
+        return builder.ToString();
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private static void AppendMetric<T>(StringBuilder builder, string name, string type, string help,
+        ConcurrentDictionary<(string Namespace, string Pool), T> values) where T : IFormattable
+    {
+        builder.Append("# HELP ").Append(name).Append(' ').Append(help).Append('\n');
+        builder.Append("# TYPE ").Append(name).Append(' ').Append(type).Append('\n');
+
+        foreach (var (key, value) in values.OrderBy(kv => kv.Key.Namespace).ThenBy(kv => kv.Key.Pool))
+        {
+            builder.Append(name)
+                .Append("{namespace=\"").Append(EscapeLabelValue(key.Namespace))
+                .Append("\",pool=\"").Append(EscapeLabelValue(key.Pool))
+                .Append("\"} ")
+                .Append(value.ToString(null, CultureInfo.InvariantCulture))
+                .Append('\n');
+        }
+    }
+
+    private static string EscapeLabelValue(string value)
+    {
+        return value.Replace("\\", "\\\\").Replace("\"", "\\\"").Replace("\n", "\\n");
+    }
+
+    #endregion
+}
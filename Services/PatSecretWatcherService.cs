@@ -0,0 +1,112 @@
+using k8s;
+using k8s.Models;
+
+namespace AzDORunner.Services;
+
+public class PatSecretWatcherService : BackgroundService
+{
+    #region Fields
+
+    private readonly ILogger<PatSecretWatcherService> _logger;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly ErrorPodCleanupService _errorPodCleanupService;
+
+    #endregion
+
+    #region Constructor
+
+    public PatSecretWatcherService(
+        ILogger<PatSecretWatcherService> logger,
+        IKubernetes kubernetesClient,
+        AzureDevOpsPollingService pollingService,
+        ErrorPodCleanupService errorPodCleanupService)
+    {
+        _logger = logger;
+        _kubernetesClient = kubernetesClient;
+        _pollingService = pollingService;
+        _errorPodCleanupService = errorPodCleanupService;
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    protected override async Task ExecuteAsync(CancellationToken stoppingToken)
+    {
+        _logger.LogInformation("PAT Secret Watcher started - token rotations are applied to registered pools immediately");
+
+        while (!stoppingToken.IsCancellationRequested)
+        {
+            try
+            {
+                // PAT secrets are created with kubectl create secret generic, skip service account tokens, TLS etc.
+                var response = _kubernetesClient.CoreV1.ListSecretForAllNamespacesWithHttpMessagesAsync(
+                    fieldSelector: "type=Opaque",
+                    watch: true,
+                    cancellationToken: stoppingToken);
+
+                await foreach (var (eventType, secret) in response.WatchAsync<V1Secret, V1SecretList>(cancellationToken: stoppingToken))
+                {
+                    if (eventType == WatchEventType.Added || eventType == WatchEventType.Modified)
+                    {
+                        ApplySecret(secret);
+                    }
+                }
+            }
+            catch (OperationCanceledException) when (stoppingToken.IsCancellationRequested)
+            {
+                break;
+            }
+            catch (Exception ex)
+            {
+                _logger.LogWarning(ex, "PAT secret watch failed, restarting");
+                await Task.Delay(TimeSpan.FromSeconds(5), stoppingToken);
+            }
+        }
+
+        _logger.LogInformation("PAT Secret Watcher stopped");
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    internal void ApplySecret(V1Secret secret)
+    {
+        var namespaceName = secret.Metadata.NamespaceProperty ?? "default";
+
+        // Only secrets referenced by a registered RunnerPool matter, everything else is ignored without API calls
+        var pools = _pollingService.GetPoolsUsingSecret(namespaceName, secret.Metadata.Name);
+        if (pools.Count == 0)
+        {
+            return;
+        }
+
+        if (secret.Data?.TryGetValue("token", out var tokenBytes) != true)
+        {
+            _logger.LogWarning("Secret {SecretName} in namespace {Namespace} no longer contains 'token' key, keeping the previous PAT",
+                secret.Metadata.Name, namespaceName);
+            return;
+        }
+
+        var pat = System.Text.Encoding.UTF8.GetString(tokenBytes);
+        foreach (var (entity, currentPat) in pools)
+        {
+            if (currentPat == pat)
+            {
+                continue;
+            }
+
+            _logger.LogInformation("PAT in secret {SecretName} changed, re-registering RunnerPool {Name}",
+                secret.Metadata.Name, entity.Metadata.Name);
+            _pollingService.RegisterPool(entity, pat);
+            _errorPodCleanupService.RegisterPool(entity, pat);
+
+            // Pick up the new token now instead of at the pool's next interval
+            _pollingService.RequestPoll(namespaceName, entity.Metadata.Name);
+        }
+    }
+
+    #endregion
+}
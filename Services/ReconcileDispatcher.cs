@@ -0,0 +1,166 @@
+using AzDORunner.Entities;
+
+namespace AzDORunner.Services;
+
+// Bounds how many RunnerPools reconcile at the same time. Watch events and requeues can reach the
+// controller concurrently, a slow Azure DevOps call for one pool then only holds up that pool.
+// Two reconciles of the same pool never overlap, and a deleted pool's reconcile is canceled so it
+// can't register the pool again after the finalizer removed it.
+public class ReconcileDispatcher
+{
+    #region Fields
+
+    private readonly ILogger<ReconcileDispatcher> _logger;
+    private readonly CancellationToken _stoppingToken;
+    private readonly SemaphoreSlim _slots;
+    private readonly Dictionary<string, PoolReconcile> _pools = new();
+    private readonly object _lock = new();
+
+    #endregion
+
+    #region Constructor
+
+    public ReconcileDispatcher(ILogger<ReconcileDispatcher> logger, IHostApplicationLifetime lifetime)
+        : this(logger, lifetime,
+            int.TryParse(Environment.GetEnvironmentVariable("MAX_CONCURRENT_RECONCILES"), out var max) && max > 0
+                ? max
+                : 1)
+    {
+    }
+
+    internal ReconcileDispatcher(ILogger<ReconcileDispatcher> logger, IHostApplicationLifetime lifetime, int maxConcurrentReconciles)
+    {
+        _logger = logger;
+        _stoppingToken = lifetime.ApplicationStopping;
+        MaxConcurrentReconciles = maxConcurrentReconciles;
+        _slots = new SemaphoreSlim(MaxConcurrentReconciles);
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    public int MaxConcurrentReconciles { get; }
+
+    // Runs the reconcile once a slot is free and returns its result, so a failed reconcile is requeued as usual
+    public async Task DispatchAsync(V1AzDORunnerEntity entity, Func<CancellationToken, Task> reconcile, CancellationToken cancellationToken)
+    {
+        var poolKey = GetPoolKey(entity);
+        PoolReconcile pool;
+        lock (_lock)
+        {
+            if (!_pools.TryGetValue(poolKey, out var existing))
+            {
+                existing = new PoolReconcile();
+                _pools[poolKey] = existing;
+            }
+
+            pool = existing;
+            pool.Users++;
+        }
+
+        try
+        {
+            using var token = CancellationTokenSource.CreateLinkedTokenSource(cancellationToken, _stoppingToken, pool.Forgotten.Token);
+
+            await pool.Gate.WaitAsync(token.Token);
+            try
+            {
+                await _slots.WaitAsync(token.Token);
+                try
+                {
+                    TaskCompletionSource running;
+                    lock (_lock)
+                    {
+                        // ForgetAsync waits for whatever is running when it is called, don't start after that
+                        if (pool.IsForgotten)
+                        {
+                            throw new OperationCanceledException(token.Token);
+                        }
+
+                        running = new TaskCompletionSource(TaskCreationOptions.RunContinuationsAsynchronously);
+                        pool.Running = running.Task;
+                    }
+
+                    try
+                    {
+                        await reconcile(token.Token);
+                    }
+                    finally
+                    {
+                        running.SetResult();
+                    }
+                }
+                finally
+                {
+                    _slots.Release();
+                }
+            }
+            finally
+            {
+                pool.Gate.Release();
+            }
+        }
+        catch (OperationCanceledException) when (pool.IsForgotten)
+        {
+            _logger.LogDebug("Reconcile of {PoolKey} canceled, the RunnerPool is being deleted", poolKey);
+        }
+        finally
+        {
+            lock (_lock)
+            {
+                if (--pool.Users == 0 && _pools.TryGetValue(poolKey, out var current) && current == pool)
+                {
+                    _pools.Remove(poolKey);
+                }
+            }
+        }
+    }
+
+    // Cancels the pool's reconciles and waits for a running one, after this nothing registers the pool again
+    public async Task ForgetAsync(V1AzDORunnerEntity entity)
+    {
+        var poolKey = GetPoolKey(entity);
+        PoolReconcile? pool;
+        Task running;
+        lock (_lock)
+        {
+            if (!_pools.Remove(poolKey, out pool))
+            {
+                return;
+            }
+
+            pool.IsForgotten = true;
+            running = pool.Running;
+        }
+
+        // Outside the lock, canceling runs the continuations of waiting reconciles
+        pool.Forgotten.Cancel();
+        _logger.LogInformation("Waiting for the running reconcile of {PoolKey} to stop", poolKey);
+        await running;
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private static string GetPoolKey(V1AzDORunnerEntity entity)
+    {
+        return $"{entity.Metadata.NamespaceProperty ?? "default"}/{entity.Metadata.Name}";
+    }
+
+    private class PoolReconcile
+    {
+        public SemaphoreSlim Gate { get; } = new(1, 1);
+
+        public CancellationTokenSource Forgotten { get; } = new();
+
+        public Task Running { get; set; } = Task.CompletedTask;
+
+        public bool IsForgotten { get; set; }
+
+        public int Users { get; set; }
+    }
+
+    #endregion
+}
@@ -0,0 +1,97 @@
+using AzDORunner.Entities;
+using k8s;
+
+namespace AzDORunner.Services;
+
+public class RunnerPoolPauseWatcherService : BackgroundService
+{
+    #region Fields
+
+    private const string Group = "devops.opentools.mf";
+    private const string Version = "v1";
+    private const string Plural = "runnerpools";
+
+    private readonly ILogger<RunnerPoolPauseWatcherService> _logger;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly AzureDevOpsPollingService _pollingService;
+
+    #endregion
+
+    #region Constructor
+
+    public RunnerPoolPauseWatcherService(
+        ILogger<RunnerPoolPauseWatcherService> logger,
+        IKubernetes kubernetesClient,
+        AzureDevOpsPollingService pollingService)
+    {
+        _logger = logger;
+        _kubernetesClient = kubernetesClient;
+        _pollingService = pollingService;
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    protected override async Task ExecuteAsync(CancellationToken stoppingToken)
+    {
+        _logger.LogInformation("RunnerPool Pause Watcher started - pausing or resuming a pool triggers an immediate poll");
+
+        while (!stoppingToken.IsCancellationRequested)
+        {
+            try
+            {
+                // Annotation changes don't bump the generation, so the controller never reconciles them
+                var response = _kubernetesClient.CustomObjects.ListClusterCustomObjectWithHttpMessagesAsync(
+                    group: Group,
+                    version: Version,
+                    plural: Plural,
+                    watch: true,
+                    cancellationToken: stoppingToken);
+
+                await foreach (var (eventType, entity) in response.WatchAsync<V1AzDORunnerEntity, object>(cancellationToken: stoppingToken))
+                {
+                    if (eventType == WatchEventType.Modified)
+                    {
+                        ApplyRunnerPool(entity);
+                    }
+                }
+            }
+            catch (OperationCanceledException) when (stoppingToken.IsCancellationRequested)
+            {
+                break;
+            }
+            catch (Exception ex)
+            {
+                _logger.LogWarning(ex, "RunnerPool watch failed, restarting");
+                await Task.Delay(TimeSpan.FromSeconds(5), stoppingToken);
+            }
+        }
+
+        _logger.LogInformation("RunnerPool Pause Watcher stopped");
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    internal void ApplyRunnerPool(V1AzDORunnerEntity entity)
+    {
+        if (!_pollingService.IsRegistered(entity))
+        {
+            return;
+        }
+
+        // The poll reads the annotation itself, it only needs to happen now instead of at the pool's next interval
+        var paused = AzureDevOpsPollingService.HasPausedAnnotation(entity);
+        if (paused == _pollingService.IsPaused(entity))
+        {
+            return;
+        }
+
+        _logger.LogInformation("RunnerPool {Name} was {Action}, requesting poll", entity.Metadata.Name, paused ? "paused" : "resumed");
+        _pollingService.RequestPoll(entity.Metadata.NamespaceProperty ?? "default", entity.Metadata.Name);
+    }
+
+    #endregion
+}
@@ -0,0 +1,277 @@
+using AzDORunner.Entities;
+using AzDORunner.Model.Domain;
+using k8s;
+using KubeOps.Abstractions.Events;
+
+namespace AzDORunner.Services;
+
+// The work behind RunnerPoolController.ReconcileAsync, resolved per reconcile like the controller itself
+public class RunnerPoolReconciler
+{
+    #region Fields
+
+    private readonly ILogger<RunnerPoolReconciler> _logger;
+    private readonly IAzureDevOpsService _azureDevOpsService;
+    private readonly KubernetesPodService _kubernetesPodService;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly AzureDevOpsPollingService _pollingService;
+    private readonly ErrorPodCleanupService _errorPodCleanupService;
+    private readonly IRunnerPoolStatusService _statusService;
+    private readonly EventPublisher _eventPublisher;
+
+    #endregion
+
+    #region Constructor
+
+    public RunnerPoolReconciler(
+        ILogger<RunnerPoolReconciler> logger,
+        IAzureDevOpsService azureDevOpsService,
+        KubernetesPodService kubernetesPodService,
+        IKubernetes kubernetesClient,
+        AzureDevOpsPollingService pollingService,
+        ErrorPodCleanupService errorPodCleanupService,
+        IRunnerPoolStatusService statusService,
+        EventPublisher eventPublisher)
+    {
+        _logger = logger;
+        _azureDevOpsService = azureDevOpsService;
+        _kubernetesPodService = kubernetesPodService;
+        _kubernetesClient = kubernetesClient;
+        _pollingService = pollingService;
+        _errorPodCleanupService = errorPodCleanupService;
+        _statusService = statusService;
+        _eventPublisher = eventPublisher;
+    }
+
+    #endregion
+
+    #region Public Methods
+
+    public async Task ReconcileAsync(V1AzDORunnerEntity entity, CancellationToken cancellationToken)
+    {
+        try
+        {
+            var pat = await GetPatFromSecretAsync(entity);
+            if (string.IsNullOrEmpty(pat))
+            {
+                UpdateStatus(entity, "Error", "Failed to get PAT from secret");
+                await PublishEventAsync(entity, "PATError",
+                    $"Could not read a PAT from key 'token' of secret {entity.Spec.PatSecretName}", EventType.Warning);
+                return;
+            }
+
+            var connection = await _azureDevOpsService.CheckConnectionAsync(entity.Spec.AzDoUrl, pat);
+            if (connection != ConnectionCheckResult.Connected)
+            {
+                UpdateStatus(entity, connection == ConnectionCheckResult.Error ? "Disconnected" : connection.ToString(),
+                    GetConnectionErrorMessage(connection));
+                await PublishEventAsync(entity, "ConnectionFailed", GetConnectionErrorMessage(connection), EventType.Warning);
+                return;
+            }
+
+            UpdateStatus(entity, "Connected", null);
+
+            // The first reconcile after a restart picks up the pods the previous instance created,
+            // scaling counts them from the cluster instead of starting from zero
+            var ownedPods = await _kubernetesPodService.CountOwnedPodsAsync(entity);
+            if (ownedPods > 0 && !_pollingService.IsRegistered(entity))
+            {
+                await PublishEventAsync(entity, "PodsAdopted", $"Adopted {ownedPods} existing agent pods");
+            }
+
+            // Update agent index tracking
+            await UpdateAgentIndexTracking(entity);
+
+            // A reconcile that outlived its RunnerPool must not bring the pool back into polling
+            cancellationToken.ThrowIfCancellationRequested();
+
+            // Register with the polling service for continuous monitoring
+            _pollingService.RegisterPool(entity, pat);
+
+            // Register with the error pod cleanup service for immediate error pod removal
+            _errorPodCleanupService.RegisterPool(entity, pat);
+
+            _logger.LogInformation("Registered RunnerPool {Name} with Azure DevOps polling and error cleanup services", entity.Metadata.Name);
+        }
+        catch (Exception ex) when (ex is not OperationCanceledException)
+        {
+            // Rethrow so the controller requeues the RunnerPool
+            _logger.LogError(ex, "Error reconciling RunnerPool {Name}", entity.Metadata.Name);
+            UpdateStatus(entity, "Error", ex.Message);
+            throw;
+        }
+    }
+
+    #endregion
+
+    #region Private Methods
+
+    private async Task UpdateAgentIndexTracking(V1AzDORunnerEntity entity)
+    {
+        try
+        {
+            var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+            var allPods = await _kubernetesPodService.GetAllRunnerPodsAsync(entity);
+            var allPvcs = _kubernetesClient.CoreV1.ListNamespacedPersistentVolumeClaim(namespaceName).Items
+                .Where(pvc => pvc.Metadata.Labels?.ContainsKey("runner-pool") == true &&
+                             pvc.Metadata.Labels["runner-pool"] == entity.Metadata.Name)
+                .ToList();
+
+            // Get the latest version of the entity from Kubernetes
+            var freshEntity = await _statusService.GetRunnerPoolAsync(entity.Metadata.Name, namespaceName);
+            if (freshEntity?.Status == null)
+            {
+                _logger.LogWarning("Cannot update agent index tracking - freshEntity or Status is null");
+                return;
+            }
+
+            if (freshEntity.Status.AgentIndexes == null)
+            {
+                freshEntity.Status.AgentIndexes = new Dictionary<int, V1AzDORunnerEntity.AgentIndexInfo>();
+            }
+
+            // Clear existing index tracking and rebuild from current state
+            freshEntity.Status.AgentIndexes.Clear();
+
+            foreach (var pod in allPods)
+            {
+                var podName = pod.Metadata.Name;
+                var expectedPrefix = KubernetesPodService.GetAgentNamePrefix(entity);
+
+                if (podName.StartsWith(expectedPrefix))
+                {
+                    var indexStr = podName.Substring(expectedPrefix.Length);
+                    if (int.TryParse(indexStr, out var index))
+                    {
+                        var isMinAgent = pod.Metadata.Labels?.ContainsKey("min-agent") == true &&
+                                        pod.Metadata.Labels["min-agent"] == "true";
+
+                        var associatedPvcs = allPvcs
+                            .Where(pvc => pvc.Metadata.Labels?.ContainsKey("agent-index") == true &&
+                                         pvc.Metadata.Labels["agent-index"] == index.ToString())
+                            .Select(pvc => pvc.Metadata.Name)
+                            .ToList();
+
+                        freshEntity.Status.AgentIndexes[index] = new V1AzDORunnerEntity.AgentIndexInfo
+                        {
+                            PodName = podName,
+                            Status = pod.Status?.Phase ?? "Unknown",
+                            IsMinAgent = isMinAgent,
+                            CreatedAt = pod.Metadata.CreationTimestamp?.ToUniversalTime() ?? DateTime.UtcNow,
+                            PvcNames = associatedPvcs
+                        };
+                    }
+                }
+            }
+
+            // Update the current agent index to be the next available index
+            try
+            {
+                freshEntity.Status.CurrentAgentIndex = _kubernetesPodService.GetNextAvailableAgentIndex(entity);
+            }
+            catch (InvalidOperationException)
+            {
+                // Max agents reached, keep current index
+            }
+
+            // Update the status using our status service
+            await _statusService.UpdateStatusAsync(freshEntity);
+            _logger.LogDebug("Updated agent index tracking for RunnerPool {Name}. Tracked indexes: {Indexes}",
+                entity.Metadata.Name, string.Join(", ", freshEntity.Status.AgentIndexes.Keys));
+        }
+        catch (Exception ex)
+        {
+            _logger.LogWarning(ex, "Failed to update agent index tracking for RunnerPool {Name}", entity.Metadata.Name);
+        }
+    }
+
+    private async void UpdateStatus(V1AzDORunnerEntity entity, string status, string? error)
+    {
+        try
+        {
+            // Get the latest version of the entity from Kubernetes
+            var freshEntity = await _statusService.GetRunnerPoolAsync(entity.Metadata.Name, entity.Metadata.NamespaceProperty ?? "default");
+            if (freshEntity != null)
+            {
+                freshEntity.Status.ConnectionStatus = status;
+                freshEntity.Status.LastError = error;
+                freshEntity.Status.LastPolled = DateTime.UtcNow;
+                freshEntity.Status.OrganizationName = _azureDevOpsService.ExtractOrganizationName(freshEntity.Spec.AzDoUrl);
+
+                if (status == "Connected")
+                {
+                    freshEntity.Status.SetCondition("Ready", "True", "Connected", "Connected to Azure DevOps");
+                }
+                else
+                {
+                    freshEntity.Status.SetCondition("Ready", "False", status, error ?? status);
+                }
+
+                if (!string.IsNullOrEmpty(error))
+                {
+                    freshEntity.Status.SetCondition("Degraded", "True", status, error);
+                }
+                else
+                {
+                    freshEntity.Status.SetCondition("Degraded", "False", "AsExpected", string.Empty);
+                }
+
+                // Update the status using our status service
+                await _statusService.UpdateStatusAsync(freshEntity);
+                _logger.LogDebug("Updated status for RunnerPool {Name}: {Status}",
+                                entity.Metadata.Name, status);
+            }
+        }
+        catch (Exception ex)
+        {
+            _logger.LogWarning(ex, "Failed to update status for RunnerPool {Name}", entity.Metadata.Name);
+        }
+    }
+
+    private async Task PublishEventAsync(V1AzDORunnerEntity entity, string reason, string message, EventType type = EventType.Normal)
+    {
+        try
+        {
+            await _eventPublisher(entity, reason, message, type);
+        }
+        catch (Exception ex)
+        {
+            _logger.LogDebug(ex, "Failed to publish {Reason} event for RunnerPool {Name}", reason, entity.Metadata.Name);
+        }
+    }
+
+    private static string GetConnectionErrorMessage(ConnectionCheckResult connection)
+    {
+        return connection switch
+        {
+            ConnectionCheckResult.Unauthorized => "Azure DevOps rejected the PAT, check the token and that it has the Agent Pools (Read & manage) scope",
+            ConnectionCheckResult.NotFound => "Azure DevOps organization not found, check AzDoUrl",
+            ConnectionCheckResult.Unreachable => "Azure DevOps is unreachable, check network and DNS access from the operator",
+            _ => "Failed to connect to Azure DevOps"
+        };
+    }
+
+    private Task<string?> GetPatFromSecretAsync(V1AzDORunnerEntity entity)
+    {
+        try
+        {
+            var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+            var secret = _kubernetesClient.CoreV1.ReadNamespacedSecret(entity.Spec.PatSecretName, namespaceName);
+
+            if (secret?.Data?.TryGetValue("token", out var tokenBytes) == true)
+            {
+                return Task.FromResult<string?>(System.Text.Encoding.UTF8.GetString(tokenBytes));
+            }
+
+            _logger.LogError("Secret {SecretName} does not contain 'token' key", entity.Spec.PatSecretName);
+            return Task.FromResult<string?>(null);
+        }
+        catch (Exception ex)
+        {
+            _logger.LogError(ex, "Failed to get PAT from secret {SecretName}", entity.Spec.PatSecretName);
+            return Task.FromResult<string?>(null);
+        }
+    }
+
+    #endregion
+}
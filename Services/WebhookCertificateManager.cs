@@ -201,7 +201,7 @@ namespace AzDORunner.Services
                         {
                             new V1RuleWithOperations
                             {
-                                Operations = new List<string>{"CREATE", "UPDATE"},
+                                Operations = new List<string>{"CREATE", "UPDATE", "DELETE"},
                                 ApiGroups = new List<string>{"devops.opentools.mf"},
                                 ApiVersions = new List<string>{"v1"},
                                 Resources = new List<string>{"runnerpools"}
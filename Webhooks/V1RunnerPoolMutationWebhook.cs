@@ -35,21 +35,66 @@ public class V1RunnerPoolMutationWebhook : MutationWebhook<V1AzDORunnerEntity>
             modified = true;
         }
 
-        if (entity.Spec.TtlIdleSeconds == 0)
+        // Keep in line with the entity defaults so the webhook and the CRD agree.
+        // Only an unset TtlIdleSeconds is defaulted, an explicit 0 asks for one-time agents
+        if (entity.Spec.TtlIdleSeconds == null)
         {
-            entity.Spec.TtlIdleSeconds = 300; // 5 minutes
+            entity.Spec.TtlIdleSeconds = V1AzDORunnerEntity.V1AzDORunnerEntitySpec.DefaultTtlIdleSeconds;
             modified = true;
         }
 
-        if (entity.Spec.MinAgents == 0 && entity.Spec.MaxAgents == 0)
+        if (entity.Spec.MaxAgents == 0)
         {
-            entity.Spec.MinAgents = 0;
-            entity.Spec.MaxAgents = 5;
+            entity.Spec.MaxAgents = Math.Max(V1AzDORunnerEntity.V1AzDORunnerEntitySpec.DefaultMaxAgents, entity.Spec.MinAgents);
             modified = true;
         }
-        else if (entity.Spec.MaxAgents == 0)
+
+        // An explicit 0 means "not set", the validation webhook rejects anything else below 5
+        if (entity.Spec.PollIntervalSeconds == 0)
+        {
+            entity.Spec.PollIntervalSeconds = 30;
+            modified = true;
+        }
+
+        if (string.IsNullOrWhiteSpace(entity.Spec.PoolType))
+        {
+            entity.Spec.PoolType = "automation";
+            modified = true;
+        }
+
+        if (string.IsNullOrWhiteSpace(entity.Spec.Mode))
+        {
+            entity.Spec.Mode = "Active";
+            modified = true;
+        }
+
+        if (string.IsNullOrWhiteSpace(entity.Spec.UpdateStrategy))
+        {
+            entity.Spec.UpdateStrategy = "OnDelete";
+            modified = true;
+        }
+
+        if (entity.Spec.MaxSurge == 0)
+        {
+            entity.Spec.MaxSurge = 3;
+            modified = true;
+        }
+
+        if (entity.Spec.JobsPerAgent == 0)
+        {
+            entity.Spec.JobsPerAgent = 1;
+            modified = true;
+        }
+
+        if (entity.Spec.CapabilityScaling == null)
         {
-            entity.Spec.MaxAgents = Math.Max(1, entity.Spec.MinAgents);
+            entity.Spec.CapabilityScaling = new Dictionary<string, V1AzDORunnerEntity.CapabilityScalingSpec>();
+            modified = true;
+        }
+
+        if (entity.Spec.ImagePullSecrets == null)
+        {
+            entity.Spec.ImagePullSecrets = new List<string>();
             modified = true;
         }
 
@@ -65,6 +110,37 @@ public class V1RunnerPoolMutationWebhook : MutationWebhook<V1AzDORunnerEntity>
             modified = true;
         }
 
+        if (entity.Spec.CertTrustStore == null)
+        {
+            entity.Spec.CertTrustStore = new List<V1AzDORunnerEntity.CertTrustStore>();
+            modified = true;
+        }
+
+        if (entity.Spec.SecurityContext == null)
+        {
+            entity.Spec.SecurityContext = new V1AzDORunnerEntity.SecurityContextSpec();
+            modified = true;
+        }
+
+        // The agent refuses to run as root, 0 can only mean the field was left empty
+        if (entity.Spec.SecurityContext.RunAsUser == 0)
+        {
+            entity.Spec.SecurityContext.RunAsUser = 1001;
+            modified = true;
+        }
+
+        if (entity.Spec.SecurityContext.RunAsGroup == 0)
+        {
+            entity.Spec.SecurityContext.RunAsGroup = 1001;
+            modified = true;
+        }
+
+        if (entity.Spec.Resources == null)
+        {
+            entity.Spec.Resources = new V1AzDORunnerEntity.ResourcesSpec();
+            modified = true;
+        }
+
         foreach (var pvc in entity.Spec.Pvcs)
         {
             if (pvc.CreatePvc && string.IsNullOrWhiteSpace(pvc.Storage))
@@ -1,131 +1,397 @@
 using KubeOps.Operator.Web.Webhooks.Admission.Validation;
 using AzDORunner.Entities;
+using AzDORunner.Model.Domain;
+using AzDORunner.Services;
+using k8s;
+using k8s.Models;
 
 namespace AzDORunner.Webhooks;
 
 [ValidationWebhook(typeof(V1AzDORunnerEntity))]
 public class V1RunnerPoolValidationWebhook : ValidationWebhook<V1AzDORunnerEntity>
 {
-    public override ValidationResult Create(V1AzDORunnerEntity entity, bool dryRun)
+    private const string SelfHostedAnnotation = "azdo.opentools.mf/self-hosted";
+    private const string ProtectWhileBusyAnnotation = "azdo.opentools.mf/protect-while-busy";
+
+    // The apiserver waits 10s for the webhook by default, leave room for reading the secret
+    private static readonly TimeSpan PoolLookupTimeout = TimeSpan.FromSeconds(5);
+
+    private readonly HashSet<string> _allowedHosts;
+    private readonly IKubernetes _kubernetesClient;
+    private readonly IAzureDevOpsService _azureDevOpsService;
+
+    public V1RunnerPoolValidationWebhook(IKubernetes kubernetesClient, IAzureDevOpsService azureDevOpsService)
     {
-        if (string.IsNullOrWhiteSpace(entity.Spec.AzDoUrl))
-            return Fail("AzDoUrl is required and cannot be empty", 422);
+        _kubernetesClient = kubernetesClient;
+        _azureDevOpsService = azureDevOpsService;
 
-        if (string.IsNullOrWhiteSpace(entity.Spec.PatSecretName))
-            return Fail("PatSecretName is required and cannot be empty", 422);
+        // Extra hosts (e.g. Azure DevOps Server instances) trusted operator-wide, comma separated
+        _allowedHosts = (Environment.GetEnvironmentVariable("AZDO_ALLOWED_HOSTS") ?? string.Empty)
+            .Split(',', StringSplitOptions.RemoveEmptyEntries | StringSplitOptions.TrimEntries)
+            .ToHashSet(StringComparer.OrdinalIgnoreCase);
+    }
 
-        var result = ValidateBusinessLogic(entity);
-        if (result != null)
-            return result;
+    public override async Task<ValidationResult> CreateAsync(V1AzDORunnerEntity entity, bool dryRun, CancellationToken cancellationToken)
+    {
+        var errors = ValidateSpec(entity).ToList();
+        if (errors.Count > 0)
+            return Fail(string.Join("; ", errors), 422);
 
-        result = ValidateExtraEnv(entity.Spec.ExtraEnv);
-        if (result != null)
-            return result;
+        var warnings = GetCapacityWarnings(entity).ToList();
 
-        result = ValidatePvcs(entity.Spec.Pvcs);
-        if (result != null)
-            return result;
+        var (pat, secretError) = await ReadPatSecretAsync(entity);
+        if (secretError != null)
+            return Fail(secretError, 422);
 
-        result = ValidateCertTrustStore(entity.Spec.CertTrustStore);
-        if (result != null)
-            return result;
+        // Without RBAC on secrets the check can't run, which shouldn't block creating the pool
+        if (string.IsNullOrEmpty(pat))
+        {
+            warnings.Add($"Could not read secret {entity.Spec.PatSecretName}, the PAT and pool '{entity.Spec.Pool}' were not checked in Azure DevOps");
+            return Success(warnings.ToArray());
+        }
 
-        return Success();
+        // Only a pool list without the pool or a hosted pool rejects, Azure DevOps being slow or down doesn't
+        var lookup = await _azureDevOpsService.LookupPoolAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat, PoolLookupTimeout, cancellationToken);
+        if (lookup.Status == PoolLookupStatus.NotFound)
+            return Fail($"Pool '{entity.Spec.Pool}' was not found in Azure DevOps", 422);
+
+        if (lookup.Status == PoolLookupStatus.Found && lookup.Pool!.IsHosted)
+            return Fail($"Pool '{lookup.Pool.Name}' is a Microsoft-hosted pool. RunnerPools need a self-hosted agent pool", 422);
+
+        if (lookup.Status == PoolLookupStatus.Ambiguous)
+            warnings.Add($"Pool '{entity.Spec.Pool}' is ambiguous, {lookup.Error}. Use the exact name");
+        else if (lookup.Status == PoolLookupStatus.Unavailable)
+            warnings.Add($"Could not check pool '{entity.Spec.Pool}' in Azure DevOps ({lookup.Error}), it is checked again once the RunnerPool is reconciled");
+
+        return Success(warnings.ToArray());
     }
 
     public override ValidationResult Update(V1AzDORunnerEntity oldEntity, V1AzDORunnerEntity newEntity, bool dryRun)
     {
-        if (string.IsNullOrWhiteSpace(newEntity.Spec.AzDoUrl))
-            return Fail("AzDoUrl is required and cannot be empty");
+        var errors = ValidateImmutableFields(oldEntity, newEntity)
+            .Concat(ValidateSpec(newEntity))
+            .ToList();
+        if (errors.Count > 0)
+            return Fail(string.Join("; ", errors), 422);
 
-        if (string.IsNullOrWhiteSpace(newEntity.Spec.PatSecretName))
-            return Fail("PatSecretName is required and cannot be empty");
+        var warnings = GetCapacityWarnings(newEntity).ToList();
 
-        var result = ValidateBusinessLogic(newEntity);
-        if (result != null)
-            return result;
+        var runningAgents = oldEntity.Status?.RunningAgents ?? 0;
+        if (newEntity.Spec.MaxAgents < runningAgents)
+            warnings.Add($"MaxAgents lowered to {newEntity.Spec.MaxAgents} while {runningAgents} agents are running. Excess agents will be removed once they are idle");
+
+        return Success(warnings.ToArray());
+    }
 
-        result = ValidateExtraEnv(newEntity.Spec.ExtraEnv);
-        if (result != null)
-            return result;
+    public override async Task<ValidationResult> DeleteAsync(V1AzDORunnerEntity entity, bool dryRun, CancellationToken cancellationToken)
+    {
+        if (entity.Metadata.Annotations?.TryGetValue(ProtectWhileBusyAnnotation, out var protect) != true ||
+            !string.Equals(protect, "true", StringComparison.OrdinalIgnoreCase))
+            return Success();
 
-        result = ValidatePvcs(newEntity.Spec.Pvcs);
-        if (result != null)
-            return result;
+        var pat = await GetPatAsync(entity);
+        if (string.IsNullOrEmpty(pat))
+            // Don't block deleting a pool that's broken anyway
+            return Success($"Could not read the PAT to check for running jobs, deleting RunnerPool {entity.Metadata.Name} without the {ProtectWhileBusyAnnotation} check");
 
-        result = ValidateCertTrustStore(newEntity.Spec.CertTrustStore);
-        if (result != null)
-            return result;
+        int runningJobs;
+        try
+        {
+            runningJobs = await _azureDevOpsService.GetRunningJobsCountAsync(entity.Spec.AzDoUrl, entity.Spec.Pool, pat);
+        }
+        catch (AzureDevOpsRequestException ex)
+        {
+            return Success($"Could not list the jobs of pool '{entity.Spec.Pool}' ({ex.Message}), deleting RunnerPool {entity.Metadata.Name} without the {ProtectWhileBusyAnnotation} check");
+        }
+
+        if (runningJobs > 0)
+            return Fail($"RunnerPool {entity.Metadata.Name} has {runningJobs} running jobs in pool '{entity.Spec.Pool}'. Wait for them to finish or remove the {ProtectWhileBusyAnnotation} annotation", 409);
 
         return Success();
     }
 
-    private ValidationResult? ValidateBusinessLogic(V1AzDORunnerEntity entity)
+    private async Task<(string? Pat, string? Error)> ReadPatSecretAsync(V1AzDORunnerEntity entity)
+    {
+        var namespaceName = entity.Metadata.NamespaceProperty ?? "default";
+        try
+        {
+            var secret = await _kubernetesClient.CoreV1.ReadNamespacedSecretAsync(entity.Spec.PatSecretName, namespaceName);
+            if (secret?.Data?.TryGetValue("token", out var tokenBytes) != true || tokenBytes.Length == 0)
+                return (null, $"Secret {entity.Spec.PatSecretName} in namespace {namespaceName} has no 'token' key. Store the PAT under 'token', e.g. kubectl create secret generic {entity.Spec.PatSecretName} --from-literal=token=<PAT>");
+
+            return (System.Text.Encoding.UTF8.GetString(tokenBytes), null);
+        }
+        catch (k8s.Autorest.HttpOperationException ex) when (ex.Response.StatusCode == System.Net.HttpStatusCode.NotFound)
+        {
+            return (null, $"Secret {entity.Spec.PatSecretName} not found in namespace {namespaceName}. Create it with the PAT under the 'token' key before the RunnerPool");
+        }
+        catch
+        {
+            return (null, null);
+        }
+    }
+
+    private async Task<string?> GetPatAsync(V1AzDORunnerEntity entity)
+    {
+        try
+        {
+            var secret = await _kubernetesClient.CoreV1.ReadNamespacedSecretAsync(entity.Spec.PatSecretName, entity.Metadata.NamespaceProperty ?? "default");
+            return secret?.Data?.TryGetValue("token", out var tokenBytes) == true
+                ? System.Text.Encoding.UTF8.GetString(tokenBytes)
+                : null;
+        }
+        catch
+        {
+            return null;
+        }
+    }
+
+    private static IEnumerable<string> GetCapacityWarnings(V1AzDORunnerEntity entity)
+    {
+        if (!entity.Spec.CapabilityAware)
+            yield break;
+
+        // Without headroom, capability agents can only come from swapping out minimum agents
+        if (entity.Spec.MaxAgents <= entity.Spec.MinAgents)
+            yield return $"CapabilityAware is enabled but MaxAgents ({entity.Spec.MaxAgents}) leaves no room above MinAgents ({entity.Spec.MinAgents}). Jobs demanding a capability may never get an agent";
+
+        var distinctCapabilities = (entity.Spec.CapabilityImages?.Count ?? 0) + 1;
+        if (entity.Spec.MaxAgents < distinctCapabilities)
+            yield return $"CapabilityAware is enabled with {distinctCapabilities} capabilities (including base) but MaxAgents is {entity.Spec.MaxAgents}. Not every capability can run at the same time";
+    }
+
+    private static IEnumerable<string> ValidateCapabilityScaling(V1AzDORunnerEntity entity)
+    {
+        var capabilityScaling = entity.Spec.CapabilityScaling ?? new Dictionary<string, V1AzDORunnerEntity.CapabilityScalingSpec>();
+        if (capabilityScaling.Count == 0)
+            yield break;
+
+        if (!entity.Spec.CapabilityAware)
+            yield return "CapabilityScaling requires CapabilityAware to be enabled";
+
+        foreach (var (capability, scaling) in capabilityScaling)
+        {
+            if (capability != "base" && entity.Spec.CapabilityImages?.ContainsKey(capability) != true)
+                yield return $"CapabilityScaling '{capability}' must be 'base' or a key of CapabilityImages";
+
+            if (scaling.MinAgents < 0)
+                yield return $"CapabilityScaling '{capability}' MinAgents cannot be negative";
+
+            if (scaling.MaxAgents < scaling.MinAgents)
+                yield return $"CapabilityScaling '{capability}' MinAgents ({scaling.MinAgents}) cannot be greater than its MaxAgents ({scaling.MaxAgents})";
+        }
+
+        var totalMin = capabilityScaling.Values.Sum(s => s.MinAgents);
+        if (totalMin > entity.Spec.MaxAgents)
+            yield return $"CapabilityScaling MinAgents add up to {totalMin}, more than the pool's MaxAgents ({entity.Spec.MaxAgents})";
+
+        var totalMax = capabilityScaling.Values.Sum(s => s.MaxAgents ?? 0);
+        if (totalMax > entity.Spec.MaxAgents)
+            yield return $"CapabilityScaling MaxAgents add up to {totalMax}, more than the pool's MaxAgents ({entity.Spec.MaxAgents})";
+    }
+
+    private static IEnumerable<string> ValidateImmutableFields(V1AzDORunnerEntity oldEntity, V1AzDORunnerEntity newEntity)
+    {
+        // Changing these would orphan the registered agents, so the pool has to be recreated instead
+        if (!string.Equals(oldEntity.Spec.Pool, newEntity.Spec.Pool, StringComparison.Ordinal))
+            yield return $"Pool cannot be changed from '{oldEntity.Spec.Pool}' to '{newEntity.Spec.Pool}'. Delete and recreate the RunnerPool instead";
+
+        if (!string.Equals(oldEntity.Spec.AzDoUrl, newEntity.Spec.AzDoUrl, StringComparison.Ordinal))
+            yield return $"AzDoUrl cannot be changed from '{oldEntity.Spec.AzDoUrl}' to '{newEntity.Spec.AzDoUrl}'. Delete and recreate the RunnerPool instead";
+
+        if (!string.Equals(oldEntity.Spec.AgentNamePrefix ?? string.Empty, newEntity.Spec.AgentNamePrefix ?? string.Empty, StringComparison.Ordinal))
+            yield return $"AgentNamePrefix cannot be changed from '{oldEntity.Spec.AgentNamePrefix}' to '{newEntity.Spec.AgentNamePrefix}'. Delete and recreate the RunnerPool instead";
+    }
+
+    private IEnumerable<string> ValidateSpec(V1AzDORunnerEntity entity)
+    {
+        // Collect every failure so users can fix the whole spec in one pass
+        if (string.IsNullOrWhiteSpace(entity.Spec.AzDoUrl))
+            yield return "AzDoUrl is required and cannot be empty";
+
+        if (string.IsNullOrWhiteSpace(entity.Spec.PatSecretName))
+            yield return "PatSecretName is required and cannot be empty";
+
+        foreach (var error in ValidateBusinessLogic(entity))
+            yield return error;
+
+        foreach (var error in ValidateExtraEnv(entity.Spec.ExtraEnv))
+            yield return error;
+
+        foreach (var error in ValidatePvcs(entity.Spec.Pvcs))
+            yield return error;
+
+        foreach (var error in ValidateCertTrustStore(entity.Spec.CertTrustStore))
+            yield return error;
+
+        if (entity.Spec.Resources != null)
+        {
+            foreach (var error in ValidateResources(entity.Spec.Resources))
+                yield return error;
+        }
+    }
+
+    private IEnumerable<string> ValidateBusinessLogic(V1AzDORunnerEntity entity)
     {
         if (!string.IsNullOrWhiteSpace(entity.Spec.AzDoUrl))
         {
             if (!Uri.TryCreate(entity.Spec.AzDoUrl, UriKind.Absolute, out var uri) ||
                 (uri.Scheme != "https" && uri.Scheme != "http"))
-                return Fail("AzDoUrl must be a valid HTTP or HTTPS URL", 422);
+                yield return "AzDoUrl must be a valid HTTP or HTTPS URL";
+            else if (!IsAllowedAzDoHost(uri, entity))
+                yield return $"AzDoUrl host '{uri.Host}' is not an Azure DevOps host. Use dev.azure.com or *.visualstudio.com, " +
+                             $"or set the '{SelfHostedAnnotation}: \"true\"' annotation for Azure DevOps Server";
+            else if (!AzureDevOpsUrl.TryParse(entity.Spec.AzDoUrl, out _))
+                yield return "AzDoUrl must include the organization (https://dev.azure.com/<org>) or, for Azure DevOps Server, " +
+                             "the collection (https://<server>/tfs/<collection>) and no query string";
         }
 
-        if (!string.IsNullOrWhiteSpace(entity.Spec.Image))
-        {
-            if (entity.Spec.Image.Contains(" ") || entity.Spec.Image.Contains("\t"))
-                return Fail("Image cannot contain spaces or tabs", 422);
-        }
+        // Leave room for "-agent-<index>" within the 63 characters of a pod hostname
+        if (!string.IsNullOrEmpty(entity.Spec.AgentNamePrefix) &&
+            (!IsValidKubernetesName(entity.Spec.AgentNamePrefix) || entity.Spec.AgentNamePrefix.Length > 50))
+            yield return $"AgentNamePrefix '{entity.Spec.AgentNamePrefix}' must be a valid Kubernetes name (RFC 1123) of at most 50 characters";
+
+        if (string.IsNullOrWhiteSpace(entity.Spec.Image))
+            yield return "Image is required and cannot be empty";
+        else if (entity.Spec.Image.Contains(" ") || entity.Spec.Image.Contains("\t"))
+            yield return "Image cannot contain spaces or tabs";
 
         if (!string.IsNullOrWhiteSpace(entity.Spec.ImagePullPolicy))
         {
             var validImagePullPolicies = new[] { "Always", "IfNotPresent", "Never" };
             if (!validImagePullPolicies.Contains(entity.Spec.ImagePullPolicy))
-                return Fail($"ImagePullPolicy must be one of: {string.Join(", ", validImagePullPolicies)}", 422);
+                yield return $"ImagePullPolicy must be one of: {string.Join(", ", validImagePullPolicies)}";
+        }
+
+        if (entity.Spec.Proxy != null)
+        {
+            foreach (var (name, proxyUrl) in new[] { ("HttpProxy", entity.Spec.Proxy.HttpProxy), ("HttpsProxy", entity.Spec.Proxy.HttpsProxy) })
+            {
+                if (!string.IsNullOrWhiteSpace(proxyUrl) &&
+                    (!Uri.TryCreate(proxyUrl, UriKind.Absolute, out var proxyUri) || (proxyUri.Scheme != "http" && proxyUri.Scheme != "https")))
+                    yield return $"Proxy.{name} '{proxyUrl}' must be an absolute HTTP or HTTPS URL";
+            }
+        }
+
+        foreach (var error in ValidateCapabilityScaling(entity))
+            yield return error;
+
+        foreach (var secretName in entity.Spec.ImagePullSecrets ?? new List<string>())
+        {
+            if (string.IsNullOrWhiteSpace(secretName))
+                yield return "ImagePullSecrets entries must be non-empty secret names";
+            else if (!IsValidKubernetesName(secretName))
+                yield return $"Invalid image pull secret name '{secretName}'. Must be a valid Kubernetes name (RFC 1123)";
+        }
+
+        // Deployment pools register agents through deployment groups/environments, which the agent image doesn't do
+        if (!string.IsNullOrWhiteSpace(entity.Spec.PoolType) && entity.Spec.PoolType != "automation")
+            yield return entity.Spec.PoolType == "deployment"
+                ? "PoolType 'deployment' is not supported yet, only 'automation' agent pools can be scaled"
+                : $"PoolType must be 'automation', got '{entity.Spec.PoolType}'";
+
+        if (!string.IsNullOrWhiteSpace(entity.Spec.Mode))
+        {
+            var validModes = new[] { "Active", "DryRun" };
+            if (!validModes.Contains(entity.Spec.Mode))
+                yield return $"Mode must be one of: {string.Join(", ", validModes)}";
+        }
+
+        if (!string.IsNullOrWhiteSpace(entity.Spec.UpdateStrategy))
+        {
+            var validUpdateStrategies = new[] { "OnDelete", "RollingRecreate" };
+            if (!validUpdateStrategies.Contains(entity.Spec.UpdateStrategy))
+                yield return $"UpdateStrategy must be one of: {string.Join(", ", validUpdateStrategies)}";
         }
 
         if (entity.Spec.TtlIdleSeconds < 0)
-            return Fail("TtlIdleSeconds must be a non-negative value", 422);
+            yield return "TtlIdleSeconds must be a non-negative value";
 
         if (entity.Spec.MinAgents < 0)
-            return Fail("MinAgents must be a non-negative value", 422);
+            yield return "MinAgents must be a non-negative value";
 
         if (entity.Spec.MaxAgents < 1)
-            return Fail("MaxAgents must be at least 1", 422);
+            yield return "MaxAgents must be at least 1";
 
         if (entity.Spec.MinAgents > entity.Spec.MaxAgents)
-            return Fail($"MinAgents ({entity.Spec.MinAgents}) cannot be greater than MaxAgents ({entity.Spec.MaxAgents})", 422);
+            yield return $"MinAgents ({entity.Spec.MinAgents}) cannot be greater than MaxAgents ({entity.Spec.MaxAgents})";
+
+        // Keep in line with the spec's own validation, which the API server doesn't run for us
+        if (entity.Spec.PollIntervalSeconds < 5)
+            yield return "PollIntervalSeconds must be at least 5 seconds";
+
+        if (entity.Spec.DrainTimeoutSeconds < 0)
+            yield return "DrainTimeoutSeconds must be a non-negative value";
+
+        if (entity.Spec.MaxSurge < 1)
+            yield return "MaxSurge must be at least 1";
+
+        if (entity.Spec.JobsPerAgent < 1)
+            yield return "JobsPerAgent must be at least 1";
+
+        if (entity.Spec.ScaleDownStabilizationSeconds < 0)
+            yield return "ScaleDownStabilizationSeconds must be a non-negative value";
 
-        return null;
+        if (entity.Spec.StuckJobTimeoutSeconds < 0)
+            yield return "StuckJobTimeoutSeconds must be a non-negative value";
     }
 
-    private ValidationResult? ValidateExtraEnv(List<V1AzDORunnerEntity.ExtraEnvVar> extraEnv)
+    private IEnumerable<string> ValidateExtraEnv(List<V1AzDORunnerEntity.ExtraEnvVar> extraEnv)
     {
         var envNames = new HashSet<string>();
 
         foreach (var envVar in extraEnv)
         {
             if (string.IsNullOrWhiteSpace(envVar.Name))
-                return Fail("ExtraEnv entries must have a non-empty Name", 422);
+            {
+                yield return "ExtraEnv entries must have a non-empty Name";
+                continue;
+            }
 
             if (!envNames.Add(envVar.Name))
-                return Fail($"Duplicate environment variable name '{envVar.Name}' found in ExtraEnv", 422);
+                yield return $"Duplicate environment variable name '{envVar.Name}' found in ExtraEnv";
 
             if (!IsValidEnvVarName(envVar.Name))
-                return Fail($"Invalid environment variable name '{envVar.Name}'. Must contain only alphanumeric characters and underscores, and cannot start with a digit", 422);
+                yield return $"Invalid environment variable name '{envVar.Name}'. Must contain only alphanumeric characters and underscores, and cannot start with a digit";
 
             var hasValue = !string.IsNullOrEmpty(envVar.Value);
             var hasValueFrom = envVar.ValueFrom != null;
 
             if (!hasValue && !hasValueFrom)
-                return Fail($"ExtraEnv entry '{envVar.Name}' must have either Value or ValueFrom specified", 422);
+                yield return $"ExtraEnv entry '{envVar.Name}' must have either Value or ValueFrom specified";
 
             if (hasValue && hasValueFrom)
-                return Fail($"ExtraEnv entry '{envVar.Name}' cannot have both Value and ValueFrom specified", 422);
+                yield return $"ExtraEnv entry '{envVar.Name}' cannot have both Value and ValueFrom specified";
+
+            if (hasValueFrom)
+            {
+                foreach (var error in ValidateEnvVarSource(envVar.Name, envVar.ValueFrom!))
+                    yield return error;
+            }
         }
+    }
+
+    private static IEnumerable<string> ValidateEnvVarSource(string envName, V1EnvVarSource source)
+    {
+        var sourceCount = new object?[] { source.SecretKeyRef, source.ConfigMapKeyRef, source.FieldRef, source.ResourceFieldRef }
+            .Count(s => s != null);
+
+        if (sourceCount == 0)
+            yield return $"ExtraEnv entry '{envName}' ValueFrom must specify one of secretKeyRef, configMapKeyRef, fieldRef or resourceFieldRef";
+
+        if (sourceCount > 1)
+            yield return $"ExtraEnv entry '{envName}' ValueFrom must specify only one source";
 
-        return null;
+        if (source.SecretKeyRef != null &&
+            (string.IsNullOrWhiteSpace(source.SecretKeyRef.Name) || string.IsNullOrWhiteSpace(source.SecretKeyRef.Key)))
+            yield return $"ExtraEnv entry '{envName}' secretKeyRef must specify both name and key";
+
+        if (source.ConfigMapKeyRef != null &&
+            (string.IsNullOrWhiteSpace(source.ConfigMapKeyRef.Name) || string.IsNullOrWhiteSpace(source.ConfigMapKeyRef.Key)))
+            yield return $"ExtraEnv entry '{envName}' configMapKeyRef must specify both name and key";
     }
 
-    private ValidationResult? ValidatePvcs(List<V1AzDORunnerEntity.PvcSpec> pvcs)
+    private IEnumerable<string> ValidatePvcs(List<V1AzDORunnerEntity.PvcSpec> pvcs)
     {
         var pvcNames = new HashSet<string>();
         var mountPaths = new HashSet<string>();
@@ -133,40 +399,97 @@ public class V1RunnerPoolValidationWebhook : ValidationWebhook<V1AzDORunnerEntit
         foreach (var pvc in pvcs)
         {
             if (string.IsNullOrWhiteSpace(pvc.Name))
-                return Fail("PVC entries must have a non-empty Name", 422);
+            {
+                yield return "PVC entries must have a non-empty Name";
+                continue;
+            }
 
             if (!pvcNames.Add(pvc.Name))
-                return Fail($"Duplicate PVC name '{pvc.Name}' found in Pvcs", 422);
+                yield return $"Duplicate PVC name '{pvc.Name}' found in Pvcs";
 
             if (!IsValidKubernetesName(pvc.Name))
-                return Fail($"Invalid PVC name '{pvc.Name}'. Must be a valid Kubernetes name (RFC 1123)", 422);
+                yield return $"Invalid PVC name '{pvc.Name}'. Must be a valid Kubernetes name (RFC 1123)";
 
             if (string.IsNullOrWhiteSpace(pvc.MountPath))
-                return Fail($"PVC '{pvc.Name}' must have a MountPath specified", 422);
-
-            if (!mountPaths.Add(pvc.MountPath))
-                return Fail($"Duplicate mount path '{pvc.MountPath}' found in Pvcs", 422);
+            {
+                yield return $"PVC '{pvc.Name}' must have a MountPath specified";
+            }
+            else
+            {
+                if (!mountPaths.Add(pvc.MountPath))
+                    yield return $"Duplicate mount path '{pvc.MountPath}' found in Pvcs";
 
-            if (!pvc.MountPath.StartsWith("/"))
-                return Fail($"PVC '{pvc.Name}' mount path '{pvc.MountPath}' must be an absolute path (start with '/')", 422);
+                if (!pvc.MountPath.StartsWith("/"))
+                    yield return $"PVC '{pvc.Name}' mount path '{pvc.MountPath}' must be an absolute path (start with '/')";
+            }
 
             if (pvc.CreatePvc)
             {
                 if (string.IsNullOrWhiteSpace(pvc.Storage))
-                    return Fail($"PVC '{pvc.Name}' has CreatePvc=true but no Storage specified. Storage is required when creating a PVC", 422);
-
-                if (!IsValidStorageQuantity(pvc.Storage))
-                    return Fail($"PVC '{pvc.Name}' has invalid storage quantity '{pvc.Storage}'. Must use units: Gi, Mi, or Ki (e.g., '1Gi', '500Mi')", 422);
+                    yield return $"PVC '{pvc.Name}' has CreatePvc=true but no Storage specified. Storage is required when creating a PVC";
+                else if (!IsValidStorageQuantity(pvc.Storage))
+                    yield return $"PVC '{pvc.Name}' has invalid storage quantity '{pvc.Storage}'. Must be a positive Kubernetes quantity (e.g., '1Gi', '500Mi', '1Ti')";
             }
 
             if (!string.IsNullOrWhiteSpace(pvc.StorageClass) && !IsValidKubernetesName(pvc.StorageClass))
-                return Fail($"PVC '{pvc.Name}' has invalid storage class name '{pvc.StorageClass}'. Must be a valid Kubernetes name", 422);
+                yield return $"PVC '{pvc.Name}' has invalid storage class name '{pvc.StorageClass}'. Must be a valid Kubernetes name";
 
             if (!pvc.CreatePvc && pvc.DeleteWithAgent)
-                return Fail($"PVC '{pvc.Name}' has CreatePvc=false but DeleteWithAgent=true. Cannot delete a PVC that wasn't created by this operator", 422);
+                yield return $"PVC '{pvc.Name}' has CreatePvc=false but DeleteWithAgent=true. Cannot delete a PVC that wasn't created by this operator";
         }
+    }
+
+    private static IEnumerable<string> ValidateResources(V1AzDORunnerEntity.ResourcesSpec resources)
+    {
+        var requests = new Dictionary<string, decimal>();
+
+        foreach (var (name, quantity) in resources.Requests ?? new Dictionary<string, string>())
+        {
+            if (TryParseQuantity(quantity, out var value))
+                requests[name] = value;
+            else
+                yield return $"Resources.Requests '{name}' has invalid quantity '{quantity}'. Must be a Kubernetes quantity (e.g., '500m', '1Gi')";
+        }
+
+        foreach (var (name, quantity) in resources.Limits ?? new Dictionary<string, string>())
+        {
+            if (!TryParseQuantity(quantity, out var limit))
+                yield return $"Resources.Limits '{name}' has invalid quantity '{quantity}'. Must be a Kubernetes quantity (e.g., '2', '4Gi')";
+            else if (requests.TryGetValue(name, out var request) && limit < request)
+                yield return $"Resources.Limits '{name}' ({quantity}) cannot be lower than Resources.Requests '{name}' ({resources.Requests![name]})";
+        }
+    }
+
+    private static bool TryParseQuantity(string quantity, out decimal value)
+    {
+        value = 0;
+        if (string.IsNullOrWhiteSpace(quantity))
+            return false;
+
+        try
+        {
+            value = new ResourceQuantity(quantity).ToDecimal();
+            return value >= 0;
+        }
+        catch (Exception ex) when (ex is FormatException || ex is ArgumentException)
+        {
+            return false;
+        }
+    }
+
+    private bool IsAllowedAzDoHost(Uri uri, V1AzDORunnerEntity entity)
+    {
+        var host = uri.Host;
+
+        if (host.Equals("dev.azure.com", StringComparison.OrdinalIgnoreCase) ||
+            host.EndsWith(".visualstudio.com", StringComparison.OrdinalIgnoreCase))
+            return true;
+
+        if (_allowedHosts.Contains(host))
+            return true;
 
-        return null;
+        return entity.Metadata.Annotations?.TryGetValue(SelfHostedAnnotation, out var selfHosted) == true &&
+               string.Equals(selfHosted, "true", StringComparison.OrdinalIgnoreCase);
     }
 
     private static bool IsValidEnvVarName(string name)
@@ -194,23 +517,24 @@ public class V1RunnerPoolValidationWebhook : ValidationWebhook<V1AzDORunnerEntit
         return name.All(c => (char.IsLower(c) && char.IsLetter(c)) || char.IsDigit(c) || c == '-');
     }
 
-    private ValidationResult? ValidateCertTrustStore(List<V1AzDORunnerEntity.CertTrustStore> certTrustStore)
+    private IEnumerable<string> ValidateCertTrustStore(List<V1AzDORunnerEntity.CertTrustStore> certTrustStore)
     {
         var secretNames = new HashSet<string>();
 
         foreach (var cert in certTrustStore)
         {
             if (string.IsNullOrWhiteSpace(cert.SecretName))
-                return Fail("CertTrustStore entries must have a non-empty SecretName", 422);
+            {
+                yield return "CertTrustStore entries must have a non-empty SecretName";
+                continue;
+            }
 
             if (!secretNames.Add(cert.SecretName))
-                return Fail($"Duplicate secret name '{cert.SecretName}' found in CertTrustStore", 422);
+                yield return $"Duplicate secret name '{cert.SecretName}' found in CertTrustStore";
 
             if (!IsValidKubernetesName(cert.SecretName))
-                return Fail($"Invalid secret name '{cert.SecretName}'. Must be a valid Kubernetes name (RFC 1123)", 422);
+                yield return $"Invalid secret name '{cert.SecretName}'. Must be a valid Kubernetes name (RFC 1123)";
         }
-
-        return null;
     }
 
     private static bool IsValidStorageQuantity(string quantity)
@@ -218,12 +542,14 @@ public class V1RunnerPoolValidationWebhook : ValidationWebhook<V1AzDORunnerEntit
         if (string.IsNullOrWhiteSpace(quantity))
             return false;
 
-        var validUnits = new[] { "Gi", "Mi", "Ki" };
-
-        if (long.TryParse(quantity, out _))
-            return true;
-
-        return validUnits.Any(unit => quantity.EndsWith(unit, StringComparison.OrdinalIgnoreCase) &&
-                                     long.TryParse(quantity.Substring(0, quantity.Length - unit.Length), out _));
+        // Parse the same way the API server will when the PVC is created, so "10GG" or "10gi" never gets that far
+        try
+        {
+            return new ResourceQuantity(quantity).ToDecimal() > 0;
+        }
+        catch (Exception ex) when (ex is FormatException || ex is ArgumentException)
+        {
+            return false;
+        }
     }
 }
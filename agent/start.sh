@@ -18,6 +18,7 @@ echo "Agent Configuration:"
 echo "   Agent Name: $AZP_AGENT_NAME"
 echo "   Organization URL: $AZP_URL"
 echo "   Pool: $AZP_POOL"
+echo "   Work Directory: ${AZP_WORK:-_work}"
 echo "   Capability: $CAPABILITY"
 echo "   Mode: $RUN_MODE"
 
@@ -42,7 +43,7 @@ AGENT_CONFIG_ARGS=(
     --auth PAT
     --token "$AZP_TOKEN"
     --pool "$AZP_POOL"
-    --work "_work"
+    --work "${AZP_WORK:-_work}"
     --replace
     --acceptTeeEula
 )